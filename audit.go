@@ -0,0 +1,65 @@
+package gsm
+
+import (
+	"sync"
+	"time"
+)
+
+// AuditEntry is one audited transition, as recorded by ApplyAudited.
+type AuditEntry struct {
+	Time   time.Time
+	Event  string
+	Before State
+	After  State
+
+	// Compensated is true if the event's raw effect violated an invariant
+	// and was repaired; Invariants lists the repairs that fired, in order.
+	// Machines from Load have no closures and never report compensation.
+	Compensated bool
+	Invariants  []string
+}
+
+// Auditor receives audit entries from ApplyAudited.
+type Auditor interface {
+	Record(entry AuditEntry)
+}
+
+// ApplyAudited is Apply that records the transition with a. The entry is
+// recorded after the transition is computed and before it is returned.
+// Panics if the event name is unknown.
+func (m *Machine) ApplyAudited(s State, event string, a Auditor) State {
+	var fired []string
+	next := m.ApplyWithHook(s, event, func(_ State, invariant string, _ State) {
+		fired = append(fired, invariant)
+	})
+	a.Record(AuditEntry{
+		Time:        time.Now(),
+		Event:       event,
+		Before:      s,
+		After:       next,
+		Compensated: len(fired) > 0,
+		Invariants:  fired,
+	})
+	return next
+}
+
+// SliceAuditor is an in-memory Auditor that keeps every entry. It is safe
+// for concurrent use.
+type SliceAuditor struct {
+	mu      sync.Mutex
+	entries []AuditEntry
+}
+
+// Record appends the entry.
+func (a *SliceAuditor) Record(entry AuditEntry) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	a.entries = append(a.entries, entry)
+}
+
+// Entries returns a copy of the recorded entries, oldest first.
+func (a *SliceAuditor) Entries() []AuditEntry {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	return append([]AuditEntry(nil), a.entries...)
+}
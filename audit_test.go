@@ -0,0 +1,68 @@
+package gsm_test
+
+import (
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+func TestApplyAudited(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	var a gsm.SliceAuditor
+
+	s := m.ApplyAudited(m.NewState(), "restock", &a)
+	s = m.ApplyAudited(s, "process_payment", &a)
+	s = m.ApplyAudited(s, "ship_item", &a)
+	if want := m.Apply(m.Apply(m.Apply(m.NewState(), "restock"), "process_payment"), "ship_item"); s.ID() != want.ID() {
+		t.Fatalf("ApplyAudited result %s, want %s", s, want)
+	}
+
+	entries := a.Entries()
+	if len(entries) != 3 {
+		t.Fatalf("expected 3 entries, got %d", len(entries))
+	}
+	for i, e := range entries {
+		if e.Time.IsZero() {
+			t.Errorf("entry %d has no timestamp", i)
+		}
+		if i > 0 && e.Before.ID() != entries[i-1].After.ID() {
+			t.Errorf("entry %d does not chain from the previous one", i)
+		}
+		if e.Compensated {
+			t.Errorf("entry %d (%s) unexpectedly compensated", i, e.Event)
+		}
+	}
+	if entries[2].Event != "ship_item" || entries[2].After.ID() != s.ID() {
+		t.Errorf("unexpected last entry %+v", entries[2])
+	}
+}
+
+func TestApplyAuditedCompensation(t *testing.T) {
+	b := gsm.NewRegistry("capped")
+	n := b.Int("n", 0, 7)
+	b.Invariant("cap").
+		Watches(n).
+		Holds(func(s gsm.State) bool { return s.GetInt(n) <= 3 }).
+		Repair(func(s gsm.State) gsm.State { return s.SetInt(n, 3) }).
+		Add()
+	b.Event("add_two").
+		Writes(n).
+		Apply(func(s gsm.State) gsm.State { return s.SetInt(n, s.GetInt(n)+2) }).
+		Add()
+	m, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+
+	var a gsm.SliceAuditor
+	s := m.ApplyAudited(m.NewState(), "add_two", &a)
+	m.ApplyAudited(s, "add_two", &a)
+
+	entries := a.Entries()
+	if entries[0].Compensated {
+		t.Error("0 → 2 needs no repair")
+	}
+	if e := entries[1]; !e.Compensated || len(e.Invariants) != 1 || e.Invariants[0] != "cap" || e.After.GetInt(n) != 3 {
+		t.Errorf("expected cap to repair 2 → 4 to 3, got %+v", e)
+	}
+}
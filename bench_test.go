@@ -0,0 +1,239 @@
+package gsm_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+var (
+	largeOnce    sync.Once
+	largeMachine *gsm.Machine
+)
+
+// buildLargeMachine builds an 18-bit synthetic machine (262,144 states):
+// two 8-bit counters and two flags, with a cap invariant coupling them.
+// CC is not checked; the machine exists to measure runtime lookups on
+// tables too large for L2 cache.
+func buildLargeMachine(b *testing.B) *gsm.Machine {
+	b.Helper()
+	largeOnce.Do(func() {
+		r := gsm.NewRegistry("large")
+
+		lo := r.Int("lo", 0, 255)
+		hi := r.Int("hi", 0, 255)
+		armed := r.Bool("armed")
+		busy := r.Bool("busy")
+
+		r.Invariant("lo_lte_hi").
+			Watches(lo, hi).
+			Holds(func(s gsm.State) bool { return s.GetInt(lo) <= s.GetInt(hi) }).
+			Repair(func(s gsm.State) gsm.State { return s.SetInt(lo, s.GetInt(hi)) }).
+			Add()
+
+		r.Event("inc_lo").
+			Writes(lo).
+			Apply(func(s gsm.State) gsm.State { return s.SetInt(lo, s.GetInt(lo)+7) }).
+			Add()
+		r.Event("inc_hi").
+			Writes(hi).
+			Apply(func(s gsm.State) gsm.State { return s.SetInt(hi, s.GetInt(hi)+3) }).
+			Add()
+		r.Event("arm").
+			Writes(armed).
+			Apply(func(s gsm.State) gsm.State { return s.SetBool(armed, !s.GetBool(armed)) }).
+			Add()
+		r.Event("work").
+			Writes(busy).
+			Guard(func(s gsm.State) bool { return s.GetBool(armed) }).
+			Apply(func(s gsm.State) gsm.State { return s.SetBool(busy, !s.GetBool(busy)) }).
+			Add()
+
+		r.OnlyDeclaredPairs()
+
+		m, report, err := r.Build()
+		if err != nil {
+			b.Fatalf("Build failed: %v\n%s", err, report)
+		}
+		largeMachine = m
+	})
+	return largeMachine
+}
+
+func orderMachineForBench(b *testing.B) *gsm.Machine {
+	b.Helper()
+	m, report, err := newOrderRegistry().Build()
+	if err != nil {
+		b.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	return m
+}
+
+var sink gsm.State
+
+func benchApply(b *testing.B, m *gsm.Machine) {
+	events := m.Events()
+	s := m.NewState()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s = m.Apply(s, events[i%len(events)])
+	}
+	sink = s
+}
+
+func benchApplyByIndex(b *testing.B, m *gsm.Machine) {
+	n := len(m.Events())
+	s := m.NewState()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s = m.ApplyByIndex(s, i%n)
+	}
+	sink = s
+}
+
+func benchApplyRaw(b *testing.B, m *gsm.Machine) {
+	n := len(m.Events())
+	id := m.NewState().ID()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		id = m.ApplyRaw(id, i%n)
+	}
+	sink = m.StateFromID(id)
+}
+
+func benchApplySequence(b *testing.B, m *gsm.Machine) {
+	events := m.Events()
+	seq := make([]string, 64)
+	for i := range seq {
+		seq[i] = events[(i*7)%len(events)]
+	}
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		s := m.NewState()
+		for _, ev := range seq {
+			s = m.Apply(s, ev)
+		}
+		sink = s
+	}
+}
+
+func benchNormalize(b *testing.B, m *gsm.Machine) {
+	states := m.ReachableStates()
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		sink = m.Normalize(states[i%len(states)])
+	}
+}
+
+func BenchmarkApply(b *testing.B) {
+	b.Run("order", func(b *testing.B) { benchApply(b, orderMachineForBench(b)) })
+	b.Run("large", func(b *testing.B) { benchApply(b, buildLargeMachine(b)) })
+}
+
+func BenchmarkApplyByIndex(b *testing.B) {
+	b.Run("order", func(b *testing.B) { benchApplyByIndex(b, orderMachineForBench(b)) })
+	b.Run("large", func(b *testing.B) { benchApplyByIndex(b, buildLargeMachine(b)) })
+}
+
+func BenchmarkApplyRaw(b *testing.B) {
+	b.Run("order", func(b *testing.B) { benchApplyRaw(b, orderMachineForBench(b)) })
+	b.Run("large", func(b *testing.B) { benchApplyRaw(b, buildLargeMachine(b)) })
+}
+
+func BenchmarkApplySequence(b *testing.B) {
+	b.Run("order", func(b *testing.B) { benchApplySequence(b, orderMachineForBench(b)) })
+	b.Run("large", func(b *testing.B) { benchApplySequence(b, buildLargeMachine(b)) })
+}
+
+func BenchmarkNormalize(b *testing.B) {
+	b.Run("order", func(b *testing.B) { benchNormalize(b, orderMachineForBench(b)) })
+	b.Run("large", func(b *testing.B) { benchNormalize(b, buildLargeMachine(b)) })
+}
+
+// BenchmarkApplyMany compares applying one event to a batch of reachable
+// states with ApplyMany, in place and into a new slice, against a loop of
+// Apply.
+func BenchmarkApplyMany(b *testing.B) {
+	m := buildLargeMachine(b)
+	event := m.Events()[0]
+	reachable := m.ReachableStates()
+	ids := make([]uint64, 4096)
+	for i := range ids {
+		ids[i] = reachable[(i*31)%len(reachable)].ID()
+	}
+
+	b.Run("apply-loop", func(b *testing.B) {
+		out := make([]uint64, len(ids))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			for k, id := range ids {
+				out[k] = m.Apply(m.StateFromID(id), event).ID()
+			}
+		}
+	})
+	b.Run("apply-many", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			_ = m.ApplyMany(ids, event)
+		}
+	})
+	b.Run("apply-many-in-place", func(b *testing.B) {
+		buf := make([]uint64, len(ids))
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			copy(buf, ids)
+			_ = m.ApplyMany(buf, event, gsm.InPlace())
+		}
+	})
+}
+
+// TestApplyZeroAlloc pins the claim that runtime application does not
+// allocate: State is a packed ID plus a shared slice header, returned by
+// value.
+func TestApplyZeroAlloc(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	s := m.NewState()
+	ei, _ := m.EventIndex("restock")
+	paid, _ := m.Var("paid")
+
+	for name, fn := range map[string]func(){
+		"Apply":        func() { s = m.Apply(s, "restock") },
+		"ApplyByIndex": func() { s = m.ApplyByIndex(s, ei) },
+		"Normalize":    func() { s = m.Normalize(s) },
+		"IsValid":      func() { _ = m.IsValid(s) },
+		"ApplyRaw":     func() { _ = m.NormalizeRaw(m.ApplyRaw(s.ID(), ei)) },
+		"BuildState":   func() { s = m.BuildState().SetBool(paid, true).State() },
+	} {
+		if allocs := testing.AllocsPerRun(1000, fn); allocs != 0 {
+			t.Errorf("%s allocates %.1f times per call", name, allocs)
+		}
+	}
+}
+
+// BenchmarkBuildState compares setting every variable of a state with
+// chained State setters against a StateBuilder.
+func BenchmarkBuildState(b *testing.B) {
+	m := orderMachineForBench(b)
+	status, _ := m.Var("status")
+	paid, _ := m.Var("paid")
+	inventory, _ := m.Var("inventory")
+
+	b.Run("chained", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sink = m.NewState().Set(status, "paid").SetBool(paid, true).SetInt(inventory, i%6)
+		}
+	})
+	b.Run("builder", func(b *testing.B) {
+		b.ReportAllocs()
+		for i := 0; i < b.N; i++ {
+			sink = m.BuildState().SetEnum(status, "paid").SetBool(paid, true).SetInt(inventory, i%6).State()
+		}
+	})
+}
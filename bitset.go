@@ -0,0 +1,16 @@
+package gsm
+
+// bitset is a fixed-size set of small non-negative integers, one bit each.
+type bitset []uint64
+
+func newBitset(n int) bitset {
+	return make(bitset, (n+63)/64)
+}
+
+func (b bitset) set(i uint64) {
+	b[i/64] |= 1 << (i % 64)
+}
+
+func (b bitset) has(i uint64) bool {
+	return i/64 < uint64(len(b)) && b[i/64]&(1<<(i%64)) != 0
+}
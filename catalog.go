@@ -0,0 +1,101 @@
+package gsm
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Catalog is a set of machines looked up by name, for services that host
+// many machine definitions. The zero value is an empty catalog ready to
+// use, and a Catalog is safe for concurrent use.
+type Catalog struct {
+	mu       sync.RWMutex
+	machines map[string]*Machine
+}
+
+// Register adds m under its name. It returns an error, and leaves the
+// catalog unchanged, if a machine with that name is already registered.
+func (c *Catalog) Register(m *Machine) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if _, dup := c.machines[m.name]; dup {
+		return fmt.Errorf("gsm: catalog already has a machine named %q", m.name)
+	}
+	if c.machines == nil {
+		c.machines = make(map[string]*Machine)
+	}
+	c.machines[m.name] = m
+	return nil
+}
+
+// Get returns the machine registered under name.
+func (c *Catalog) Get(name string) (*Machine, bool) {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	m, ok := c.machines[name]
+	return m, ok
+}
+
+// Names returns the names of the registered machines, sorted.
+func (c *Catalog) Names() []string {
+	c.mu.RLock()
+	defer c.mu.RUnlock()
+	names := make([]string, 0, len(c.machines))
+	for name := range c.machines {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Load reads every *.gsm.json file in dir with Load and registers the
+// machines by name. It is all or nothing: if any file fails to load, or
+// two machines share a name with each other or with one already
+// registered, it returns an error naming the file and registers none.
+// Subdirectories are not searched. dir is a plain path, not a pattern, and
+// a directory that cannot be read is an error.
+func (c *Catalog) Load(dir string, opts ...LoadOption) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Errorf("gsm: reading catalog directory %q: %w", dir, err)
+	}
+	var paths []string // sorted, as ReadDir returns entries by name
+	for _, e := range entries {
+		if !e.IsDir() && strings.HasSuffix(e.Name(), ".gsm.json") {
+			paths = append(paths, filepath.Join(dir, e.Name()))
+		}
+	}
+
+	loaded := make(map[string]*Machine, len(paths))
+	from := make(map[string]string, len(paths)) // machine name → file
+	for _, path := range paths {
+		m, err := Load(path, opts...)
+		if err != nil {
+			return fmt.Errorf("gsm: loading %s: %w", path, err)
+		}
+		if prev, dup := from[m.name]; dup {
+			return fmt.Errorf("gsm: %s and %s both define machine %q", prev, path, m.name)
+		}
+		loaded[m.name] = m
+		from[m.name] = path
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for name := range loaded {
+		if _, dup := c.machines[name]; dup {
+			return fmt.Errorf("gsm: %s defines machine %q, which the catalog already has", from[name], name)
+		}
+	}
+	if c.machines == nil {
+		c.machines = make(map[string]*Machine)
+	}
+	for name, m := range loaded {
+		c.machines[name] = m
+	}
+	return nil
+}
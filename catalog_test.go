@@ -0,0 +1,101 @@
+package gsm_test
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+func TestCatalogLoad(t *testing.T) {
+	order, _ := buildOrderMachine(t)
+	light, _, err := newLightRegistry().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	for file, m := range map[string]*gsm.Machine{"order.gsm.json": order, "light.gsm.json": light} {
+		if err := m.Export(filepath.Join(dir, file)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// Files without the suffix are ignored.
+	if err := os.WriteFile(filepath.Join(dir, "notes.json"), []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	var c gsm.Catalog
+	if err := c.Load(dir); err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if want := []string{"light", "order_fulfillment"}; !reflect.DeepEqual(c.Names(), want) {
+		t.Errorf("Names = %v, want %v", c.Names(), want)
+	}
+	m, ok := c.Get("order_fulfillment")
+	if !ok {
+		t.Fatal("order_fulfillment not registered")
+	}
+	if got := m.Apply(m.NewState(), "restock"); got.ID() != order.Apply(order.NewState(), "restock").ID() {
+		t.Errorf("catalog machine diverges from the original: %s", got)
+	}
+	if _, ok := c.Get("missing"); ok {
+		t.Error("Get(missing) should fail")
+	}
+
+	// The directory is a path, not a pattern, and must exist.
+	var empty gsm.Catalog
+	if err := empty.Load(filepath.Join(dir, "missing")); err == nil || !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("missing directory: err = %v", err)
+	}
+	if err := empty.Load(filepath.Join(dir, "*")); err == nil {
+		t.Error("a glob pattern should not be expanded")
+	}
+
+	// Loading the same directory again collides with every name.
+	if err := c.Load(dir); err == nil || !strings.Contains(err.Error(), "already has") {
+		t.Errorf("reloading: err = %v, want collision", err)
+	}
+}
+
+func TestCatalogCollisions(t *testing.T) {
+	order, _ := buildOrderMachine(t)
+
+	var c gsm.Catalog
+	if err := c.Register(order); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Register(order); err == nil {
+		t.Error("registering a name twice should fail")
+	}
+
+	// Two files defining the same machine: nothing is registered.
+	dir := t.TempDir()
+	for _, file := range []string{"a.gsm.json", "b.gsm.json"} {
+		if err := order.Export(filepath.Join(dir, file)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var fresh gsm.Catalog
+	err := fresh.Load(dir)
+	if err == nil || !strings.Contains(err.Error(), "both define") {
+		t.Errorf("Load: err = %v, want duplicate name", err)
+	}
+	if len(fresh.Names()) != 0 {
+		t.Errorf("failed Load registered %v", fresh.Names())
+	}
+
+	// A file that fails to load is reported by path.
+	bad := t.TempDir()
+	if err := os.WriteFile(filepath.Join(bad, "broken.gsm.json"), []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := fresh.Load(bad); err == nil || !strings.Contains(err.Error(), "broken.gsm.json") {
+		t.Errorf("Load: err = %v, want error naming broken.gsm.json", err)
+	}
+}
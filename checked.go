@@ -0,0 +1,118 @@
+package gsm
+
+// Checked builders mirror EventBuilder and InvariantBuilder for code that
+// embeds gsm and must not panic on a bad declaration, such as a service
+// building machines from user-supplied definitions. They record the first
+// declaration mistake the panicking builders would panic on and return it
+// from Add. Mistakes that the panicking API already defers to Build, such
+// as writing a variable of another registry, are still reported by Build.
+
+// CheckedEventBuilder is EventBuilder with an Add that returns an error
+// instead of panicking. Create one with Registry.TryEvent.
+type CheckedEventBuilder struct {
+	eb *EventBuilder
+}
+
+// TryEvent begins declaring a named event whose Add returns an error
+// rather than panicking.
+func (r *Registry) TryEvent(name string) *CheckedEventBuilder {
+	return &CheckedEventBuilder{eb: r.Event(name)}
+}
+
+// Writes is EventBuilder.Writes.
+func (cb *CheckedEventBuilder) Writes(vars ...Var) *CheckedEventBuilder {
+	cb.eb.Writes(vars...)
+	return cb
+}
+
+// RequiresPrev is EventBuilder.RequiresPrev.
+func (cb *CheckedEventBuilder) RequiresPrev(prevEvent string) *CheckedEventBuilder {
+	cb.eb.RequiresPrev(prevEvent)
+	return cb
+}
+
+// Tag is EventBuilder.Tag.
+func (cb *CheckedEventBuilder) Tag(tags ...string) *CheckedEventBuilder {
+	cb.eb.Tag(tags...)
+	return cb
+}
+
+// Guard is EventBuilder.Guard.
+func (cb *CheckedEventBuilder) Guard(fn CheckFunc) *CheckedEventBuilder {
+	cb.eb.Guard(fn)
+	return cb
+}
+
+// Apply is EventBuilder.Apply.
+func (cb *CheckedEventBuilder) Apply(fn EffectFunc) *CheckedEventBuilder {
+	cb.eb.Apply(fn)
+	return cb
+}
+
+// ApplyErr is EventBuilder.ApplyErr.
+func (cb *CheckedEventBuilder) ApplyErr(fn func(State) (State, error)) *CheckedEventBuilder {
+	cb.eb.ApplyErr(fn)
+	return cb
+}
+
+// Add registers the event with the registry. It returns an error, and
+// registers nothing, if no effect function was set.
+func (cb *CheckedEventBuilder) Add() error {
+	return cb.eb.add()
+}
+
+// CheckedInvariantBuilder is InvariantBuilder with an Add that returns an
+// error instead of panicking. Create one with Registry.TryInvariant.
+type CheckedInvariantBuilder struct {
+	ib  *InvariantBuilder
+	err error // first error from Couples
+}
+
+// TryInvariant begins declaring a named invariant whose Add returns an
+// error rather than panicking.
+func (r *Registry) TryInvariant(name string) *CheckedInvariantBuilder {
+	return &CheckedInvariantBuilder{ib: r.Invariant(name)}
+}
+
+// Watches is InvariantBuilder.Watches.
+func (cb *CheckedInvariantBuilder) Watches(vars ...Var) *CheckedInvariantBuilder {
+	cb.ib.Watches(vars...)
+	return cb
+}
+
+// Holds is InvariantBuilder.Holds.
+func (cb *CheckedInvariantBuilder) Holds(fn CheckFunc) *CheckedInvariantBuilder {
+	cb.ib.Holds(fn)
+	return cb
+}
+
+// Couples is InvariantBuilder.Couples, except that a variable of the wrong
+// kind or registry is reported by Add instead of panicking.
+func (cb *CheckedInvariantBuilder) Couples(enumVar Var, intVar Var, rule func(enumLabel string, intVal int) bool) *CheckedInvariantBuilder {
+	if err := cb.ib.couples(enumVar, intVar, rule); err != nil && cb.err == nil {
+		cb.err = err
+	}
+	return cb
+}
+
+// When is InvariantBuilder.When.
+func (cb *CheckedInvariantBuilder) When(pred CheckFunc) *CheckedInvariantBuilder {
+	cb.ib.When(pred)
+	return cb
+}
+
+// Repair is InvariantBuilder.Repair.
+func (cb *CheckedInvariantBuilder) Repair(fn EffectFunc) *CheckedInvariantBuilder {
+	cb.ib.Repair(fn)
+	return cb
+}
+
+// Add registers the invariant with the registry. It returns an error, and
+// registers nothing, if the check or repair function is missing or a
+// Couples call failed.
+func (cb *CheckedInvariantBuilder) Add() error {
+	if cb.err != nil {
+		return cb.err
+	}
+	return cb.ib.add()
+}
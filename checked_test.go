@@ -0,0 +1,153 @@
+package gsm_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+func TestTryVars(t *testing.T) {
+	b := gsm.NewRegistry("try_vars")
+	if _, err := b.TryEnum("status", "only"); err == nil || !strings.Contains(err.Error(), "at least 2 values") {
+		t.Errorf("TryEnum with one value: err = %v", err)
+	}
+	if _, err := b.TryInt("count", 3, 1); err == nil || !strings.Contains(err.Error(), "max < min") {
+		t.Errorf("TryInt with max < min: err = %v", err)
+	}
+	status, err := b.TryEnum("status", "open", "closed")
+	if err != nil {
+		t.Fatalf("TryEnum: %v", err)
+	}
+	count, err := b.TryInt("count", 0, 3)
+	if err != nil {
+		t.Fatalf("TryInt: %v", err)
+	}
+	b.Event("close").Writes(status).Apply(func(s gsm.State) gsm.State { return s.Set(status, "closed") }).Add()
+
+	// Failed declarations leave no variable behind.
+	m, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v\n%s", err, report)
+	}
+	if st := m.Stats(); st.VarCount != 2 || st.TotalBits != 3 {
+		t.Errorf("got %d vars in %d bits, want status and count only", st.VarCount, st.TotalBits)
+	}
+	if _, ok := m.Var(count.Name()); !ok {
+		t.Error("count missing after a failed TryInt of the same name")
+	}
+	if got := m.Apply(m.NewState(), "close").Get(status); got != "closed" {
+		t.Errorf("close: status = %q", got)
+	}
+}
+
+func TestTryEventAndInvariant(t *testing.T) {
+	b := gsm.NewRegistry("try_decls")
+	open := b.Bool("open")
+	level := b.Int("level", 0, 2)
+
+	if err := b.TryEvent("noop").Writes(open).Add(); err == nil || !strings.Contains(err.Error(), "no effect function") {
+		t.Errorf("TryEvent without effect: err = %v", err)
+	}
+	err := b.TryEvent("raise").
+		Writes(level).
+		Tag("level").
+		Guard(func(s gsm.State) bool { return s.GetInt(level) < 2 }).
+		Apply(func(s gsm.State) gsm.State { return s.SetInt(level, s.GetInt(level)+1) }).
+		Add()
+	if err != nil {
+		t.Fatalf("TryEvent: %v", err)
+	}
+	if err := b.TryEvent("open").Writes(open).Apply(func(s gsm.State) gsm.State { return s.SetBool(open, true) }).Add(); err != nil {
+		t.Fatalf("TryEvent: %v", err)
+	}
+
+	if err := b.TryInvariant("no_check").Watches(level).Repair(func(s gsm.State) gsm.State { return s }).Add(); err == nil || !strings.Contains(err.Error(), "no check function") {
+		t.Errorf("TryInvariant without check: err = %v", err)
+	}
+	if err := b.TryInvariant("no_repair").Watches(level).Holds(func(gsm.State) bool { return true }).Add(); err == nil || !strings.Contains(err.Error(), "no repair function") {
+		t.Errorf("TryInvariant without repair: err = %v", err)
+	}
+	err = b.TryInvariant("bad_couple").
+		Couples(level, level, func(string, int) bool { return true }).
+		Repair(func(s gsm.State) gsm.State { return s }).
+		Add()
+	if err == nil || !strings.Contains(err.Error(), "not an enum") {
+		t.Errorf("TryInvariant with bad Couples: err = %v", err)
+	}
+	err = b.TryInvariant("level_is_low").
+		Watches(level).
+		Holds(func(s gsm.State) bool { return s.GetInt(level) < 2 }).
+		Repair(func(s gsm.State) gsm.State { return s.SetInt(level, 1) }).
+		Add()
+	if err != nil {
+		t.Fatalf("TryInvariant: %v", err)
+	}
+
+	m, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v\n%s", err, report)
+	}
+	if st := m.Stats(); st.EventCount != 2 || st.InvariantCount != 1 {
+		t.Errorf("got %d events, %d invariants; want only the valid declarations", st.EventCount, st.InvariantCount)
+	}
+	s := m.Apply(m.Apply(m.NewState(), "raise"), "raise")
+	if got := s.GetInt(level); got != 1 {
+		t.Errorf("raise twice: level = %d, want repaired to 1", got)
+	}
+}
+
+func TestTryIndependent(t *testing.T) {
+	b := gsm.NewRegistry("try_pairs")
+	x := b.Bool("x")
+	y := b.Bool("y")
+	b.Event("set_x").Writes(x).Apply(func(s gsm.State) gsm.State { return s.SetBool(x, true) }).Add()
+	b.Event("set_y").Writes(y).Apply(func(s gsm.State) gsm.State { return s.SetBool(y, true) }).Add()
+
+	if err := b.TryIndependent("set_x", "missing"); err == nil || !strings.Contains(err.Error(), `unknown event "missing"`) {
+		t.Errorf("TryIndependent with unknown event: err = %v", err)
+	}
+	if err := b.TryIndependent("set_x", "set_x"); err == nil || !strings.Contains(err.Error(), "independent of itself") {
+		t.Errorf("TryIndependent with itself: err = %v", err)
+	}
+
+	// Failed declarations do not switch to declared-only mode.
+	_, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v\n%s", err, report)
+	}
+	if report.CCScope != "all" {
+		t.Errorf("CCScope after failed TryIndependent = %q, want all", report.CCScope)
+	}
+
+	if err := b.TryIndependent("set_y", "set_x"); err != nil {
+		t.Fatalf("TryIndependent: %v", err)
+	}
+	_, report, err = b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v\n%s", err, report)
+	}
+	if report.CCScope != "declared" || report.PairsUnchecked != 0 {
+		t.Errorf("CCScope = %q with %d unchecked, want the one declared pair", report.CCScope, report.PairsUnchecked)
+	}
+}
+
+func TestPanickingBuildersUnchanged(t *testing.T) {
+	b := gsm.NewRegistry("panics")
+	for name, fn := range map[string]func(){
+		"needs at least 2 values": func() { b.Enum("e", "one") },
+		"has max < min":           func() { b.Int("i", 2, 1) },
+		"has no effect function":  func() { b.Event("ev").Add() },
+		"has no check function":   func() { b.Invariant("inv").Add() },
+	} {
+		func() {
+			defer func() {
+				msg, _ := recover().(string)
+				if !strings.Contains(msg, name) {
+					t.Errorf("recover = %q, want a panic containing %q", msg, name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
@@ -0,0 +1,92 @@
+package gsm
+
+import "fmt"
+
+// ExportOption configures Export.
+type ExportOption func(*exportConfig)
+
+type exportConfig struct {
+	compress bool
+}
+
+// CompressExport makes Export run-length encode the step table. Many rows
+// are mostly self-transitions (an event that is a no-op in most states) or
+// constant, and both collapse to a handful of runs. Load decodes the
+// result to tables identical to the original. The normal-form table is
+// left as is.
+//
+// Each row is written under "step_rle" as a list of [count, start, delta]
+// runs, expanding to start, start+delta, ..., count entries in all, and
+// "step_encoding" is set to "rle". Foreign runtimes must decode the runs
+// before indexing. The export keeps format version 1 and omits "step", so
+// a reader that predates step_rle sees no step table rather than a version
+// it rejects; only hand compressed exports to readers that know step_rle.
+func CompressExport() ExportOption {
+	return func(c *exportConfig) { c.compress = true }
+}
+
+// encodeRLE encodes a table row as arithmetic runs: maximal stretches where
+// each entry differs from the previous by the same delta.
+func encodeRLE(row []uint64) [][3]int64 {
+	var runs [][3]int64
+	for i := 0; i < len(row); {
+		start := int64(row[i])
+		var delta int64
+		n := 1
+		if i+1 < len(row) {
+			delta = int64(row[i+1]) - start
+			n = 2
+			for i+n < len(row) && int64(row[i+n])-int64(row[i+n-1]) == delta {
+				n++
+			}
+		}
+		runs = append(runs, [3]int64{int64(n), start, delta})
+		i += n
+	}
+	return runs
+}
+
+// decodeRLE expands runs written by encodeRLE, rejecting rows that do not
+// decode to exactly want entries or contain negative values.
+func decodeRLE(runs [][3]int64, want int) ([]uint64, error) {
+	row := make([]uint64, 0, want)
+	for _, run := range runs {
+		count, v, delta := run[0], run[1], run[2]
+		if count <= 0 || int64(len(row))+count > int64(want) {
+			return nil, fmt.Errorf("run length %d overflows row of %d entries", count, want)
+		}
+		for k := int64(0); k < count; k++ {
+			if v < 0 {
+				return nil, fmt.Errorf("negative entry %d", v)
+			}
+			row = append(row, uint64(v))
+			v += delta
+		}
+	}
+	if len(row) != want {
+		return nil, fmt.Errorf("row decodes to %d entries, want %d", len(row), want)
+	}
+	return row, nil
+}
+
+// decodeStep fills ex.Step from ex.StepRLE for compressed exports. Rows
+// are decoded to the length of the nf table.
+func (ex *exportFormat) decodeStep() error {
+	switch ex.StepEncoding {
+	case "":
+		return nil
+	case "rle":
+	default:
+		return fmt.Errorf("gsm: unknown step encoding %q", ex.StepEncoding)
+	}
+	ex.Step = make([][]uint64, len(ex.StepRLE))
+	for ei, runs := range ex.StepRLE {
+		row, err := decodeRLE(runs, len(ex.NF))
+		if err != nil {
+			return fmt.Errorf("gsm: step row %d: %w", ei, err)
+		}
+		ex.Step[ei] = row
+	}
+	ex.StepRLE = nil
+	return nil
+}
@@ -0,0 +1,119 @@
+package gsm_test
+
+import (
+	"encoding/json"
+	"os"
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+// buildSparseMachine builds a 10-bit machine whose events are no-ops in
+// most states, so most step rows are long identity runs.
+func buildSparseMachine(tb testing.TB) *gsm.Machine {
+	tb.Helper()
+	b := gsm.NewRegistry("sparse")
+	level := b.Int("level", 0, 255)
+	alarm := b.Bool("alarm")
+	muted := b.Bool("muted")
+
+	b.Event("trip").
+		Writes(alarm).
+		Guard(func(s gsm.State) bool { return s.GetInt(level) == 255 }).
+		Apply(func(s gsm.State) gsm.State { return s.SetBool(alarm, true) }).
+		Add()
+	b.Event("mute").
+		Writes(muted).
+		Guard(func(s gsm.State) bool { return s.GetBool(alarm) }).
+		Apply(func(s gsm.State) gsm.State { return s.SetBool(muted, true) }).
+		Add()
+	b.Event("reset").
+		Writes(level, alarm, muted).
+		Apply(func(s gsm.State) gsm.State {
+			return s.SetInt(level, 0).SetBool(alarm, false).SetBool(muted, false)
+		}).
+		Add()
+	b.OnlyDeclaredPairs()
+
+	m, report, err := b.Build()
+	if err != nil {
+		tb.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	return m
+}
+
+func exportSize(tb testing.TB, m *gsm.Machine, path string, opts ...gsm.ExportOption) int64 {
+	tb.Helper()
+	if err := m.Export(path, opts...); err != nil {
+		tb.Fatalf("Export failed: %v", err)
+	}
+	info, err := os.Stat(path)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	return info.Size()
+}
+
+func TestCompressExportRoundTrip(t *testing.T) {
+	for name, m := range map[string]*gsm.Machine{
+		"sparse": buildSparseMachine(t),
+		"order":  func() *gsm.Machine { m, _ := buildOrderMachine(t); return m }(),
+	} {
+		t.Run(name, func(t *testing.T) {
+			dir := t.TempDir()
+			plain := exportSize(t, m, dir+"/plain.json")
+			packed := exportSize(t, m, dir+"/rle.json", gsm.CompressExport())
+			t.Logf("plain %d bytes, rle %d bytes", plain, packed)
+
+			loaded, err := gsm.Load(dir + "/rle.json")
+			if err != nil {
+				t.Fatalf("Load failed: %v", err)
+			}
+			// Re-exporting the loaded machine uncompressed reproduces the
+			// original tables byte for byte.
+			exportSize(t, loaded, dir+"/again.json")
+			tables := func(path string) (string, string) {
+				data, err := os.ReadFile(path)
+				if err != nil {
+					t.Fatal(err)
+				}
+				var ex map[string]json.RawMessage
+				if err := json.Unmarshal(data, &ex); err != nil {
+					t.Fatal(err)
+				}
+				return string(ex["nf"]), string(ex["step"])
+			}
+			nf1, step1 := tables(dir + "/plain.json")
+			nf2, step2 := tables(dir + "/again.json")
+			if nf1 != nf2 || step1 != step2 {
+				t.Fatal("tables changed across a compressed round trip")
+			}
+			if ok, diff := loaded.Equivalent(m, nil, nil); !ok {
+				t.Fatalf("round trip changed behavior: %s", diff)
+			}
+		})
+	}
+
+	m := buildSparseMachine(t)
+	dir := t.TempDir()
+	if plain, packed := exportSize(t, m, dir+"/a.json"), exportSize(t, m, dir+"/b.json", gsm.CompressExport()); packed*2 > plain {
+		t.Errorf("expected RLE to at least halve a sparse export: %d vs %d bytes", packed, plain)
+	}
+}
+
+func BenchmarkExportSize(b *testing.B) {
+	m := buildSparseMachine(b)
+	path := b.TempDir() + "/m.json"
+	for name, opts := range map[string][]gsm.ExportOption{
+		"plain": nil,
+		"rle":   {gsm.CompressExport()},
+	} {
+		b.Run(name, func(b *testing.B) {
+			var size int64
+			for i := 0; i < b.N; i++ {
+				size = exportSize(b, m, path, opts...)
+			}
+			b.ReportMetric(float64(size), "bytes")
+		})
+	}
+}
@@ -0,0 +1,96 @@
+package gsm
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Coverage records which reachable states and transitions a set of event
+// sequences exercises. Create one with Machine.NewCoverage, drive it with
+// Apply in place of Machine.Apply, and read the totals with Report. A
+// Coverage is safe for concurrent use.
+type Coverage struct {
+	m           *Machine
+	mu          sync.Mutex
+	states      map[uint64]bool
+	transitions map[transition]bool
+}
+
+type transition struct {
+	from  uint64
+	event int
+}
+
+// CoverageStats summarizes a Coverage. A transition is a (state, event)
+// pair with the state reachable from NewState(), so TransitionsTotal is
+// ReachableTotal times the number of events; pairs whose guard is disabled
+// count too. States and transitions outside the reachable set are not
+// counted.
+type CoverageStats struct {
+	StatesVisited    int
+	ReachableTotal   int
+	TransitionsUsed  int
+	TransitionsTotal int
+}
+
+// String formats the stats as percentages.
+func (c CoverageStats) String() string {
+	pct := func(n, total int) float64 {
+		if total == 0 {
+			return 0
+		}
+		return 100 * float64(n) / float64(total)
+	}
+	return fmt.Sprintf("states %d/%d (%.1f%%), transitions %d/%d (%.1f%%)",
+		c.StatesVisited, c.ReachableTotal, pct(c.StatesVisited, c.ReachableTotal),
+		c.TransitionsUsed, c.TransitionsTotal, pct(c.TransitionsUsed, c.TransitionsTotal))
+}
+
+// NewCoverage returns an empty coverage tracker for m.
+func (m *Machine) NewCoverage() *Coverage {
+	return &Coverage{
+		m:           m,
+		states:      make(map[uint64]bool),
+		transitions: make(map[transition]bool),
+	}
+}
+
+// Apply is Machine.Apply that also records s, the result, and the
+// transition between them. Panics if the event name is unknown.
+func (c *Coverage) Apply(s State, event string) State {
+	ei, ok := c.m.events[event]
+	if !ok {
+		panic(fmt.Sprintf("gsm: unknown event %q", event))
+	}
+	next := c.m.step[ei][s.packed]
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.states[s.packed] = true
+	c.states[next] = true
+	c.transitions[transition{from: s.packed, event: ei}] = true
+	return State{packed: next, vars: c.m.vars}
+}
+
+// Report returns the coverage recorded so far.
+func (c *Coverage) Report() CoverageStats {
+	r := c.m.explore()
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	stats := CoverageStats{
+		ReachableTotal:   len(r.order),
+		TransitionsTotal: len(r.order) * len(c.m.step),
+	}
+	for id := range c.states {
+		if r.seen.has(id) {
+			stats.StatesVisited++
+		}
+	}
+	for tr := range c.transitions {
+		if r.seen.has(tr.from) {
+			stats.TransitionsUsed++
+		}
+	}
+	return stats
+}
@@ -0,0 +1,38 @@
+package gsm_test
+
+import "testing"
+
+func TestCoverage(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	cov := m.NewCoverage()
+
+	if got := cov.Report(); got.StatesVisited != 0 || got.TransitionsUsed != 0 {
+		t.Fatalf("expected empty coverage, got %s", got)
+	}
+
+	s := m.NewState()
+	for _, ev := range []string{"restock", "process_payment", "ship_item"} {
+		next := cov.Apply(s, ev)
+		if next.ID() != m.Apply(s, ev).ID() {
+			t.Fatalf("Coverage.Apply(%s) differs from Machine.Apply", ev)
+		}
+		s = next
+	}
+	// Repeating a transition does not count twice.
+	cov.Apply(m.NewState(), "restock")
+
+	got := cov.Report()
+	t.Log(got)
+	if got.ReachableTotal != 30 {
+		t.Errorf("ReachableTotal = %d, want 30", got.ReachableTotal)
+	}
+	if got.TransitionsTotal != 30*len(m.Events()) {
+		t.Errorf("TransitionsTotal = %d, want %d", got.TransitionsTotal, 30*len(m.Events()))
+	}
+	if got.StatesVisited != 4 {
+		t.Errorf("StatesVisited = %d, want 4", got.StatesVisited)
+	}
+	if got.TransitionsUsed != 3 {
+		t.Errorf("TransitionsUsed = %d, want 3", got.TransitionsUsed)
+	}
+}
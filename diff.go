@@ -0,0 +1,176 @@
+package gsm
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"slices"
+	"strings"
+)
+
+// ExportDiff describes the differences between two exported machines, as
+// produced by DiffExports. Names are listed in the order they appear in
+// the export that contains them.
+type ExportDiff struct {
+	NameA, NameB string
+
+	VarsAdded   []string // in b only
+	VarsRemoved []string // in a only
+	VarsChanged []string // in both, with a different kind, labels, or range
+
+	EventsAdded   []string
+	EventsRemoved []string
+
+	// Verification lists changed verification fields, one per entry, as
+	// "field: old → new".
+	Verification []string
+
+	// TablesComparable is true when both exports have the same variable
+	// layout (same variables, in the same order, with the same domains), so
+	// state IDs mean the same thing in both. The counts below are only
+	// meaningful then.
+	TablesComparable bool
+	InitialChanged   bool
+	NFChanged        int // nf entries that differ
+	StepChanged      int // step entries that differ, over events in both
+}
+
+// Empty reports whether the exports describe the same machine. Export
+// timestamps are ignored.
+func (d *ExportDiff) Empty() bool {
+	return len(d.VarsAdded) == 0 && len(d.VarsRemoved) == 0 && len(d.VarsChanged) == 0 &&
+		len(d.EventsAdded) == 0 && len(d.EventsRemoved) == 0 && len(d.Verification) == 0 &&
+		d.TablesComparable && !d.InitialChanged && d.NFChanged == 0 && d.StepChanged == 0
+}
+
+// String returns a human-readable summary, suitable for code review.
+func (d *ExportDiff) String() string {
+	var b strings.Builder
+	fmt.Fprintf(&b, "Diff %s → %s\n", d.NameA, d.NameB)
+	if d.Empty() {
+		b.WriteString("  no differences\n")
+		return b.String()
+	}
+	list := func(label string, names []string) {
+		if len(names) > 0 {
+			fmt.Fprintf(&b, "  %s: %s\n", label, strings.Join(names, ", "))
+		}
+	}
+	list("Vars added", d.VarsAdded)
+	list("Vars removed", d.VarsRemoved)
+	list("Vars changed", d.VarsChanged)
+	list("Events added", d.EventsAdded)
+	list("Events removed", d.EventsRemoved)
+	for _, v := range d.Verification {
+		fmt.Fprintf(&b, "  Verification %s\n", v)
+	}
+	if !d.TablesComparable {
+		b.WriteString("  Tables: not comparable (variable layout changed)\n")
+		return b.String()
+	}
+	if d.InitialChanged {
+		b.WriteString("  Initial state changed\n")
+	}
+	fmt.Fprintf(&b, "  Tables: %d nf entries, %d step entries changed\n", d.NFChanged, d.StepChanged)
+	return b.String()
+}
+
+// DiffExports compares two machines in the format written by Export. It
+// operates purely on the export format, so neither machine needs to be
+// loadable or buildable in the current tree.
+func DiffExports(a, b io.Reader) (*ExportDiff, error) {
+	var ea, eb exportFormat
+	for _, in := range []struct {
+		r  io.Reader
+		ex *exportFormat
+	}{{a, &ea}, {b, &eb}} {
+		if err := json.NewDecoder(in.r).Decode(in.ex); err != nil {
+			return nil, fmt.Errorf("gsm: unmarshal failed: %w", err)
+		}
+		if in.ex.Version != formatVersion {
+			return nil, fmt.Errorf("gsm: unsupported export version %d", in.ex.Version)
+		}
+		if err := in.ex.decodeStep(); err != nil {
+			return nil, err
+		}
+	}
+
+	d := &ExportDiff{NameA: ea.Name, NameB: eb.Name}
+
+	varsA := make(map[string]varExport)
+	for _, v := range ea.Vars {
+		varsA[v.Name] = v
+	}
+	varsB := make(map[string]varExport)
+	for _, v := range eb.Vars {
+		varsB[v.Name] = v
+		if va, ok := varsA[v.Name]; !ok {
+			d.VarsAdded = append(d.VarsAdded, v.Name)
+		} else if !sameVar(va, v) {
+			d.VarsChanged = append(d.VarsChanged, v.Name)
+		}
+	}
+	for _, v := range ea.Vars {
+		if _, ok := varsB[v.Name]; !ok {
+			d.VarsRemoved = append(d.VarsRemoved, v.Name)
+		}
+	}
+
+	for _, name := range eb.Events {
+		if !slices.Contains(ea.Events, name) {
+			d.EventsAdded = append(d.EventsAdded, name)
+		}
+	}
+	for _, name := range ea.Events {
+		if !slices.Contains(eb.Events, name) {
+			d.EventsRemoved = append(d.EventsRemoved, name)
+		}
+	}
+
+	va, vb := ea.Verification, eb.Verification
+	changed := func(field string, x, y any) {
+		if x != y {
+			d.Verification = append(d.Verification, fmt.Sprintf("%s: %v → %v", field, x, y))
+		}
+	}
+	changed("wfc", va.WFC, vb.WFC)
+	changed("cc", va.CC, vb.CC)
+	changed("max_repair_depth", va.MaxRepairLen, vb.MaxRepairLen)
+	changed("state_count", va.StateCount, vb.StateCount)
+	changed("event_count", va.EventCount, vb.EventCount)
+
+	d.TablesComparable = len(ea.Vars) == len(eb.Vars) && len(ea.NF) == len(eb.NF)
+	for i := 0; d.TablesComparable && i < len(ea.Vars); i++ {
+		d.TablesComparable = sameVar(ea.Vars[i], eb.Vars[i])
+	}
+	if !d.TablesComparable {
+		return d, nil
+	}
+
+	d.InitialChanged = ea.Initial != eb.Initial
+	for i := range ea.NF {
+		if ea.NF[i] != eb.NF[i] {
+			d.NFChanged++
+		}
+	}
+	for ai, name := range ea.Events {
+		bi := slices.Index(eb.Events, name)
+		if bi < 0 || ai >= len(ea.Step) || bi >= len(eb.Step) {
+			continue
+		}
+		rowA, rowB := ea.Step[ai], eb.Step[bi]
+		for i := 0; i < len(rowA) && i < len(rowB); i++ {
+			if rowA[i] != rowB[i] {
+				d.StepChanged++
+			}
+		}
+	}
+	return d, nil
+}
+
+// sameVar reports whether two exported variables have the same name, kind,
+// and domain.
+func sameVar(a, b varExport) bool {
+	return a.Name == b.Name && a.Kind == b.Kind && a.Min == b.Min && a.Max == b.Max &&
+		slices.Equal(a.Labels, b.Labels) && slices.Equal(a.Values, b.Values)
+}
@@ -0,0 +1,77 @@
+package gsm_test
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"strings"
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+func exportBytes(t *testing.T, m *gsm.Machine) []byte {
+	t.Helper()
+	path := t.TempDir() + "/m.gsm.json"
+	if err := m.Export(path); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestDiffExports(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	base := exportBytes(t, m)
+
+	d, err := gsm.DiffExports(bytes.NewReader(base), bytes.NewReader(exportBytes(t, m)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !d.Empty() {
+		t.Fatalf("re-export of the same machine differs:\n%s", d)
+	}
+
+	r := newOrderRegistry()
+	r.RemoveEvent("cancel_order")
+	smaller, report, err := r.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	d, err = gsm.DiffExports(bytes.NewReader(base), bytes.NewReader(exportBytes(t, smaller)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(d)
+	if !slices.Equal(d.EventsRemoved, []string{"cancel_order"}) || len(d.EventsAdded) != 0 {
+		t.Errorf("events removed %v, added %v", d.EventsRemoved, d.EventsAdded)
+	}
+	if !slices.Contains(d.Verification, "event_count: 5 → 4") {
+		t.Errorf("expected event_count change, got %v", d.Verification)
+	}
+	if !d.TablesComparable || d.NFChanged != 0 || d.StepChanged != 0 {
+		t.Errorf("shared tables should be unchanged: %+v", d)
+	}
+
+	light, report, err := newLightRegistry().Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	d, err = gsm.DiffExports(bytes.NewReader(base), bytes.NewReader(exportBytes(t, light)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if d.TablesComparable || len(d.VarsRemoved) != 3 || len(d.VarsAdded) == 0 {
+		t.Errorf("unrelated machines: %+v", d)
+	}
+	if !strings.Contains(d.String(), "not comparable") {
+		t.Errorf("summary should say tables are not comparable:\n%s", d)
+	}
+
+	if _, err := gsm.DiffExports(strings.NewReader("{"), bytes.NewReader(base)); err == nil {
+		t.Error("expected error for malformed input")
+	}
+}
@@ -0,0 +1,108 @@
+package gsm
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// DOTOption configures WriteDOT and WriteDOTClustered.
+type DOTOption func(*dotConfig)
+
+type dotConfig struct {
+	compensation bool
+}
+
+// ShowCompensation draws transitions whose raw effect violated an
+// invariant, so that repair produced the target, as dashed red edges
+// labelled "event (compensated)". Machines from Load do not record which
+// transitions compensated, so their edges are all drawn plain.
+func ShowCompensation() DOTOption {
+	return func(c *dotConfig) { c.compensation = true }
+}
+
+// WriteDOT writes the reachable state graph in Graphviz DOT format. Each
+// reachable state is a node, with the initial state drawn with a double
+// border, and each transition that changes the state is an edge labelled
+// with its event. Self-loops (guard-blocked or no-op events) are omitted.
+func (m *Machine) WriteDOT(w io.Writer, opts ...DOTOption) error {
+	return m.writeDOT(w, nil, opts)
+}
+
+// WriteDOTClustered is WriteDOT with the states grouped into one subgraph
+// per value of the enum variable groupVar, so the dominant dimension of a
+// large diagram is visible at a glance. Edges between clusters are drawn
+// as usual. It returns an error if groupVar is not an enum variable of m.
+func (m *Machine) WriteDOTClustered(w io.Writer, groupVar Var, opts ...DOTOption) error {
+	if err := m.NewState().ownsVar(groupVar); err != nil {
+		return err
+	}
+	if groupVar.kind != EnumKind {
+		return fmt.Errorf("gsm: WriteDOTClustered: %q is not an enum variable", groupVar.name)
+	}
+	return m.writeDOT(w, &groupVar, opts)
+}
+
+// writeDOT renders the graph, clustered by group if it is non-nil.
+func (m *Machine) writeDOT(w io.Writer, group *Var, opts []DOTOption) error {
+	var cfg dotConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	order := m.explore().order
+	names := m.Events()
+	var b strings.Builder
+
+	node := func(indent string, id uint64) {
+		s := State{packed: id, vars: m.vars}
+		label := strings.TrimSuffix(strings.TrimPrefix(s.String(), "{"), "}")
+		attrs := fmt.Sprintf("label=%q", label)
+		if id == m.initial {
+			attrs += ", peripheries=2"
+		}
+		fmt.Fprintf(&b, "%ss%d [%s];\n", indent, id, attrs)
+	}
+
+	fmt.Fprintf(&b, "digraph %q {\n", m.name)
+	b.WriteString("  rankdir=LR;\n")
+	b.WriteString("  node [shape=box];\n")
+	if group == nil {
+		for _, id := range order {
+			node("  ", id)
+		}
+	} else {
+		members := make([][]uint64, group.domain)
+		for _, id := range order {
+			raw := State{packed: id, vars: m.vars}.getRaw(*group)
+			members[raw] = append(members[raw], id)
+		}
+		for k, ids := range members {
+			if len(ids) == 0 {
+				continue
+			}
+			fmt.Fprintf(&b, "  subgraph %q {\n", fmt.Sprintf("cluster_%s_%s", group.name, group.labels[k]))
+			fmt.Fprintf(&b, "    label=%q;\n", fmt.Sprintf("%s=%s", group.name, group.labels[k]))
+			for _, id := range ids {
+				node("    ", id)
+			}
+			b.WriteString("  }\n")
+		}
+	}
+	for _, id := range order {
+		for ei := range m.step {
+			next := m.step[ei][id]
+			if next == id {
+				continue
+			}
+			attrs := fmt.Sprintf("label=%q", names[ei])
+			if cfg.compensation && m.compensated != nil && m.compensated[ei].has(id) {
+				attrs = fmt.Sprintf("label=%q, style=dashed, color=red", names[ei]+" (compensated)")
+			}
+			fmt.Fprintf(&b, "  s%d -> s%d [%s];\n", id, next, attrs)
+		}
+	}
+	b.WriteString("}\n")
+
+	_, err := io.WriteString(w, b.String())
+	return err
+}
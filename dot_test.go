@@ -0,0 +1,117 @@
+package gsm_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+func TestWriteDOT(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	var b strings.Builder
+	if err := m.WriteDOT(&b); err != nil {
+		t.Fatalf("WriteDOT: %v", err)
+	}
+	dot := b.String()
+
+	if !strings.HasPrefix(dot, `digraph "order_fulfillment" {`) {
+		t.Errorf("unexpected header:\n%s", dot)
+	}
+	if got, want := strings.Count(dot, "shape=box"), 1; got != want {
+		t.Errorf("node defaults declared %d times, want %d", got, want)
+	}
+	if got, want := strings.Count(dot, "label=\"status="), len(m.ReachableStates()); got != want {
+		t.Errorf("got %d state nodes, want %d", got, want)
+	}
+	if strings.Count(dot, "peripheries=2") != 1 {
+		t.Error("initial state should be marked exactly once")
+	}
+	if !strings.Contains(dot, `[label="process_payment"]`) {
+		t.Error("missing process_payment edge")
+	}
+	if strings.Contains(dot, "subgraph") {
+		t.Error("unclustered output should have no subgraphs")
+	}
+}
+
+func TestWriteDOTClustered(t *testing.T) {
+	b := gsm.NewRegistry("clustered")
+	status := b.Enum("status", "pending", "paid", "shipped")
+	flag := b.Bool("flag")
+	b.Event("pay").
+		Writes(status).
+		Guard(func(s gsm.State) bool { return s.Get(status) == "pending" }).
+		Apply(func(s gsm.State) gsm.State { return s.Set(status, "paid") }).
+		Add()
+	b.Event("toggle").
+		Writes(flag).
+		Apply(func(s gsm.State) gsm.State { return s.SetBool(flag, !s.GetBool(flag)) }).
+		Add()
+	m, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+
+	var out strings.Builder
+	if err := m.WriteDOTClustered(&out, status); err != nil {
+		t.Fatalf("WriteDOTClustered: %v", err)
+	}
+	dot := out.String()
+	for _, want := range []string{`subgraph "cluster_status_pending"`, `subgraph "cluster_status_paid"`, `label="status=paid";`} {
+		if !strings.Contains(dot, want) {
+			t.Errorf("missing %s in:\n%s", want, dot)
+		}
+	}
+	// shipped is unreachable, so it gets no cluster.
+	if strings.Contains(dot, "cluster_status_shipped") {
+		t.Errorf("empty cluster emitted:\n%s", dot)
+	}
+	// pay crosses from the pending cluster to the paid one.
+	if got := strings.Count(dot, `[label="pay"]`); got != 2 {
+		t.Errorf("got %d pay edges, want 2", got)
+	}
+
+	if err := m.WriteDOTClustered(&out, flag); err == nil {
+		t.Error("expected an error clustering by a bool variable")
+	}
+}
+
+func TestWriteDOTShowCompensation(t *testing.T) {
+	b := gsm.NewRegistry("wrap")
+	x := b.Int("x", 0, 3)
+	b.Invariant("x_small").
+		Watches(x).
+		Holds(func(s gsm.State) bool { return s.GetInt(x) <= 2 }).
+		Repair(func(s gsm.State) gsm.State { return s.SetInt(x, 0) }).
+		Add()
+	b.Event("inc").
+		Writes(x).
+		Apply(func(s gsm.State) gsm.State { return s.SetInt(x, s.GetInt(x)+1) }).
+		Add()
+	m, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+
+	var out strings.Builder
+	if err := m.WriteDOT(&out, gsm.ShowCompensation()); err != nil {
+		t.Fatalf("WriteDOT: %v", err)
+	}
+	dot := out.String()
+	// 0 → 1 → 2 are clean; 2 → 3 is repaired back to 0.
+	if got := strings.Count(dot, `[label="inc"]`); got != 2 {
+		t.Errorf("got %d clean edges, want 2:\n%s", got, dot)
+	}
+	if !strings.Contains(dot, `s2 -> s0 [label="inc (compensated)", style=dashed, color=red];`) {
+		t.Errorf("missing compensated edge:\n%s", dot)
+	}
+
+	out.Reset()
+	if err := m.WriteDOT(&out); err != nil {
+		t.Fatalf("WriteDOT: %v", err)
+	}
+	if strings.Contains(out.String(), "compensated") {
+		t.Errorf("compensation drawn without ShowCompensation:\n%s", out.String())
+	}
+}
@@ -0,0 +1,122 @@
+package gsm
+
+import (
+	"fmt"
+	"slices"
+)
+
+// Equivalent reports whether other has the same reachable behavior as m
+// under the given renamings. eventMap and varMap map names in m to names in
+// other; names missing from a map (or a nil map) are assumed unchanged.
+//
+// Variables are matched by name, so they may be declared in a different
+// order. Matched variables must have the same kind and domain; enum labels
+// are matched by name, so reordering labels is allowed. The machines are
+// then explored in lockstep from their initial states, and every reachable
+// transition of m must land on the translated state in other.
+//
+// On mismatch, the returned string describes the first difference found.
+func (m *Machine) Equivalent(other *Machine, eventMap, varMap map[string]string) (bool, string) {
+	rename := func(mp map[string]string, name string) string {
+		if to, ok := mp[name]; ok {
+			return to
+		}
+		return name
+	}
+
+	// Match variables and build per-variable raw value translations.
+	if len(m.vars) != len(other.vars) {
+		return false, fmt.Sprintf("variable count differs: %d vs %d", len(m.vars), len(other.vars))
+	}
+	type varMatch struct {
+		from, to Var
+		raw      []uint64 // raw value in m → raw value in other
+	}
+	matches := make([]varMatch, len(m.vars))
+	used := make(map[int]bool)
+	for i, v := range m.vars {
+		name := rename(varMap, v.name)
+		oi := -1
+		for j, ov := range other.vars {
+			if ov.name == name {
+				oi = j
+				break
+			}
+		}
+		if oi < 0 {
+			return false, fmt.Sprintf("variable %q (as %q) not found in %s", v.name, name, other.name)
+		}
+		if used[oi] {
+			return false, fmt.Sprintf("variable %q mapped twice", name)
+		}
+		used[oi] = true
+		ov := other.vars[oi]
+		if v.kind != ov.kind || v.domain != ov.domain || v.min != ov.min || !slices.Equal(v.values, ov.values) {
+			return false, fmt.Sprintf("variable %q and %q have different types or domains", v.name, ov.name)
+		}
+		raw := make([]uint64, v.domain)
+		for k := range raw {
+			raw[k] = uint64(k)
+		}
+		if v.kind == EnumKind {
+			for k, label := range v.labels {
+				idx, err := ov.enumIndex(label)
+				if err != nil {
+					return false, fmt.Sprintf("enum %q label %q missing from %q", v.name, label, ov.name)
+				}
+				raw[k] = uint64(idx)
+			}
+		}
+		matches[i] = varMatch{from: v, to: ov, raw: raw}
+	}
+
+	translate := func(id uint64) uint64 {
+		src := State{packed: id, vars: m.vars}
+		dst := State{packed: 0, vars: other.vars}
+		for _, vm := range matches {
+			dst = dst.setRaw(vm.to, vm.raw[src.getRaw(vm.from)])
+		}
+		return dst.packed
+	}
+
+	// Match events.
+	if len(m.events) != len(other.events) {
+		return false, fmt.Sprintf("event count differs: %d vs %d", len(m.events), len(other.events))
+	}
+	names := m.Events()
+	eventPairs := make([][2]int, 0, len(m.events))
+	seenEvents := make(map[int]bool)
+	for _, name := range names {
+		oname := rename(eventMap, name)
+		oi, ok := other.events[oname]
+		if !ok {
+			return false, fmt.Sprintf("event %q (as %q) not found in %s", name, oname, other.name)
+		}
+		if seenEvents[oi] {
+			return false, fmt.Sprintf("event %q mapped twice", oname)
+		}
+		seenEvents[oi] = true
+		eventPairs = append(eventPairs, [2]int{m.events[name], oi})
+	}
+
+	// Explore reachable states in lockstep.
+	mkState := func(id uint64) State { return State{packed: id, vars: m.vars} }
+	if translate(m.initial) != other.initial {
+		return false, fmt.Sprintf("initial states differ: %s vs %s",
+			mkState(m.initial), State{packed: other.initial, vars: other.vars})
+	}
+	for _, id := range m.explore().order {
+		oid := translate(id)
+		for _, ep := range eventPairs {
+			got := other.step[ep[1]][oid]
+			want := translate(m.step[ep[0]][id])
+			if got != want {
+				return false, fmt.Sprintf("from %s, event %q leads to %s in %s but %s in %s",
+					mkState(id), names[ep[0]],
+					mkState(m.step[ep[0]][id]), m.name,
+					State{packed: got, vars: other.vars}, other.name)
+			}
+		}
+	}
+	return true, ""
+}
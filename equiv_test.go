@@ -0,0 +1,123 @@
+package gsm_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+// buildRefactoredOrderMachine declares the order machine with variables in a
+// different order, status labels reordered, and restock renamed. If
+// guardedCancel is false, cancel_order loses its guard, changing behavior.
+func buildRefactoredOrderMachine(t *testing.T, guardedCancel bool) *gsm.Machine {
+	t.Helper()
+
+	b := gsm.NewRegistry("order_fulfillment_v2")
+
+	stock := b.Int("stock", 0, 5)
+	paid := b.Bool("paid")
+	status := b.Enum("status", "paid", "pending", "cancelled", "shipped")
+
+	b.Invariant("no_ship_unpaid").
+		Watches(status, paid).
+		Holds(func(s gsm.State) bool {
+			return s.Get(status) != "shipped" || s.GetBool(paid)
+		}).
+		Repair(func(s gsm.State) gsm.State {
+			return s.Set(status, "pending")
+		}).
+		Add()
+
+	b.Invariant("stock_non_negative").
+		Watches(stock).
+		Holds(func(s gsm.State) bool { return s.GetInt(stock) >= 0 }).
+		Repair(func(s gsm.State) gsm.State { return s.SetInt(stock, 0) }).
+		Add()
+
+	b.Event("place_order").
+		Writes(status, paid).
+		Apply(func(s gsm.State) gsm.State {
+			return s.Set(status, "pending").SetBool(paid, false)
+		}).
+		Add()
+
+	b.Event("process_payment").
+		Writes(status, paid).
+		Guard(func(s gsm.State) bool { return s.Get(status) == "pending" }).
+		Apply(func(s gsm.State) gsm.State {
+			return s.Set(status, "paid").SetBool(paid, true)
+		}).
+		Add()
+
+	b.Event("ship_item").
+		Writes(status, stock).
+		Guard(func(s gsm.State) bool {
+			return s.Get(status) == "paid" && s.GetInt(stock) > 0
+		}).
+		Apply(func(s gsm.State) gsm.State {
+			return s.Set(status, "shipped").SetInt(stock, s.GetInt(stock)-1)
+		}).
+		Add()
+
+	cancel := b.Event("cancel_order").Writes(status)
+	if guardedCancel {
+		cancel.Guard(func(s gsm.State) bool { return s.Get(status) != "shipped" })
+	}
+	cancel.Apply(func(s gsm.State) gsm.State {
+		return s.Set(status, "cancelled")
+	}).Add()
+
+	b.Event("replenish").
+		Writes(stock).
+		Apply(func(s gsm.State) gsm.State {
+			return s.SetInt(stock, s.GetInt(stock)+1)
+		}).
+		Add()
+
+	b.Independent("place_order", "replenish")
+
+	// Reordering labels changes what the zero state means.
+	b.InitialState(func(s gsm.State) gsm.State { return s.Set(status, "pending") })
+
+	m, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	return m
+}
+
+func TestEquivalentUnderRenaming(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	refactored := buildRefactoredOrderMachine(t, true)
+
+	eventMap := map[string]string{"restock": "replenish"}
+	varMap := map[string]string{"inventory": "stock"}
+
+	ok, diag := m.Equivalent(refactored, eventMap, varMap)
+	if !ok {
+		t.Fatalf("expected equivalence, got: %s", diag)
+	}
+
+	// Without the renaming, the event lookup fails.
+	ok, diag = m.Equivalent(refactored, nil, varMap)
+	if ok || !strings.Contains(diag, "restock") {
+		t.Fatalf("expected missing-event diagnostic, got ok=%v %q", ok, diag)
+	}
+}
+
+func TestEquivalentDetectsBehaviorChange(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	changed := buildRefactoredOrderMachine(t, false)
+
+	ok, diag := m.Equivalent(changed,
+		map[string]string{"restock": "replenish"},
+		map[string]string{"inventory": "stock"})
+	if ok {
+		t.Fatal("expected behavior change to be detected")
+	}
+	if !strings.Contains(diag, "cancel_order") {
+		t.Errorf("expected diagnostic to name cancel_order, got %q", diag)
+	}
+	t.Log(diag)
+}
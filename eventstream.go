@@ -0,0 +1,91 @@
+package gsm
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Stream applies events to a single entity's state from any number of
+// goroutines. Applications are serialized through one goroutine that owns
+// the state, so callers share no lock with each other beyond handing the
+// event over. Create one with Machine.NewStream and stop it with Close.
+//
+// Events sent from one goroutine are applied in the order sent. Events
+// from different goroutines are applied in the order the stream accepts
+// them, and each result reflects every event accepted before it.
+//
+// The stream tracks the last applied event and enforces RequiresPrev: an
+// event whose required predecessor did not fire directly before it is
+// rejected, leaving the state unchanged, and does not count as applied.
+type Stream struct {
+	m      *Machine
+	reqs   chan streamReq
+	done   chan struct{}
+	mu     sync.RWMutex // held for reading by Send, for writing by Close
+	closed bool
+	cur    uint64 // owned by run until done is closed
+	last   int    // index of the last applied event, -1 for none; owned by run
+}
+
+type streamReq struct {
+	ei  int
+	out chan State
+}
+
+// NewStream starts a Stream whose state begins at initial.
+func (m *Machine) NewStream(initial State) *Stream {
+	st := &Stream{
+		m:    m,
+		reqs: make(chan streamReq),
+		done: make(chan struct{}),
+		cur:  initial.packed,
+		last: -1,
+	}
+	go st.run()
+	return st
+}
+
+func (st *Stream) run() {
+	defer close(st.done)
+	for req := range st.reqs {
+		if st.m.allowedAfter(st.last, req.ei) {
+			st.cur = st.m.step[req.ei][st.cur]
+			st.last = req.ei
+		}
+		req.out <- State{packed: st.cur, vars: st.m.vars}
+	}
+}
+
+// Send queues an event and returns a channel that receives the resulting
+// state once it has been applied. Send blocks until the stream accepts the
+// event, which fixes its place in the order; the result channel is
+// buffered, so callers that do not need the state may ignore it. Panics if
+// the event name is unknown or the stream is closed.
+func (st *Stream) Send(event string) <-chan State {
+	ei, ok := st.m.events[event]
+	if !ok {
+		panic(fmt.Sprintf("gsm: unknown event %q", event))
+	}
+	out := make(chan State, 1)
+
+	st.mu.RLock()
+	defer st.mu.RUnlock()
+	if st.closed {
+		panic("gsm: Send on closed Stream")
+	}
+	st.reqs <- streamReq{ei: ei, out: out}
+	return out
+}
+
+// Close stops the stream after every accepted event has been applied and
+// returns the final state. Calling Close again returns the same state.
+func (st *Stream) Close() State {
+	st.mu.Lock()
+	if !st.closed {
+		st.closed = true
+		close(st.reqs)
+	}
+	st.mu.Unlock()
+	<-st.done
+	return State{packed: st.cur, vars: st.m.vars}
+}
@@ -0,0 +1,124 @@
+package gsm_test
+
+import (
+	"slices"
+	"sync"
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+func TestStream(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	st := m.NewStream(m.NewState())
+
+	seq := []string{"restock", "process_payment", "ship_item", "restock"}
+	want := m.NewState()
+	for _, ev := range seq {
+		want = m.Apply(want, ev)
+		if got := <-st.Send(ev); got.ID() != want.ID() {
+			t.Fatalf("after %s: got %s, want %s", ev, got, want)
+		}
+	}
+	if got := st.Close(); got.ID() != want.ID() {
+		t.Errorf("Close = %s, want %s", got, want)
+	}
+	if got := st.Close(); got.ID() != want.ID() {
+		t.Errorf("second Close = %s, want %s", got, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected Send on a closed stream to panic")
+		}
+	}()
+	st.Send("restock")
+}
+
+func TestStreamConcurrent(t *testing.T) {
+	const goroutines, perGoroutine = 8, 12
+	const total = goroutines * perGoroutine
+
+	b := gsm.NewRegistry("counters")
+	x := b.Int("x", 0, total)
+	y := b.Int("y", 0, total)
+	b.Event("inc_x").Writes(x).Apply(func(s gsm.State) gsm.State { return s.SetInt(x, s.GetInt(x)+1) }).Add()
+	b.Event("inc_y").Writes(y).Apply(func(s gsm.State) gsm.State { return s.SetInt(y, s.GetInt(y)+1) }).Add()
+	m, _, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	st := m.NewStream(m.NewState())
+	var (
+		wg   sync.WaitGroup
+		mu   sync.Mutex
+		seen []int // x after each inc_x
+	)
+	for g := 0; g < goroutines; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < perGoroutine; i++ {
+				if (g+i)%2 == 0 {
+					s := <-st.Send("inc_x")
+					mu.Lock()
+					seen = append(seen, s.GetInt(x))
+					mu.Unlock()
+				} else {
+					st.Send("inc_y")
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	final := st.Close()
+
+	// The events commute, so any serialization matches a sequential replay.
+	want := m.NewState()
+	for g := 0; g < goroutines; g++ {
+		for i := 0; i < perGoroutine; i++ {
+			ev := "inc_y"
+			if (g+i)%2 == 0 {
+				ev = "inc_x"
+			}
+			want = m.Apply(want, ev)
+		}
+	}
+	if final.ID() != want.ID() {
+		t.Fatalf("final state %s, want %s", final, want)
+	}
+
+	// No application was lost or duplicated: each inc_x saw a distinct count.
+	slices.Sort(seen)
+	for i, v := range seen {
+		if v != i+1 {
+			t.Fatalf("inc_x results %v are not 1..%d", seen, len(seen))
+		}
+	}
+}
+
+func TestStreamRequiresPrev(t *testing.T) {
+	m := buildArmedCounter(t)
+	count, _ := m.Var("count")
+	st := m.NewStream(m.NewState())
+
+	for _, step := range []struct {
+		event string
+		want  int
+	}{
+		{"fire", 0}, // no previous event
+		{"arm", 0},
+		{"fire", 1},
+		{"fire", 1}, // fire is not an allowed predecessor
+		{"arm", 1},
+		{"fire", 2},
+	} {
+		if got := (<-st.Send(step.event)).GetInt(count); got != step.want {
+			t.Errorf("after %s: count = %d, want %d", step.event, got, step.want)
+		}
+	}
+	if got := st.Close().GetInt(count); got != 2 {
+		t.Errorf("Close count = %d, want 2", got)
+	}
+}
@@ -0,0 +1,94 @@
+package gsm
+
+import "slices"
+
+// Explorer is a mutable cursor over a machine for interactive use, such as
+// a REPL or a demo: it holds a current state, the events applied to reach
+// it, and named save-points. Create one with Machine.NewExplorer. An
+// Explorer is not safe for concurrent use.
+type Explorer struct {
+	m       *Machine
+	cur     State
+	history []explorerStep
+	saves   map[string]explorerSave
+}
+
+type explorerStep struct {
+	event  string
+	before State
+}
+
+type explorerSave struct {
+	state   State
+	history []explorerStep
+}
+
+// NewExplorer returns an Explorer positioned at NewState() with an empty
+// history.
+func (m *Machine) NewExplorer() *Explorer {
+	return &Explorer{m: m, cur: m.NewState(), saves: make(map[string]explorerSave)}
+}
+
+// State returns the current state.
+func (e *Explorer) State() State { return e.cur }
+
+// Apply applies the event to the current state, records it in the
+// history, and returns the new current state. An event rejected by
+// RequiresPrev, because the last event in the history is not an allowed
+// predecessor, leaves the state and history unchanged. Panics if the event
+// name is unknown.
+func (e *Explorer) Apply(event string) State {
+	prev := ""
+	if len(e.history) > 0 {
+		prev = e.history[len(e.history)-1].event
+	}
+	if !e.m.AllowedAfter(prev, event) {
+		return e.cur
+	}
+	next := e.m.Apply(e.cur, event)
+	e.history = append(e.history, explorerStep{event: event, before: e.cur})
+	e.cur = next
+	return next
+}
+
+// Back undoes the most recent Apply, returning false if the history is
+// empty.
+func (e *Explorer) Back() bool {
+	if len(e.history) == 0 {
+		return false
+	}
+	last := e.history[len(e.history)-1]
+	e.history = e.history[:len(e.history)-1]
+	e.cur = last.before
+	return true
+}
+
+// History returns the events applied to reach the current state, oldest
+// first.
+func (e *Explorer) History() []string {
+	events := make([]string, len(e.history))
+	for i, h := range e.history {
+		events[i] = h.event
+	}
+	return events
+}
+
+// Save records the current state and history under label, replacing any
+// earlier save-point with the same label.
+func (e *Explorer) Save(label string) {
+	e.saves[label] = explorerSave{state: e.cur, history: slices.Clone(e.history)}
+}
+
+// Restore returns to the save-point recorded under label, including its
+// history, so Back continues from there. Work done since the save can be
+// kept by saving it under another label first. Returns false, leaving the
+// explorer unchanged, if no such save-point exists.
+func (e *Explorer) Restore(label string) bool {
+	sp, ok := e.saves[label]
+	if !ok {
+		return false
+	}
+	e.cur = sp.state
+	e.history = slices.Clone(sp.history)
+	return true
+}
@@ -0,0 +1,126 @@
+package gsm_test
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+func TestExplorer(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	e := m.NewExplorer()
+
+	if e.State().ID() != m.NewState().ID() || len(e.History()) != 0 {
+		t.Fatal("new explorer should start at NewState with no history")
+	}
+	if e.Back() {
+		t.Error("Back on an empty history should fail")
+	}
+
+	e.Apply("restock")
+	e.Save("stocked")
+	paid := e.Apply("process_payment")
+	shipped := e.Apply("ship_item")
+	if want := []string{"restock", "process_payment", "ship_item"}; !reflect.DeepEqual(e.History(), want) {
+		t.Errorf("History = %v, want %v", e.History(), want)
+	}
+
+	if !e.Back() || e.State().ID() != paid.ID() {
+		t.Errorf("Back should return to %s, got %s", paid, e.State())
+	}
+	if got := e.Apply("ship_item"); got.ID() != shipped.ID() {
+		t.Errorf("reapplying ship_item gave %s, want %s", got, shipped)
+	}
+
+	// Branch: restore the save-point and take a different path.
+	e.Save("shipped")
+	if !e.Restore("stocked") {
+		t.Fatal("Restore(stocked) failed")
+	}
+	if want := []string{"restock"}; !reflect.DeepEqual(e.History(), want) {
+		t.Errorf("restored History = %v, want %v", e.History(), want)
+	}
+	e.Apply("cancel_order")
+	status, _ := m.Var("status")
+	if got := e.State(); got.Get(status) != "cancelled" {
+		t.Errorf("expected cancelled branch, got %s", got)
+	}
+
+	if !e.Restore("shipped") || e.State().ID() != shipped.ID() || len(e.History()) != 3 {
+		t.Errorf("Restore(shipped) = %s with history %v", e.State(), e.History())
+	}
+	if e.Restore("missing") {
+		t.Error("Restore of an unknown label should fail")
+	}
+}
+
+// buildArmedCounter returns a machine whose "fire" event increments a
+// counter but may only run directly after "arm".
+func buildArmedCounter(t *testing.T) *gsm.Machine {
+	t.Helper()
+	b := gsm.NewRegistry("armed_counter")
+	count := b.Int("count", 0, 3)
+	b.Event("arm").
+		Apply(func(s gsm.State) gsm.State { return s }).
+		Add()
+	b.Event("fire").
+		RequiresPrev("arm").
+		Writes(count).
+		Guard(func(s gsm.State) bool { return s.GetInt(count) < 3 }).
+		Apply(func(s gsm.State) gsm.State { return s.SetInt(count, s.GetInt(count)+1) }).
+		Add()
+	m, _, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	return m
+}
+
+func TestRequiresPrev(t *testing.T) {
+	m := buildArmedCounter(t)
+	if m.AllowedAfter("", "fire") || m.AllowedAfter("fire", "fire") {
+		t.Error("fire should need arm directly before it")
+	}
+	if !m.AllowedAfter("arm", "fire") || !m.AllowedAfter("", "arm") {
+		t.Error("arm → fire and a leading arm should be allowed")
+	}
+	// Apply works on the tables alone and ignores precedence.
+	count, _ := m.Var("count")
+	if got := m.Apply(m.NewState(), "fire").GetInt(count); got != 1 {
+		t.Errorf("Apply(fire) count = %d, want 1", got)
+	}
+
+	b := gsm.NewRegistry("bad")
+	b.Bool("x")
+	b.Event("go").RequiresPrev("missing").Apply(func(s gsm.State) gsm.State { return s }).Add()
+	if _, _, err := b.Build(); err == nil || !strings.Contains(err.Error(), `requires unknown previous event "missing"`) {
+		t.Errorf("Build err = %v, want unknown previous event", err)
+	}
+}
+
+func TestExplorerRequiresPrev(t *testing.T) {
+	m := buildArmedCounter(t)
+	count, _ := m.Var("count")
+	e := m.NewExplorer()
+
+	if got := e.Apply("fire"); got.GetInt(count) != 0 || len(e.History()) != 0 {
+		t.Errorf("fire without arm: count %d, history %v; want rejected", got.GetInt(count), e.History())
+	}
+	e.Apply("arm")
+	if got := e.Apply("fire"); got.GetInt(count) != 1 {
+		t.Errorf("arm → fire count = %d, want 1", got.GetInt(count))
+	}
+	if got := e.Apply("fire"); got.GetInt(count) != 1 {
+		t.Errorf("fire → fire count = %d, want rejected at 1", got.GetInt(count))
+	}
+	if want := []string{"arm", "fire"}; !reflect.DeepEqual(e.History(), want) {
+		t.Errorf("History = %v, want %v", e.History(), want)
+	}
+	// Going back makes arm the last event again.
+	e.Back()
+	if got := e.Apply("fire"); got.GetInt(count) != 1 {
+		t.Errorf("fire after Back count = %d, want 1", got.GetInt(count))
+	}
+}
@@ -0,0 +1,28 @@
+package gsm
+
+// NewMachineFromTables builds a Machine from hand-specified tables over the
+// registry's variables and events, bypassing verification. Tests use it to
+// construct deliberately corrupt machines.
+func NewMachineFromTables(r *Registry, initial uint64, nf []uint64, step [][]uint64) *Machine {
+	m := &Machine{
+		name:       r.name,
+		vars:       r.vars,
+		events:     make(map[string]int),
+		step:       step,
+		nf:         nf,
+		invariants: r.invariants,
+		defs:       r.events,
+		initial:    initial,
+	}
+	for i, ev := range r.events {
+		m.events[ev.name] = i
+	}
+	return m
+}
+
+// SetProofs replaces a machine's verified pairs and enum groups, so tests
+// can encode machines whose metadata does not match their layout.
+func SetProofs(m *Machine, verified []VerifiedPair, groups map[int]map[string]uint64) {
+	m.verified = verified
+	m.groups = groups
+}
@@ -0,0 +1,150 @@
+package gsm
+
+import (
+	"bytes"
+	"encoding/gob"
+	"fmt"
+)
+
+// gobMachine is the wire form of a Machine for encoding/gob: everything
+// but the closures, which cannot be serialized.
+type gobMachine struct {
+	Version     int
+	Name        string
+	Vars        []varExport
+	Events      []string
+	Tags        [][]string
+	Initial     uint64
+	NF          []uint64
+	Step        [][]uint64
+	Compensated [][]uint64
+	Verified    []VerifiedPair
+	Groups      map[int]map[string]uint64
+	MaxRepair   int
+	ReachCount  int
+	LibVersion  string
+}
+
+// GobEncode implements gob.GobEncoder, so a Machine can be sent over
+// net/rpc or any gob stream without the JSON round-trip of Export. The
+// encoding carries the variable layout, the nf and step tables, event tags,
+// enum groups, which transitions compensated, the verified pairs, and the
+// Stats retained from Build.
+// Invariant and event closures are not encoded, so a decoded machine
+// behaves like one from Load: Apply, Normalize, and the table-based
+// analyses match the original, while diagnostics that run closures
+// (Check, ViolatedInvariants, ApplyWithHook callbacks) do not.
+func (m *Machine) GobEncode() ([]byte, error) {
+	g := gobMachine{
+		Version:    1,
+		Name:       m.name,
+		Vars:       newExport(m.name, m.vars, nil, nil, m.initial, nil).Vars,
+		Events:     m.Events(),
+		Tags:       m.tags,
+		Initial:    m.initial,
+		NF:         m.nf,
+		Step:       m.step,
+		Verified:   m.verified,
+		Groups:     m.groups,
+		MaxRepair:  m.maxRepair,
+		ReachCount: m.reachCount,
+		LibVersion: m.libVersion,
+	}
+	for _, c := range m.compensated {
+		g.Compensated = append(g.Compensated, c)
+	}
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(g); err != nil {
+		return nil, fmt.Errorf("gsm: gob encode failed: %w", err)
+	}
+	return buf.Bytes(), nil
+}
+
+// GobDecode implements gob.GobDecoder, replacing m with the machine in
+// data. The tables are checked as Load checks an export, including
+// Validate; verified pairs must name decoded events and enum groups must
+// belong to enum variables of the decoded layout. m is left unchanged on
+// error.
+func (m *Machine) GobDecode(data []byte) error {
+	var g gobMachine
+	if err := gob.NewDecoder(bytes.NewReader(data)).Decode(&g); err != nil {
+		return fmt.Errorf("gsm: gob decode failed: %w", err)
+	}
+	if g.Version != 1 {
+		return fmt.Errorf("gsm: unsupported gob version %d", g.Version)
+	}
+	vars, totalBits, err := importVars(g.Vars)
+	if err != nil {
+		return err
+	}
+	if err := checkTableShapes(1<<totalBits, g.Events, g.Initial, g.NF, g.Step); err != nil {
+		return err
+	}
+	if g.Tags != nil && len(g.Tags) != len(g.Events) {
+		return fmt.Errorf("gsm: tags cover %d events, want %d", len(g.Tags), len(g.Events))
+	}
+	if g.Compensated != nil && len(g.Compensated) != len(g.Events) {
+		return fmt.Errorf("gsm: compensation sets cover %d events, want %d", len(g.Compensated), len(g.Events))
+	}
+
+	decoded := &Machine{
+		name:       g.Name,
+		vars:       vars,
+		events:     make(map[string]int),
+		step:       g.Step,
+		nf:         g.NF,
+		initial:    g.Initial,
+		tags:       g.Tags,
+		verified:   g.Verified,
+		groups:     g.Groups,
+		maxRepair:  g.MaxRepair,
+		reachCount: g.ReachCount,
+		libVersion: g.LibVersion,
+	}
+	for _, c := range g.Compensated {
+		decoded.compensated = append(decoded.compensated, bitset(c))
+	}
+	for i, name := range g.Events {
+		if _, dup := decoded.events[name]; dup {
+			return fmt.Errorf("gsm: duplicate event %q", name)
+		}
+		decoded.events[name] = i
+	}
+	for _, vp := range g.Verified {
+		for _, name := range []string{vp.Event1, vp.Event2} {
+			if _, ok := decoded.events[name]; !ok {
+				return fmt.Errorf("gsm: verified pair (%s, %s) names unknown event %q", vp.Event1, vp.Event2, name)
+			}
+		}
+	}
+	for vi, groups := range g.Groups {
+		if vi < 0 || vi >= len(vars) || vars[vi].kind != EnumKind {
+			return fmt.Errorf("gsm: enum groups for variable %d, which is not an enum", vi)
+		}
+		for name, mask := range groups {
+			if mask>>vars[vi].domain != 0 {
+				return fmt.Errorf("gsm: enum group %q of %s has labels beyond the %d declared", name, vars[vi].name, vars[vi].domain)
+			}
+		}
+	}
+	if err := decoded.Validate(); err != nil {
+		return err
+	}
+
+	*m = Machine{
+		name:        decoded.name,
+		vars:        decoded.vars,
+		events:      decoded.events,
+		step:        decoded.step,
+		nf:          decoded.nf,
+		initial:     decoded.initial,
+		tags:        decoded.tags,
+		verified:    decoded.verified,
+		groups:      decoded.groups,
+		compensated: decoded.compensated,
+		maxRepair:   decoded.maxRepair,
+		reachCount:  decoded.reachCount,
+		libVersion:  decoded.libVersion,
+	}
+	return nil
+}
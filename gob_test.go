@@ -0,0 +1,124 @@
+package gsm_test
+
+import (
+	"bytes"
+	"encoding/gob"
+	"strings"
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+func TestGobRoundTrip(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+
+	var buf bytes.Buffer
+	if err := gob.NewEncoder(&buf).Encode(m); err != nil {
+		t.Fatalf("Encode failed: %v", err)
+	}
+	var decoded gsm.Machine
+	if err := gob.NewDecoder(&buf).Decode(&decoded); err != nil {
+		t.Fatalf("Decode failed: %v", err)
+	}
+
+	if decoded.Name() != m.Name() {
+		t.Errorf("name %q, want %q", decoded.Name(), m.Name())
+	}
+	if ok, diff := decoded.Equivalent(m, nil, nil); !ok {
+		t.Fatalf("decoded machine differs: %s", diff)
+	}
+	for id := uint64(0); ; id++ {
+		want, err := m.NormalizeID(id)
+		if err != nil {
+			break
+		}
+		if got, _ := decoded.NormalizeID(id); got != want {
+			t.Fatalf("normal form of %d: decoded %d, original %d", id, got, want)
+		}
+	}
+	if got, want := len(decoded.VerifiedPairs()), len(m.VerifiedPairs()); got != want {
+		t.Errorf("decoded %d verified pairs, want %d", got, want)
+	}
+	if got := decoded.NewState().String(); got != m.NewState().String() {
+		t.Errorf("initial state %s, want %s", got, m.NewState())
+	}
+	if decoded.ProducedBy() != gsm.LibVersion {
+		t.Errorf("ProducedBy = %q, want %q", decoded.ProducedBy(), gsm.LibVersion)
+	}
+}
+
+func TestGobDecodeRejectsCorruptTables(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	data, err := m.GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded gsm.Machine
+	if err := decoded.GobDecode(data[:len(data)/2]); err == nil {
+		t.Error("expected an error for truncated data")
+	}
+
+	// A table-shape problem is reported like Load reports it.
+	b := gsm.NewRegistry("tiny")
+	flag := b.Bool("flag")
+	b.Event("set").Writes(flag).Apply(func(s gsm.State) gsm.State { return s.SetBool(flag, true) }).Add()
+	bad := gsm.NewMachineFromTables(b, 0, []uint64{0, 1}, [][]uint64{{1, 7}})
+	data, err = bad.GobEncode()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := decoded.GobDecode(data); err == nil || !strings.Contains(err.Error(), "out of range") {
+		t.Errorf("GobDecode error = %v, want out of range", err)
+	}
+}
+
+func TestGobDecodeRejectsBadMetadata(t *testing.T) {
+	b := gsm.NewRegistry("tiny")
+	flag := b.Bool("flag")
+	b.Enum("mode", "a", "b", "c")
+	b.Event("set").Writes(flag).Apply(func(s gsm.State) gsm.State { return s.SetBool(flag, true) }).Add()
+	nf := make([]uint64, 8)
+	step := [][]uint64{make([]uint64, 8)}
+	for id := range nf {
+		nf[id] = uint64(id)
+		if id>>1 == 3 { // mode's padding encoding clamps to c
+			nf[id] = uint64(id) &^ 2
+		}
+		step[0][id] = nf[id] | 1
+	}
+
+	tests := []struct {
+		name     string
+		verified []gsm.VerifiedPair
+		groups   map[int]map[string]uint64
+		want     string
+	}{
+		{"valid", []gsm.VerifiedPair{{Event1: "set", Event2: "set", Method: "self"}}, map[int]map[string]uint64{1: {"ab": 3}}, ""},
+		{"unknown pair event", []gsm.VerifiedPair{{Event1: "set", Event2: "reset", Method: "brute"}}, nil, `unknown event "reset"`},
+		{"group on a bool", nil, map[int]map[string]uint64{0: {"on": 2}}, "not an enum"},
+		{"group past the layout", nil, map[int]map[string]uint64{2: {"x": 1}}, "not an enum"},
+		{"group label out of domain", nil, map[int]map[string]uint64{1: {"d": 8}}, "beyond the 3 declared"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := gsm.NewMachineFromTables(b, 0, nf, step)
+			gsm.SetProofs(m, tt.verified, tt.groups)
+			data, err := m.GobEncode()
+			if err != nil {
+				t.Fatal(err)
+			}
+			var decoded gsm.Machine
+			err = decoded.GobDecode(data)
+			if tt.want == "" {
+				if err != nil {
+					t.Fatalf("GobDecode: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Errorf("GobDecode error = %v, want it to contain %q", err, tt.want)
+			}
+		})
+	}
+}
@@ -2,7 +2,12 @@ package gsm_test
 
 import (
 	"encoding/json"
+	"errors"
+	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
 	"testing"
 
 	"github.com/blackwell-systems/gsm"
@@ -13,6 +18,17 @@ import (
 func buildOrderMachine(t *testing.T) (*gsm.Machine, *gsm.Report) {
 	t.Helper()
 
+	machine, report, err := newOrderRegistry().Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+
+	return machine, report
+}
+
+// newOrderRegistry declares the order fulfillment machine without building
+// it, so tests can add declarations first.
+func newOrderRegistry() *gsm.Registry {
 	b := gsm.NewRegistry("order_fulfillment")
 
 	// State variables
@@ -94,12 +110,7 @@ func buildOrderMachine(t *testing.T) (*gsm.Machine, *gsm.Report) {
 	b.Independent("process_payment", "restock")
 	b.Independent("cancel_order", "restock")
 
-	machine, report, err := b.Build()
-	if err != nil {
-		t.Fatalf("Build failed: %v\n%s", err, report)
-	}
-
-	return machine, report
+	return b
 }
 
 func TestBuildPasses(t *testing.T) {
@@ -362,3 +373,2700 @@ func TestExport(t *testing.T) {
 
 	t.Logf("Exported %d bytes to %s", len(data), tmpfile)
 }
+
+// buildGatedIncrements constructs the inc_one/inc_two CC violation from
+// TestCCFailureDetected, gated behind a flag that no event ever sets.
+// The violating states exist in the encoding but are unreachable.
+func buildGatedIncrements() *gsm.Registry {
+	b := gsm.NewRegistry("gated_increments")
+
+	x := b.Int("x", 0, 4)
+	enabled := b.Bool("enabled")
+
+	b.Invariant("x_bounded").
+		Watches(x).
+		Holds(func(s gsm.State) bool {
+			return s.GetInt(x) <= 3
+		}).
+		Repair(func(s gsm.State) gsm.State {
+			return s.SetInt(x, 0)
+		}).
+		Add()
+
+	b.Event("inc_one").
+		Writes(x).
+		Guard(func(s gsm.State) bool { return s.GetBool(enabled) }).
+		Apply(func(s gsm.State) gsm.State {
+			return s.SetInt(x, s.GetInt(x)+1)
+		}).
+		Add()
+
+	b.Event("inc_two").
+		Writes(x).
+		Guard(func(s gsm.State) bool { return s.GetBool(enabled) }).
+		Apply(func(s gsm.State) gsm.State {
+			return s.SetInt(x, s.GetInt(x)+2)
+		}).
+		Add()
+
+	return b
+}
+
+func TestCCOverReachable(t *testing.T) {
+	if _, _, err := buildGatedIncrements().Build(); err == nil {
+		t.Fatal("expected CC failure over all valid states")
+	}
+
+	_, report, err := buildGatedIncrements().CCOverReachable().Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	if !report.CC {
+		t.Fatal("expected CC to pass over reachable states")
+	}
+	if report.PairsBruteReachable != 1 || report.PairsBrute != 0 {
+		t.Errorf("expected 1 reachable brute-force pair, got reachable=%d brute=%d",
+			report.PairsBruteReachable, report.PairsBrute)
+	}
+	t.Logf("\n%s", report)
+}
+
+func TestNoOpEventsDetected(t *testing.T) {
+	b := gsm.NewRegistry("inert")
+
+	power := b.Bool("power")
+
+	b.Event("toggle").
+		Writes(power).
+		Apply(func(s gsm.State) gsm.State {
+			return s.SetBool(power, !s.GetBool(power))
+		}).
+		Add()
+
+	// Deliberately inert: writes power back to its current value.
+	b.Event("touch").
+		Writes(power).
+		Apply(func(s gsm.State) gsm.State {
+			return s.SetBool(power, s.GetBool(power))
+		}).
+		Add()
+
+	b.OnlyDeclaredPairs()
+
+	_, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	if len(report.NoOpEvents) != 1 || report.NoOpEvents[0] != "touch" {
+		t.Fatalf("expected NoOpEvents [touch], got %v", report.NoOpEvents)
+	}
+}
+
+func TestNoOpEventsIgnoresGuardedEvents(t *testing.T) {
+	_, report := buildOrderMachine(t)
+	if len(report.NoOpEvents) != 0 {
+		t.Fatalf("order machine has no inert events, got %v", report.NoOpEvents)
+	}
+}
+
+func TestCheckReportsViolatedInvariants(t *testing.T) {
+	b := gsm.NewRegistry("check")
+
+	status := b.Enum("status", "pending", "paid", "shipped")
+	paid := b.Bool("paid")
+	count := b.Int("count", 0, 3)
+
+	b.Invariant("no_ship_unpaid").
+		Watches(status, paid).
+		Holds(func(s gsm.State) bool {
+			return s.Get(status) != "shipped" || s.GetBool(paid)
+		}).
+		Repair(func(s gsm.State) gsm.State {
+			return s.Set(status, "pending")
+		}).
+		Add()
+
+	b.Invariant("count_below_3").
+		Watches(count).
+		Holds(func(s gsm.State) bool {
+			return s.GetInt(count) < 3
+		}).
+		Repair(func(s gsm.State) gsm.State {
+			return s.SetInt(count, 0)
+		}).
+		Add()
+
+	m, _, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	ok, violated := m.Check(m.NewState())
+	if !ok || violated != nil {
+		t.Fatalf("zero state should be valid, got ok=%v violated=%v", ok, violated)
+	}
+
+	bad := m.NewState().Set(status, "shipped").SetInt(count, 3)
+	ok, violated = m.Check(bad)
+	if ok {
+		t.Fatal("expected invalid state")
+	}
+	if len(violated) != 2 || violated[0] != "no_ship_unpaid" || violated[1] != "count_below_3" {
+		t.Fatalf("expected violations in priority order, got %v", violated)
+	}
+	if ok != m.IsValid(bad) {
+		t.Fatal("Check disagrees with IsValid")
+	}
+}
+
+func TestBuildAndExport(t *testing.T) {
+	dir := t.TempDir()
+
+	path := dir + "/ok.gsm.json"
+	b := gsm.NewRegistry("light")
+	power := b.Bool("power")
+	b.Event("toggle").
+		Writes(power).
+		Apply(func(s gsm.State) gsm.State {
+			return s.SetBool(power, !s.GetBool(power))
+		}).
+		Add()
+
+	report, err := b.BuildAndExport(path)
+	if err != nil {
+		t.Fatalf("BuildAndExport failed: %v\n%s", err, report)
+	}
+	if _, err := os.Stat(path); err != nil {
+		t.Fatalf("expected export at %s: %v", path, err)
+	}
+
+	// A failing build must not write anything.
+	badPath := dir + "/bad.gsm.json"
+	report, err = buildGatedIncrements().BuildAndExport(badPath)
+	if err == nil {
+		t.Fatal("expected CC failure")
+	}
+	if report == nil || report.CC {
+		t.Fatal("expected a failing report")
+	}
+	if _, err := os.Stat(badPath); !os.IsNotExist(err) {
+		t.Fatalf("failed build left a file behind: %v", err)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Fatalf("expected only the successful export in %s, found %d entries", dir, len(entries))
+	}
+}
+
+func TestPreciseFootprints(t *testing.T) {
+	build := func(precise bool) *gsm.Report {
+		b := gsm.NewRegistry("precise")
+
+		a := b.Bool("a")
+		c := b.Bool("c")
+
+		// Both events write a watched variable, so the static analysis
+		// assumes either can trigger the repair. Neither ever does:
+		// setting a, or clearing c, can only make "c implies a" more true.
+		b.Invariant("c_implies_a").
+			Watches(a, c).
+			Holds(func(s gsm.State) bool {
+				return s.GetBool(a) || !s.GetBool(c)
+			}).
+			Repair(func(s gsm.State) gsm.State {
+				return s.SetBool(c, false)
+			}).
+			Add()
+
+		b.Event("set_a").
+			Writes(a).
+			Apply(func(s gsm.State) gsm.State { return s.SetBool(a, true) }).
+			Add()
+
+		b.Event("clear_c").
+			Writes(c).
+			Apply(func(s gsm.State) gsm.State { return s.SetBool(c, false) }).
+			Add()
+
+		if precise {
+			b.PreciseFootprints()
+		}
+		_, report, err := b.Build()
+		if err != nil {
+			t.Fatalf("Build failed: %v\n%s", err, report)
+		}
+		return report
+	}
+
+	static := build(false)
+	if static.PairsDisjoint != 0 || static.PairsBrute != 1 {
+		t.Fatalf("expected static analysis to brute-force, got %d disjoint, %d brute",
+			static.PairsDisjoint, static.PairsBrute)
+	}
+
+	precise := build(true)
+	if precise.PairsDisjoint != 1 || precise.PairsBrute != 0 {
+		t.Fatalf("expected precise analysis to prove disjointness, got %d disjoint, %d brute",
+			precise.PairsDisjoint, precise.PairsBrute)
+	}
+	if precise.PreciseDisjointDelta != 1 {
+		t.Errorf("expected PreciseDisjointDelta 1, got %d", precise.PreciseDisjointDelta)
+	}
+}
+
+func TestPreciseFootprintsStillDetectCCFailure(t *testing.T) {
+	b := buildGatedIncrements().PreciseFootprints()
+	if _, _, err := b.Build(); err == nil {
+		t.Fatal("expected CC failure under precise footprints")
+	}
+}
+
+func TestInitialState(t *testing.T) {
+	b := gsm.NewRegistry("initial")
+
+	status := b.Enum("status", "draft", "pending", "paid")
+	stock := b.Int("stock", 0, 9)
+
+	b.Invariant("paid_needs_stock").
+		Watches(status, stock).
+		Holds(func(s gsm.State) bool {
+			return s.Get(status) != "paid" || s.GetInt(stock) > 0
+		}).
+		Repair(func(s gsm.State) gsm.State {
+			return s.Set(status, "pending")
+		}).
+		Add()
+
+	b.Event("pay").
+		Writes(status).
+		Apply(func(s gsm.State) gsm.State { return s.Set(status, "paid") }).
+		Add()
+
+	b.InitialState(func(s gsm.State) gsm.State {
+		return s.Set(status, "pending").SetInt(stock, 5)
+	})
+
+	m, _, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	s := m.NewState()
+	if s.Get(status) != "pending" || s.GetInt(stock) != 5 {
+		t.Fatalf("expected initial state {pending, 5}, got %s", s)
+	}
+
+	path := t.TempDir() + "/initial.gsm.json"
+	if err := m.Export(path); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var export struct {
+		Initial uint64 `json:"initial"`
+	}
+	if err := json.Unmarshal(data, &export); err != nil {
+		t.Fatal(err)
+	}
+	if export.Initial != s.ID() {
+		t.Errorf("exported initial %d, want %d", export.Initial, s.ID())
+	}
+}
+
+func TestInitialStateMustBeValid(t *testing.T) {
+	b := gsm.NewRegistry("bad_initial")
+
+	status := b.Enum("status", "pending", "paid")
+	stock := b.Int("stock", 0, 3)
+
+	b.Invariant("paid_needs_stock").
+		Watches(status, stock).
+		Holds(func(s gsm.State) bool {
+			return s.Get(status) != "paid" || s.GetInt(stock) > 0
+		}).
+		Repair(func(s gsm.State) gsm.State {
+			return s.Set(status, "pending")
+		}).
+		Add()
+
+	b.InitialState(func(s gsm.State) gsm.State {
+		return s.Set(status, "paid")
+	})
+
+	if _, _, err := b.Build(); err == nil {
+		t.Fatal("expected Build to reject an invalid initial state")
+	}
+}
+
+func TestMutuallyExclusive(t *testing.T) {
+	// Payment needs status=pending and shipping needs status=paid, so the
+	// two are never enabled together.
+	b := newOrderRegistry().MutuallyExclusive("process_payment", "ship_item")
+	if _, report, err := b.Build(); err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+
+	// Cancelling is allowed in any non-shipped state, including paid with
+	// stock on hand, where shipping is also enabled.
+	b = newOrderRegistry().MutuallyExclusive("cancel_order", "ship_item")
+	_, report, err := b.Build()
+	if err == nil {
+		t.Fatal("expected mutual exclusion failure")
+	}
+	f := report.ExclusionFailure
+	if f == nil {
+		t.Fatal("expected ExclusionFailure in report")
+	}
+	if f.Event1 != "cancel_order" || f.Event2 != "ship_item" {
+		t.Errorf("wrong events: %s, %s", f.Event1, f.Event2)
+	}
+	if !strings.Contains(f.State.String(), "status=paid") {
+		t.Errorf("expected counterexample with status=paid, got %s", f.State)
+	}
+	t.Logf("\n%s", report)
+}
+
+func TestReportSummary(t *testing.T) {
+	_, report := buildOrderMachine(t)
+	want := "order_fulfillment: OK (48 states, WFC depth 1, CC 3/3 disjoint)"
+	if got := report.Summary(); got != want {
+		t.Errorf("pass summary:\n  got  %q\n  want %q", got, want)
+	}
+
+	_, report, _ = buildGatedIncrements().Build()
+	if got, want := report.Summary(), "gated_increments: CC FAIL (inc_one,inc_two)"; got != want {
+		t.Errorf("CC fail summary:\n  got  %q\n  want %q", got, want)
+	}
+
+	_, report, _ = newOrderRegistry().MutuallyExclusive("cancel_order", "ship_item").Build()
+	if got, want := report.Summary(), "order_fulfillment: EXCLUSION FAIL (cancel_order,ship_item)"; got != want {
+		t.Errorf("exclusion fail summary:\n  got  %q\n  want %q", got, want)
+	}
+
+	b := gsm.NewRegistry("cycling")
+	x := b.Int("x", 0, 2)
+	b.Invariant("not_one").
+		Watches(x).
+		Holds(func(s gsm.State) bool { return s.GetInt(x) != 1 }).
+		Repair(func(s gsm.State) gsm.State { return s.SetInt(x, 2) }).
+		Add()
+	b.Invariant("not_two").
+		Watches(x).
+		Holds(func(s gsm.State) bool { return s.GetInt(x) != 2 }).
+		Repair(func(s gsm.State) gsm.State { return s.SetInt(x, 1) }).
+		Add()
+	_, report, _ = b.Build()
+	if got, want := report.Summary(), "cycling: WFC FAIL"; got != want {
+		t.Errorf("WFC fail summary:\n  got  %q\n  want %q", got, want)
+	}
+}
+
+func TestStateFrom(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+
+	s, err := m.StateFrom(map[string]interface{}{
+		"status":    "paid",
+		"paid":      true,
+		"inventory": 3,
+	})
+	if err != nil {
+		t.Fatalf("StateFrom failed: %v", err)
+	}
+	if got, want := s.String(), "{status=paid, paid=true, inventory=3}"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	// JSON-decoded numbers arrive as float64.
+	var values map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"inventory": 2}`), &values); err != nil {
+		t.Fatal(err)
+	}
+	s, err = m.StateFrom(values)
+	if err != nil {
+		t.Fatalf("StateFrom with JSON values failed: %v", err)
+	}
+	if got, want := s.String(), "{status=pending, paid=false, inventory=2}"; got != want {
+		t.Errorf("got %s, want %s", got, want)
+	}
+
+	bad := []map[string]interface{}{
+		{"unknown": 1},
+		{"status": 1},
+		{"status": "lost"},
+		{"paid": "yes"},
+		{"inventory": 6},
+		{"inventory": -1},
+		{"inventory": 1.5},
+	}
+	for _, values := range bad {
+		if _, err := m.StateFrom(values); err == nil {
+			t.Errorf("expected error for %v", values)
+		}
+	}
+}
+
+func TestCheckSelfPairs(t *testing.T) {
+	_, report, err := newOrderRegistry().CheckSelfPairs().Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	if report.SelfPairs != 5 {
+		t.Errorf("expected 5 self-pairs, got %d", report.SelfPairs)
+	}
+	if report.PairsTotal != 3 {
+		t.Errorf("self-pairs must not inflate PairsTotal, got %d", report.PairsTotal)
+	}
+
+	_, report = buildOrderMachine(t)
+	if report.SelfPairs != 0 {
+		t.Errorf("expected no self-pairs by default, got %d", report.SelfPairs)
+	}
+}
+
+func TestIntSet(t *testing.T) {
+	b := gsm.NewRegistry("http")
+
+	code := b.IntSet("code", 500, 200, 404)
+	retried := b.Bool("retried")
+
+	b.Invariant("retry_only_on_error").
+		Watches(code, retried).
+		Holds(func(s gsm.State) bool {
+			return !s.GetBool(retried) || s.GetInt(code) == 500
+		}).
+		Repair(func(s gsm.State) gsm.State {
+			return s.SetBool(retried, false)
+		}).
+		Add()
+
+	b.Event("fail").
+		Writes(code).
+		Apply(func(s gsm.State) gsm.State { return s.SetInt(code, 500) }).
+		Add()
+
+	b.Event("retry").
+		Writes(retried).
+		Apply(func(s gsm.State) gsm.State { return s.SetBool(retried, true) }).
+		Add()
+
+	b.OnlyDeclaredPairs() // retry is order-sensitive by design
+
+	m, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	// 3 codes × 2 bools, packed into 2 + 1 bits instead of 9 + 1.
+	if report.StateCount != 6 {
+		t.Errorf("expected 6 states, got %d", report.StateCount)
+	}
+
+	s := m.NewState()
+	if got := s.GetInt(code); got != 200 {
+		t.Errorf("zero state should hold the smallest member, got %d", got)
+	}
+	s = s.SetInt(code, 404)
+	if got := s.GetInt(code); got != 404 {
+		t.Errorf("expected 404, got %d", got)
+	}
+	if got := s.SetInt(code, 420).GetInt(code); got != 404 {
+		t.Errorf("expected non-member 420 to clamp to nearest 404, got %d", got)
+	}
+	if got := s.SetInt(code, 9000).GetInt(code); got != 500 {
+		t.Errorf("expected 9000 to clamp to 500, got %d", got)
+	}
+
+	if _, err := m.StateFrom(map[string]interface{}{"code": 302}); err == nil {
+		t.Error("expected StateFrom to reject a non-member value")
+	}
+
+	s = m.Apply(m.Apply(m.NewState(), "retry"), "fail")
+	if s.GetInt(code) != 500 || s.GetBool(retried) {
+		t.Errorf("expected retry to be repaired away before the failure, got %s", s)
+	}
+
+	path := t.TempDir() + "/http.gsm.json"
+	if err := m.Export(path); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	loaded, err := gsm.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	s = loaded.NewState()
+	if got := s.String(); got != "{code=200, retried=false}" {
+		t.Errorf("loaded machine lost the value list: %s", got)
+	}
+}
+
+func TestIndependentTags(t *testing.T) {
+	build := func(declare func(b *gsm.Registry)) (*gsm.Report, error) {
+		b := gsm.NewRegistry("tagged")
+
+		paid := b.Bool("paid")
+		refunded := b.Bool("refunded")
+		stock := b.Int("stock", 0, 3)
+
+		b.Event("pay").Tag("payment").
+			Writes(paid).
+			Apply(func(s gsm.State) gsm.State { return s.SetBool(paid, true) }).
+			Add()
+		b.Event("refund").Tag("payment").
+			Writes(refunded).
+			Apply(func(s gsm.State) gsm.State { return s.SetBool(refunded, true) }).
+			Add()
+		b.Event("restock").Tag("inventory").
+			Writes(stock).
+			Apply(func(s gsm.State) gsm.State { return s.SetInt(stock, s.GetInt(stock)+1) }).
+			Add()
+		b.Event("audit").Tag("payment", "inventory").
+			Writes(paid).
+			Apply(func(s gsm.State) gsm.State { return s }).
+			Add()
+
+		declare(b)
+		_, report, err := b.Build()
+		return report, err
+	}
+
+	report, err := build(func(b *gsm.Registry) {
+		b.IndependentTags("payment", "inventory")
+	})
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	// pay×restock, pay×audit, refund×restock, refund×audit, audit×restock;
+	// audit is never paired with itself.
+	if report.PairsTotal != 5 {
+		t.Errorf("expected 5 expanded pairs, got %d", report.PairsTotal)
+	}
+
+	// Redundant tag declarations are not double-counted.
+	report, err = build(func(b *gsm.Registry) {
+		b.IndependentTags("payment", "inventory")
+		b.IndependentTags("inventory", "payment")
+	})
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	if report.PairsTotal != 5 {
+		t.Errorf("expected 5 pairs after redundant declarations, got %d", report.PairsTotal)
+	}
+}
+
+func TestValidateEncoding(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+
+	s := m.Apply(m.NewState(), "restock")
+	if !m.WellFormed(s) || m.ValidateEncoding(s) != nil {
+		t.Fatalf("expected %s to be well formed", s)
+	}
+
+	// Layout: status (2 bits, 4 labels), paid (1 bit), inventory (3 bits, 0..5).
+	bad := m.StateFromID(7 << 3) // inventory raw 7
+	if m.WellFormed(bad) {
+		t.Fatal("expected inventory=7 to be malformed")
+	}
+	if got := m.ValidateEncoding(bad); len(got) != 1 || got[0] != "inventory" {
+		t.Fatalf("expected [inventory], got %v", got)
+	}
+
+	// Bits beyond the last variable belong to no variable.
+	stray := m.StateFromID(1 << 6)
+	if m.WellFormed(stray) {
+		t.Fatal("expected stray high bit to be malformed")
+	}
+	if got := m.ValidateEncoding(stray); got != nil {
+		t.Fatalf("expected no per-variable errors, got %v", got)
+	}
+}
+
+func TestRemoveEvent(t *testing.T) {
+	b := newOrderRegistry()
+
+	if b.RemoveEvent("no_such_event") {
+		t.Fatal("expected false for unknown event")
+	}
+
+	// place_order is event 0; every later index shifts down. Its pair with
+	// restock is dropped, leaving process_payment×restock and
+	// cancel_order×restock.
+	if !b.RemoveEvent("place_order") {
+		t.Fatal("expected place_order to be removed")
+	}
+	m, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	if report.EventCount != 4 || report.PairsTotal != 2 {
+		t.Fatalf("expected 4 events and 2 pairs, got %d and %d", report.EventCount, report.PairsTotal)
+	}
+	for _, ev := range m.Events() {
+		if ev == "place_order" {
+			t.Fatal("removed event still present")
+		}
+	}
+
+	// Removing a middle event renumbers pairs after it. Had the pair
+	// indices not shifted, cancel_order×restock would become a dangling
+	// index past the end of the event list.
+	b = newOrderRegistry()
+	b.RemoveEvent("ship_item")
+	_, report, err = b.Build()
+	if err != nil {
+		t.Fatalf("Build failed after removing ship_item: %v\n%s", err, report)
+	}
+	if report.PairsTotal != 3 {
+		t.Fatalf("expected all 3 declared pairs to survive, got %d", report.PairsTotal)
+	}
+}
+
+func TestRemoveEventFixesExclusivePairs(t *testing.T) {
+	b := newOrderRegistry().MutuallyExclusive("cancel_order", "ship_item")
+	b.RemoveEvent("ship_item")
+	if _, report, err := b.Build(); err != nil {
+		t.Fatalf("exclusion pair should be dropped with its event: %v\n%s", err, report)
+	}
+
+	b = newOrderRegistry().MutuallyExclusive("process_payment", "restock")
+	b.RemoveEvent("place_order")
+	_, report, err := b.Build()
+	if err == nil {
+		t.Fatal("expected renumbered exclusion pair to still be checked")
+	}
+	if f := report.ExclusionFailure; f == nil || f.Event1 != "process_payment" || f.Event2 != "restock" {
+		t.Fatalf("expected process_payment/restock failure, got %+v", f)
+	}
+}
+
+func TestRemoveEventRenumbersConditions(t *testing.T) {
+	b := gsm.NewRegistry("conditions")
+	x := b.Int("x", 0, 3)
+	b.Invariant("bounded").Watches(x).
+		Holds(func(s gsm.State) bool { return s.GetInt(x) <= 3 }).
+		Repair(func(s gsm.State) gsm.State { return s.SetInt(x, 3) }).
+		Add()
+	b.Event("first").Apply(func(s gsm.State) gsm.State { return s }).Add()
+	b.Event("noop").Apply(func(s gsm.State) gsm.State { return s }).Add()
+	b.Event("to_one").Writes(x).Apply(func(s gsm.State) gsm.State { return s.SetInt(x, 1) }).Add()
+	b.Event("to_two").Writes(x).Apply(func(s gsm.State) gsm.State { return s.SetInt(x, 2) }).Add()
+	// noop×to_one is pairs index (1, 2); once first is removed, the
+	// unconditional to_one×to_two pair takes that index.
+	b.IndependentWhen("noop", "to_one", func(gsm.State) bool { return false })
+	b.Independent("to_one", "to_two")
+	if _, report, err := b.Build(); err == nil {
+		t.Fatalf("to_one and to_two should fail CC\n%s", report)
+	}
+
+	b.RemoveEvent("first")
+	_, report, err := b.Build()
+	if err == nil {
+		t.Fatalf("unconditional pair passed after RemoveEvent\n%s", report)
+	}
+	if f := report.CCFailure; f == nil || f.Event1 != "to_one" || f.Event2 != "to_two" {
+		t.Errorf("CCFailure = %+v, want to_one/to_two", f)
+	}
+
+	// Removing an event drops the conditions of its pairs.
+	b.RemoveEvent("noop")
+	if _, report, err := b.Build(); err == nil {
+		t.Fatalf("to_one and to_two should still fail\n%s", report)
+	}
+}
+
+func TestRemoveEventDropsRequiresPrev(t *testing.T) {
+	b := gsm.NewRegistry("remove_prev")
+	open := b.Bool("open")
+	b.Event("unlock").Apply(func(s gsm.State) gsm.State { return s }).Add()
+	b.Event("arm").Apply(func(s gsm.State) gsm.State { return s }).Add()
+	b.Event("open").Writes(open).RequiresPrev("unlock").RequiresPrev("arm").
+		Apply(func(s gsm.State) gsm.State { return s.SetBool(open, true) }).Add()
+
+	b.RemoveEvent("unlock")
+	m, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build after removing a predecessor: %v\n%s", err, report)
+	}
+	if m.AllowedAfter("", "open") || !m.AllowedAfter("arm", "open") {
+		t.Error("open should keep arm as its only predecessor")
+	}
+
+	b.RemoveEvent("arm")
+	m, report, err = b.Build()
+	if err != nil {
+		t.Fatalf("Build after removing the last predecessor: %v\n%s", err, report)
+	}
+	if !m.AllowedAfter("", "open") {
+		t.Error("open should be unrestricted once it has no predecessors")
+	}
+}
+
+func TestRemoveInvariant(t *testing.T) {
+	b := gsm.NewRegistry("remove_invariant")
+	x := b.Int("x", 0, 3)
+	b.Invariant("cap").
+		Watches(x).
+		Holds(func(s gsm.State) bool { return s.GetInt(x) < 3 }).
+		Repair(func(s gsm.State) gsm.State { return s.SetInt(x, 2) }).
+		Add()
+	b.Event("max").
+		Writes(x).
+		Apply(func(s gsm.State) gsm.State { return s.SetInt(x, 3) }).
+		Add()
+
+	if b.RemoveInvariant("missing") {
+		t.Fatal("expected false for unknown invariant")
+	}
+	if !b.RemoveInvariant("cap") {
+		t.Fatal("expected cap to be removed")
+	}
+	m, _, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if got := m.Apply(m.NewState(), "max").GetInt(x); got != 3 {
+		t.Fatalf("expected no compensation after removing cap, got x=%d", got)
+	}
+}
+
+func TestMaxReachableStates(t *testing.T) {
+	_, report := buildOrderMachine(t)
+	n := report.ReachableCount
+	if n == 0 || n >= report.StateCount {
+		t.Fatalf("expected some but not all states reachable, got %d of %d", n, report.StateCount)
+	}
+
+	if _, report, err := newOrderRegistry().MaxReachableStates(n).Build(); err != nil {
+		t.Fatalf("limit equal to the reachable count should pass: %v\n%s", err, report)
+	}
+
+	_, report, err := newOrderRegistry().MaxReachableStates(10).Build()
+	if err == nil {
+		t.Fatal("expected reachable-state limit to fail the build")
+	}
+	if !strings.Contains(err.Error(), "10") {
+		t.Errorf("expected error to name the limit, got %v", err)
+	}
+	if report.ReachableLimit != 10 {
+		t.Errorf("ReachableLimit = %d, want 10", report.ReachableLimit)
+	}
+	if got := report.Summary(); !strings.Contains(got, "more than 10 reachable states") || !strings.Contains(got, "MaxReachableStates") {
+		t.Errorf("Summary = %q, want it to name the limit", got)
+	}
+	if got := report.String(); !strings.Contains(got, "more than 10 states; see MaxReachableStates") {
+		t.Errorf("String should name the limit:\n%s", got)
+	}
+}
+
+func TestApplyWithHook(t *testing.T) {
+	b := gsm.NewRegistry("hooked")
+
+	status := b.Enum("status", "pending", "paid", "shipped")
+	paid := b.Bool("paid")
+	alerts := b.Int("alerts", 0, 3)
+
+	b.Invariant("no_ship_unpaid").
+		Watches(status, paid, alerts).
+		Holds(func(s gsm.State) bool {
+			return s.Get(status) != "shipped" || s.GetBool(paid)
+		}).
+		Repair(func(s gsm.State) gsm.State {
+			return s.Set(status, "paid").SetInt(alerts, s.GetInt(alerts)+1)
+		}).
+		Add()
+
+	b.Invariant("paid_flag_matches").
+		Watches(status, paid).
+		Holds(func(s gsm.State) bool {
+			return s.Get(status) != "paid" || s.GetBool(paid)
+		}).
+		Repair(func(s gsm.State) gsm.State {
+			return s.Set(status, "pending")
+		}).
+		Add()
+
+	b.Event("force_ship").
+		Writes(status).
+		Apply(func(s gsm.State) gsm.State { return s.Set(status, "shipped") }).
+		Add()
+
+	b.Event("pay").
+		Writes(status, paid).
+		Apply(func(s gsm.State) gsm.State { return s.Set(status, "paid").SetBool(paid, true) }).
+		Add()
+
+	b.OnlyDeclaredPairs()
+	m, _, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	var fired []string
+	hook := func(from gsm.State, invariant string, to gsm.State) {
+		fired = append(fired, invariant)
+		t.Logf("%s: %s → %s", invariant, from, to)
+	}
+
+	// Clean transition: no hook.
+	s := m.ApplyWithHook(m.NewState(), "pay", hook)
+	if len(fired) != 0 {
+		t.Fatalf("expected no compensation, got %v", fired)
+	}
+	if s.ID() != m.Apply(m.NewState(), "pay").ID() {
+		t.Fatal("ApplyWithHook result differs from Apply")
+	}
+
+	// Shipping unpaid triggers a two-step chain.
+	s = m.ApplyWithHook(m.NewState(), "force_ship", hook)
+	if len(fired) != 2 || fired[0] != "no_ship_unpaid" || fired[1] != "paid_flag_matches" {
+		t.Fatalf("expected two-step repair chain, got %v", fired)
+	}
+	if s.ID() != m.Apply(m.NewState(), "force_ship").ID() {
+		t.Fatal("ApplyWithHook result differs from Apply")
+	}
+	if s.Get(status) != "pending" || s.GetInt(alerts) != 1 {
+		t.Fatalf("unexpected result %s", s)
+	}
+}
+
+func TestInvariantWhen(t *testing.T) {
+	b := gsm.NewRegistry("conditional")
+
+	status := b.Enum("status", "pending", "paid")
+	inventory := b.Int("inventory", 0, 3)
+	noted := b.Bool("noted")
+
+	// Watches only inventory; status is read by the condition.
+	b.Invariant("stock_when_paid").
+		Watches(inventory).
+		When(func(s gsm.State) bool { return s.Get(status) == "paid" }).
+		Holds(func(s gsm.State) bool { return s.GetInt(inventory) > 0 }).
+		Repair(func(s gsm.State) gsm.State { return s.SetInt(inventory, 1) }).
+		Add()
+
+	b.Event("pay").
+		Writes(status).
+		Apply(func(s gsm.State) gsm.State { return s.Set(status, "paid") }).
+		Add()
+
+	b.Event("sell").
+		Writes(inventory).
+		Guard(func(s gsm.State) bool { return s.GetInt(inventory) > 0 }).
+		Apply(func(s gsm.State) gsm.State { return s.SetInt(inventory, s.GetInt(inventory)-1) }).
+		Add()
+
+	b.Event("note").
+		Writes(noted).
+		Apply(func(s gsm.State) gsm.State { return s.SetBool(noted, true) }).
+		Add()
+
+	m, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	if !report.CC {
+		t.Fatal("expected CC to pass")
+	}
+
+	// pay writes status, which the condition reads, so pay/sell can no
+	// longer be proved disjoint and must be brute-forced.
+	if report.PairsDisjoint != 2 || report.PairsBrute != 1 {
+		t.Fatalf("expected 2 disjoint + 1 brute pairs, got %d + %d", report.PairsDisjoint, report.PairsBrute)
+	}
+
+	// Outside the condition the invariant is not enforced.
+	pending, err := m.StateFrom(map[string]interface{}{"status": "pending", "inventory": 0})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.IsValid(pending) {
+		t.Fatal("pending with no inventory should be valid")
+	}
+	if got := m.Apply(pending, "pay"); got.GetInt(inventory) != 1 {
+		t.Fatalf("expected repair after pay, got %s", got)
+	}
+}
+
+func TestIndependentDeduplicates(t *testing.T) {
+	b := newOrderRegistry()
+	b.Independent("restock", "place_order")
+	b.Independent("place_order", "restock")
+	_, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	if report.PairsTotal != 3 {
+		t.Errorf("redundant declarations inflated PairsTotal to %d, want 3", report.PairsTotal)
+	}
+}
+
+func TestIndependentSelfPairPanics(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for self pair without CheckSelfPairs")
+		}
+	}()
+	newOrderRegistry().Independent("restock", "restock")
+}
+
+func TestIndependentSelfPairWithCheckSelfPairs(t *testing.T) {
+	_, report, err := newOrderRegistry().CheckSelfPairs().Independent("restock", "restock").Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	if report.SelfPairs != 5 || report.PairsTotal != 3 {
+		t.Errorf("expected 5 self-pairs and 3 pairs, got %d and %d", report.SelfPairs, report.PairsTotal)
+	}
+}
+
+func TestApplyErr(t *testing.T) {
+	b := gsm.NewRegistry("reservations")
+
+	open := b.Bool("open")
+	stock := b.Int("stock", 0, 3)
+
+	b.Event("reserve").
+		Writes(stock).
+		Guard(func(s gsm.State) bool { return s.GetBool(open) }).
+		ApplyErr(func(s gsm.State) (gsm.State, error) {
+			if s.GetInt(stock) == 0 {
+				return s, errors.New("out of stock")
+			}
+			return s.SetInt(stock, s.GetInt(stock)-1), nil
+		}).
+		Add()
+
+	b.Event("open").
+		Writes(open).
+		Apply(func(s gsm.State) gsm.State { return s.SetBool(open, true) }).
+		Add()
+
+	b.Event("restock").
+		Writes(stock).
+		Apply(func(s gsm.State) gsm.State { return s.SetInt(stock, s.GetInt(stock)+1) }).
+		Add()
+
+	b.Independent("reserve", "open")
+	b.MutuallyExclusive("reserve", "open")
+
+	m, report, err := b.Build()
+	if err == nil {
+		t.Fatal("expected reserve and open to be enabled together once stocked")
+	}
+	if report.ExclusionFailure == nil || report.ExclusionFailure.State.GetInt(stock) == 0 {
+		t.Fatalf("a rejected reserve must not count as enabled: %v", report.ExclusionFailure)
+	}
+
+	b.RemoveEvent("open")
+	b.InitialState(func(s gsm.State) gsm.State { return s.SetBool(open, true) })
+	m, report, err = b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+
+	s := m.NewState()
+	if got := m.Apply(s, "reserve"); got.ID() != s.ID() {
+		t.Fatalf("reserve with no stock should be a no-op, got %s", got)
+	}
+	s = m.Apply(m.Apply(s, "restock"), "restock")
+	if got := m.Apply(s, "reserve"); got.GetInt(stock) != 1 {
+		t.Fatalf("reserve should take one unit, got %s", got)
+	}
+
+	closed := m.StateFromID(s.ID()).SetBool(open, false)
+	if got := m.Apply(closed, "reserve"); got.ID() != closed.ID() {
+		t.Fatalf("guard must be checked before the effect, got %s", got)
+	}
+}
+
+func TestTryGetTrySet(t *testing.T) {
+	b := gsm.NewRegistry("lights")
+	light := b.Enum("light", "off", "dim", "on")
+	flag := b.Bool("flag")
+	b.Event("noop").Writes(flag).Apply(func(s gsm.State) gsm.State { return s }).Add()
+	m, _, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s, err := m.NewState().TrySet(light, "dim")
+	if err != nil {
+		t.Fatalf("TrySet failed: %v", err)
+	}
+	if got, err := s.TryGet(light); err != nil || got != "dim" {
+		t.Fatalf("TryGet = %q, %v; want dim", got, err)
+	}
+	if _, err := s.TrySet(light, "bright"); err == nil {
+		t.Error("expected TrySet error for unknown label")
+	}
+
+	// Raw value 3 has no label.
+	malformed := m.StateFromID(3)
+	if _, err := malformed.TryGet(light); err == nil {
+		t.Error("expected TryGet error for out-of-range raw value")
+	}
+	if _, err := s.TryGet(flag); err == nil {
+		t.Error("expected TryGet error for non-enum variable")
+	}
+
+	other := gsm.NewRegistry("other").Enum("mode", "a", "b", "c", "d", "e")
+	if _, err := s.TryGet(other); err == nil {
+		t.Error("expected TryGet error for a foreign variable")
+	}
+	if _, err := s.TrySet(other, "a"); err == nil {
+		t.Error("expected TrySet error for a foreign variable")
+	}
+}
+
+func TestReportTimings(t *testing.T) {
+	_, report := buildOrderMachine(t)
+	tm := report.Timings
+	if tm.Total <= 0 {
+		t.Fatalf("expected total build time, got %+v", tm)
+	}
+	if tm.NormalForms+tm.StepTables+tm.CC > tm.Total {
+		t.Errorf("phases exceed total: %+v", tm)
+	}
+	if !strings.Contains(report.String(), "Timings:") {
+		t.Errorf("report should include timings:\n%s", report)
+	}
+
+	// A failing build still records the phases it reached.
+	_, report, err := buildGatedIncrements().Build()
+	if err == nil {
+		t.Fatal("expected CC failure")
+	}
+	if report.Timings.Total <= 0 {
+		t.Errorf("expected timings on failure, got %+v", report.Timings)
+	}
+}
+
+func TestGuardMaskedPairs(t *testing.T) {
+	// Over reachable states the gate is never opened, so the pair only
+	// commutes because both guards block.
+	_, report, err := buildGatedIncrements().CCOverReachable().Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	if len(report.GuardMaskedPairs) != 1 || report.GuardMaskedPairs[0] != "(inc_one, inc_two)" {
+		t.Fatalf("expected (inc_one, inc_two) guard-masked, got %v", report.GuardMaskedPairs)
+	}
+	if !strings.Contains(report.String(), "guard-masked pairs") {
+		t.Errorf("report should warn about guard-masked pairs:\n%s", report)
+	}
+
+	// Over all valid states both events fire and the pair fails CC.
+	_, report, _ = buildGatedIncrements().Build()
+	if f := report.CCFailure; f == nil || !f.Fired1 || !f.Fired2 {
+		t.Fatalf("expected a failure with both events firing, got %+v", report.CCFailure)
+	}
+
+	// A condition that excludes every state leaves nothing to mask.
+	_, report, err = buildGatedIncrements().
+		IndependentWhen("inc_one", "inc_two", func(gsm.State) bool { return false }).
+		Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	if len(report.GuardMaskedPairs) != 0 {
+		t.Errorf("pair checked in no state reported guard-masked: %v", report.GuardMaskedPairs)
+	}
+
+	// A genuinely interleaving pair is not masked.
+	b := gsm.NewRegistry("shared")
+	x := b.Int("x", 0, 3)
+	b.Invariant("x_small").
+		Watches(x).
+		Holds(func(s gsm.State) bool { return s.GetInt(x) <= 2 }).
+		Repair(func(s gsm.State) gsm.State { return s.SetInt(x, 2) }).
+		Add()
+	for _, name := range []string{"bump_a", "bump_b"} {
+		b.Event(name).
+			Writes(x).
+			Guard(func(s gsm.State) bool { return s.GetInt(x) < 2 }).
+			Apply(func(s gsm.State) gsm.State { return s.SetInt(x, s.GetInt(x)+1) }).
+			Add()
+	}
+	_, report, err = b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	if report.PairsBrute != 1 || len(report.GuardMaskedPairs) != 0 {
+		t.Fatalf("expected 1 unmasked brute-force pair, got brute=%d masked=%v", report.PairsBrute, report.GuardMaskedPairs)
+	}
+}
+
+func TestApplyChecked(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	s := m.NewState()
+	got, err := m.ApplyChecked(s, "restock")
+	if err != nil {
+		t.Fatalf("ApplyChecked: %v", err)
+	}
+	if want := m.Apply(s, "restock"); got.ID() != want.ID() {
+		t.Errorf("ApplyChecked = %s, want Apply's %s", got, want)
+	}
+	if _, err := m.ApplyChecked(s, "missing"); err == nil || !strings.Contains(err.Error(), "unknown event") {
+		t.Errorf("unknown event: err = %v", err)
+	}
+	for _, id := range []uint64{7 << 3, 1 << 6} { // inventory raw 7; beyond the last variable
+		if _, err := m.ApplyChecked(m.StateFromID(id), "restock"); err == nil || !strings.Contains(err.Error(), "not a well-formed encoding") {
+			t.Errorf("state %d: err = %v", id, err)
+		}
+	}
+}
+
+func TestApplyRaw(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	seq := []string{"restock", "process_payment", "ship_item", "restock", "cancel_order"}
+
+	s, id := m.NewState(), m.NewState().ID()
+	for _, ev := range seq {
+		ei, ok := m.EventIndex(ev)
+		if !ok {
+			t.Fatalf("unknown event %q", ev)
+		}
+		s = m.Apply(s, ev)
+		id = m.ApplyRaw(id, ei)
+		if id != s.ID() {
+			t.Fatalf("after %s: ApplyRaw %d, Apply %d", ev, id, s.ID())
+		}
+	}
+	if got := m.StateFromID(id); got.String() != s.String() {
+		t.Fatalf("StateFromID = %s, want %s", got, s)
+	}
+	for id := uint64(0); id < 48; id++ {
+		if m.NormalizeRaw(id) != m.Normalize(m.StateFromID(id)).ID() {
+			t.Fatalf("NormalizeRaw(%d) differs from Normalize", id)
+		}
+	}
+}
+
+func TestCheckReadOutsideFootprint(t *testing.T) {
+	b := gsm.NewRegistry("leaky")
+	status := b.Enum("status", "pending", "paid")
+	inventory := b.Int("inventory", 0, 3)
+
+	// The check reads status but only inventory is watched.
+	b.Invariant("stock_when_paid").
+		Watches(inventory).
+		Holds(func(s gsm.State) bool { return s.Get(status) != "paid" || s.GetInt(inventory) > 0 }).
+		Repair(func(s gsm.State) gsm.State { return s.SetInt(inventory, 1) }).
+		Add()
+	b.Event("pay").
+		Writes(status).
+		Apply(func(s gsm.State) gsm.State { return s.Set(status, "paid") }).
+		Add()
+
+	_, _, err := b.Build()
+	if err == nil {
+		t.Fatal("expected build to fail on a check reading outside its footprint")
+	}
+	for _, want := range []string{`"stock_when_paid"`, `"status"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q should mention %s", err, want)
+		}
+	}
+}
+
+func TestEffectWriteOutsideWrites(t *testing.T) {
+	b := gsm.NewRegistry("sneaky")
+	status := b.Enum("status", "pending", "paid")
+	paid := b.Bool("paid")
+
+	// Rewriting a variable's current value is not a change.
+	b.Event("touch").
+		Writes(status).
+		Apply(func(s gsm.State) gsm.State { return s.SetBool(paid, s.GetBool(paid)) }).
+		Add()
+	// The effect sets paid but declares only status.
+	b.Event("pay").
+		Writes(status).
+		Apply(func(s gsm.State) gsm.State { return s.Set(status, "paid").SetBool(paid, true) }).
+		Add()
+
+	_, _, err := b.Build()
+	if err == nil {
+		t.Fatal("expected build to fail on an effect writing outside its write set")
+	}
+	for _, want := range []string{`"pay"`, `"paid"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q should mention %s", err, want)
+		}
+	}
+	if strings.Contains(err.Error(), "touch") {
+		t.Errorf("error %q blames an event that changes nothing", err)
+	}
+}
+
+func TestEnumDefault(t *testing.T) {
+	b := gsm.NewRegistry("defaults")
+	status := b.Enum("status", "draft", "pending", "done")
+	level := b.Enum("level", "low", "high")
+	b.Event("finish").
+		Writes(status).
+		Apply(func(s gsm.State) gsm.State { return s.Set(status, "done") }).
+		Add()
+
+	b.EnumDefault(status, "done").EnumDefault(status, "pending")
+	b.InitialState(func(s gsm.State) gsm.State {
+		if s.Get(status) != "pending" {
+			t.Errorf("setup should see the default, got %s", s)
+		}
+		return s.Set(level, "high")
+	})
+
+	m, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	s := m.NewState()
+	if s.Get(status) != "pending" || s.Get(level) != "high" {
+		t.Fatalf("NewState() = %s, want status=pending, level=high", s)
+	}
+	if report.ReachableCount != 2 {
+		t.Errorf("expected exploration from the default state, got %d reachable", report.ReachableCount)
+	}
+
+	for name, fn := range map[string]func(){
+		"unknown label": func() { b.EnumDefault(status, "archived") },
+		"not an enum":   func() { b.EnumDefault(b.Bool("flag"), "true") },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+func TestVerifiedPairs(t *testing.T) {
+	m, report := buildOrderMachine(t)
+	pairs := m.VerifiedPairs()
+	if len(pairs) != report.PairsTotal {
+		t.Fatalf("expected %d verified pairs, got %v", report.PairsTotal, pairs)
+	}
+	for _, p := range pairs {
+		if p.Method != "disjoint" {
+			t.Errorf("expected %s/%s proved disjoint, got %q", p.Event1, p.Event2, p.Method)
+		}
+		if p.Event1 != "restock" && p.Event2 != "restock" {
+			t.Errorf("unexpected pair %s/%s", p.Event1, p.Event2)
+		}
+	}
+
+	m, _, err := buildGatedIncrements().CCOverReachable().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := gsm.VerifiedPair{Event1: "inc_one", Event2: "inc_two", Method: "brute-reachable"}
+	if pairs := m.VerifiedPairs(); len(pairs) != 1 || pairs[0] != want {
+		t.Fatalf("got %v, want [%v]", pairs, want)
+	}
+
+	m, _, err = newOrderRegistry().CheckSelfPairs().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	self := 0
+	for _, p := range m.VerifiedPairs() {
+		if p.Method == "self" {
+			self++
+		}
+	}
+	if self != 5 {
+		t.Errorf("expected 5 self proofs, got %d", self)
+	}
+}
+
+func TestStrictSet(t *testing.T) {
+	// restock saturates inventory at 5 by relying on SetInt clamping.
+	if _, _, err := newOrderRegistry().Build(); err != nil {
+		t.Fatalf("non-strict build failed: %v", err)
+	}
+	_, _, err := newOrderRegistry().StrictSet().Build()
+	if err == nil {
+		t.Fatal("expected strict build to reject the clamped SetInt in restock")
+	}
+	if !strings.Contains(err.Error(), `"inventory" value 6 out of range [0, 5]`) {
+		t.Errorf("unexpected error: %v", err)
+	}
+
+	// Other panics from closures are not swallowed.
+	b := gsm.NewRegistry("panicky")
+	mode := b.Enum("mode", "a", "b")
+	b.Event("bad").
+		Writes(mode).
+		Apply(func(s gsm.State) gsm.State { return s.Set(mode, "c") }).
+		Add()
+	func() {
+		defer func() {
+			if recover() == nil {
+				t.Error("expected Set panic to propagate from a strict build")
+			}
+		}()
+		_, _, _ = b.StrictSet().Build()
+	}()
+}
+
+func TestStateStrict(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	inv, _ := m.Var("inventory")
+
+	if got := m.NewState().SetInt(inv, 9).GetInt(inv); got != 5 {
+		t.Fatalf("non-strict SetInt should clamp, got %d", got)
+	}
+
+	s := m.NewState().Strict().SetInt(inv, 3) // in range: fine
+	defer func() {
+		if recover() == nil {
+			t.Error("expected strict SetInt to panic")
+		}
+	}()
+	s.SetInt(inv, 9) // strictness carries over from Strict()
+}
+
+func TestNormalizeID(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+
+	// 64 encodings (6 bits): in range, including malformed ones.
+	for id := uint64(0); id < 64; id++ {
+		got, err := m.NormalizeID(id)
+		if err != nil {
+			t.Fatalf("NormalizeID(%d): %v", id, err)
+		}
+		if got != m.NormalizeRaw(id) || !m.IsValid(m.StateFromID(got)) {
+			t.Fatalf("NormalizeID(%d) = %d, not a valid normal form", id, got)
+		}
+	}
+
+	for _, id := range []uint64{64, 1 << 40, ^uint64(0)} {
+		if _, err := m.NormalizeID(id); err == nil {
+			t.Errorf("expected error for out-of-range ID %d", id)
+		}
+	}
+}
+
+func TestRequireAllVarsWritten(t *testing.T) {
+	if _, report, err := newOrderRegistry().RequireAllVarsWritten().Build(); err != nil {
+		t.Fatalf("order machine uses every variable: %v\n%s", err, report)
+	}
+
+	b := newOrderRegistry()
+	b.Enum("region", "us", "eu")
+	if _, _, err := b.Build(); err != nil {
+		t.Fatalf("orphan variables are allowed by default: %v", err)
+	}
+	_, _, err := b.RequireAllVarsWritten().Build()
+	if err == nil || !strings.Contains(err.Error(), `"region"`) {
+		t.Fatalf("expected error naming region, got %v", err)
+	}
+}
+
+func TestExplainPair(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	ex, err := m.ExplainPair("restock", "place_order")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ex.Method != "disjoint" || ex.StatesChecked != 0 || len(ex.Samples) != 0 {
+		t.Errorf("expected a disjointness proof with no samples, got %+v", ex)
+	}
+	if _, err := m.ExplainPair("ship_item", "restock"); err == nil {
+		t.Error("expected error for an undeclared pair")
+	}
+	if _, err := m.ExplainPair("refund", "restock"); err == nil {
+		t.Error("expected error for an unknown event")
+	}
+
+	m, _, err = buildGatedIncrements().CCOverReachable().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	ex, err = m.ExplainPair("inc_two", "inc_one")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ex.Method != "brute-reachable" || ex.StatesChecked != len(m.ReachableStates()) {
+		t.Fatalf("unexpected explanation %+v", ex)
+	}
+	if len(ex.Samples) == 0 || ex.Samples[0].State.ID() != m.NewState().ID() {
+		t.Fatalf("expected samples starting at the initial state, got %v", ex.Samples)
+	}
+	for _, s := range ex.Samples {
+		if s.Result1.ID() != s.Result2.ID() {
+			t.Errorf("sample %s: orderings differ", s.State)
+		}
+	}
+
+	// Brute-force CC covers every valid encoding, normal form or not, and
+	// conditional pairs cover those their condition admits.
+	b := gsm.NewRegistry("explained")
+	x := b.Int("x", 0, 4)
+	b.Invariant("x_small").Watches(x).
+		Holds(func(s gsm.State) bool { return s.GetInt(x) <= 3 }).
+		Repair(func(s gsm.State) gsm.State { return s.SetInt(x, 0) }).
+		Add()
+	b.Event("reset").Writes(x).Apply(func(s gsm.State) gsm.State { return s.SetInt(x, 0) }).Add()
+	b.Event("clear").Writes(x).Apply(func(s gsm.State) gsm.State { return s.SetInt(x, 0) }).Add()
+	b.Event("shrink").Writes(x).Apply(func(s gsm.State) gsm.State { return s.SetInt(x, s.GetInt(x)/2) }).Add()
+	b.Independent("reset", "clear")
+	b.IndependentWhen("shrink", "reset", func(s gsm.State) bool { return s.GetInt(x) >= 3 })
+	m, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v\n%s", err, report)
+	}
+	ex, err = m.ExplainPair("clear", "reset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ex.Method != "brute" || ex.StatesChecked != report.StateCount {
+		t.Errorf("brute pair: %s over %d states, want brute over all %d", ex.Method, ex.StatesChecked, report.StateCount)
+	}
+	if n := len(ex.Samples); n != report.StateCount || ex.Samples[n-1].State.GetInt(x) != 4 {
+		t.Errorf("brute samples should run in ID order through the violating x=4: %v", ex.Samples)
+	}
+	ex, err = m.ExplainPair("shrink", "reset")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ex.Method != "conditional" || ex.StatesChecked != 2 || len(ex.Samples) != 2 {
+		t.Errorf("conditional pair: %+v, want the 2 states with x >= 3", ex)
+	}
+}
+
+func TestApplyPatch(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	status, _ := m.Var("status")
+	inventory, _ := m.Var("inventory")
+
+	s, err := m.ApplyPatch(m.NewState(), map[string]interface{}{"inventory": 3.0, "status": "paid", "paid": true})
+	if err != nil {
+		t.Fatalf("ApplyPatch failed: %v", err)
+	}
+	if s.Get(status) != "paid" || s.GetInt(inventory) != 3 {
+		t.Fatalf("unexpected patched state %s", s)
+	}
+
+	// Shipping without payment is repaired back to pending.
+	s, err = m.ApplyPatch(m.NewState(), map[string]interface{}{"status": "shipped"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !m.IsValid(s) || s.Get(status) != "pending" {
+		t.Fatalf("expected repaired state, got %s", s)
+	}
+
+	base := m.Apply(m.NewState(), "restock")
+	for name, patch := range map[string]map[string]interface{}{
+		"unknown field": {"inventory": 2, "colour": "red"},
+		"type mismatch": {"inventory": "two"},
+		"unknown label": {"status": "lost"},
+		"out of range":  {"inventory": 9},
+	} {
+		if got, err := m.ApplyPatch(base, patch); err == nil {
+			t.Errorf("%s: expected error, got %s", name, got)
+		}
+	}
+	if base.GetInt(inventory) != 1 {
+		t.Fatal("a failed patch must not change the input state")
+	}
+}
+
+func TestEnumGroupsCopiesMap(t *testing.T) {
+	b := newOrderRegistry()
+	status := b.Enum("phase", "draft", "final")
+	groups := map[string][]string{"open": {"draft"}}
+	b.EnumGroups(status, groups)
+
+	// Changes after the declaration must not reach it.
+	groups["open"][0] = "final"
+	groups["closed"] = []string{"unknown_label"}
+
+	m, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v\n%s", err, report)
+	}
+	s := m.NewState()
+	if !m.InGroup(s, status, "open") || m.InGroup(s, status, "closed") {
+		t.Errorf("groups of %s changed after EnumGroups", s)
+	}
+}
+
+func TestEnumGroupsExhaustive(t *testing.T) {
+	// Var handles are positional, so one from any build of the order
+	// registry works for a fresh copy.
+	base, _ := buildOrderMachine(t)
+	status, _ := base.Var("status")
+
+	build := func(exhaustive bool, groups map[string][]string) (*gsm.Machine, gsm.Var, error) {
+		b := newOrderRegistry()
+		if exhaustive {
+			b.EnumGroupsExhaustive(status, groups)
+		} else {
+			b.EnumGroups(status, groups)
+		}
+		m, _, err := b.Build()
+		return m, status, err
+	}
+
+	m, status, err := build(true, map[string][]string{
+		"open":   {"pending", "paid"},
+		"closed": {"shipped", "cancelled"},
+	})
+	if err != nil {
+		t.Fatalf("partition rejected: %v", err)
+	}
+	s := m.NewState()
+	if !m.InGroup(s, status, "open") || m.InGroup(s, status, "closed") || m.InGroup(s, status, "other") {
+		t.Fatalf("wrong group membership for %s", s)
+	}
+	if !m.InGroup(m.Apply(s, "cancel_order"), status, "closed") {
+		t.Fatal("cancelled should be closed")
+	}
+
+	_, _, err = build(true, map[string][]string{
+		"open":   {"pending", "paid"},
+		"closed": {"paid", "cancelled"},
+	})
+	if err == nil || !strings.Contains(err.Error(), "uncovered: [shipped]") || !strings.Contains(err.Error(), "in several groups: [paid]") {
+		t.Fatalf("expected uncovered and double-covered labels, got %v", err)
+	}
+
+	// Non-exhaustive groups may overlap and leave labels out.
+	if _, _, err := build(false, map[string][]string{"billable": {"paid", "shipped"}, "live": {"paid"}}); err != nil {
+		t.Fatalf("overlapping groups rejected: %v", err)
+	}
+	if _, _, err := build(false, map[string][]string{"bad": {"refunded"}}); err == nil {
+		t.Fatal("expected error for unknown label")
+	}
+}
+
+func TestVarCoupling(t *testing.T) {
+	b := gsm.NewRegistry("coupled")
+	mode := b.Enum("mode", "off", "on")
+	a := b.Bool("a")
+	c := b.Bool("c")
+	b.Bool("idle")
+	b.Invariant("a_needs_on").
+		Watches(mode, a).
+		Holds(func(s gsm.State) bool { return !s.GetBool(a) || s.Get(mode) == "on" }).
+		Repair(func(s gsm.State) gsm.State { return s.SetBool(a, false) }).
+		Add()
+	b.Invariant("c_needs_on").
+		Watches(mode, c).
+		Holds(func(s gsm.State) bool { return !s.GetBool(c) || s.Get(mode) == "on" }).
+		Repair(func(s gsm.State) gsm.State { return s.SetBool(c, false) }).
+		Add()
+	b.Event("set_a").Writes(a).Apply(func(s gsm.State) gsm.State { return s.SetBool(a, true) }).Add()
+	b.Event("set_c").Writes(c).Apply(func(s gsm.State) gsm.State { return s.SetBool(c, true) }).Add()
+
+	_, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	want := map[string]int{"mode": 2, "a": 1, "c": 1, "idle": 0}
+	if !reflect.DeepEqual(report.VarCoupling, want) {
+		t.Errorf("VarCoupling = %v, want %v", report.VarCoupling, want)
+	}
+	if !strings.Contains(report.String(), "Shared variables: mode (2)") {
+		t.Errorf("report does not list the shared variable:\n%s", report)
+	}
+}
+
+func TestAbsorbing(t *testing.T) {
+	build := func(guardReopen bool) (*gsm.Report, error) {
+		b := gsm.NewRegistry("terminal")
+		status := b.Enum("status", "open", "closed")
+		touched := b.Bool("touched")
+		b.Event("close").
+			Writes(status).
+			Apply(func(s gsm.State) gsm.State { return s.Set(status, "closed") }).
+			Add()
+		eb := b.Event("reopen").Writes(status)
+		if guardReopen {
+			eb.Guard(func(s gsm.State) bool { return s.Get(status) != "closed" })
+		}
+		eb.Apply(func(s gsm.State) gsm.State { return s.Set(status, "open") }).Add()
+		b.Event("touch").
+			Writes(touched).
+			Guard(func(s gsm.State) bool { return s.Get(status) == "open" }).
+			Apply(func(s gsm.State) gsm.State { return s.SetBool(touched, true) }).
+			Add()
+		b.Absorbing(status, "closed")
+		_, report, err := b.Build()
+		return report, err
+	}
+
+	if report, err := build(true); err != nil || report.AbsorbingFailure != nil {
+		t.Fatalf("guarded machine should build: %v", err)
+	}
+	report, err := build(false)
+	if err == nil {
+		t.Fatal("expected build to fail when reopen escapes the closed state")
+	}
+	for _, want := range []string{`"reopen"`, "status=closed"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("error %q should mention %s", err, want)
+		}
+	}
+	f := report.AbsorbingFailure
+	if f == nil || f.Event != "reopen" || f.Var != "status" || f.Label != "closed" {
+		t.Fatalf("AbsorbingFailure = %+v, want reopen leaving status=closed", f)
+	}
+	if f.Next.ID() == f.State.ID() {
+		t.Errorf("AbsorbingFailure.Next = State = %s", f.State)
+	}
+	if got := report.Summary(); !strings.Contains(got, "ABSORBING FAIL (reopen leaves status=closed)") {
+		t.Errorf("Summary = %q", got)
+	}
+	if got := report.String(); !strings.Contains(got, "Absorbing: FAIL") || strings.Contains(got, "GUARANTEED") {
+		t.Errorf("String should report the absorbing failure and no guarantee:\n%s", got)
+	}
+}
+
+func TestAbsorbingPanicsOnBadLabel(t *testing.T) {
+	b := gsm.NewRegistry("bad")
+	status := b.Enum("status", "open", "closed")
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for an unknown label")
+		}
+	}()
+	b.Absorbing(status, "archived")
+}
+
+func TestContradictoryGuards(t *testing.T) {
+	b := gsm.NewRegistry("contradictory")
+	status := b.Enum("status", "pending", "paid", "shipped")
+	paid := b.Bool("paid")
+	b.Invariant("shipped_is_paid").
+		Watches(status, paid).
+		Holds(func(s gsm.State) bool { return s.Get(status) != "shipped" || s.GetBool(paid) }).
+		Repair(func(s gsm.State) gsm.State { return s.Set(status, "pending") }).
+		Add()
+	b.Event("pay").
+		Writes(status, paid).
+		Guard(func(s gsm.State) bool { return s.Get(status) == "pending" }).
+		Apply(func(s gsm.State) gsm.State { return s.Set(status, "paid").SetBool(paid, true) }).
+		Add()
+	// Only an invariant-violating state is shipped but unpaid.
+	b.Event("refund_unpaid_shipment").
+		Writes(status).
+		Guard(func(s gsm.State) bool { return s.Get(status) == "shipped" && !s.GetBool(paid) }).
+		Apply(func(s gsm.State) gsm.State { return s.Set(status, "pending") }).
+		Add()
+	b.OnlyDeclaredPairs()
+
+	_, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	if got := report.ContradictoryGuards; len(got) != 1 || got[0] != "refund_unpaid_shipment" {
+		t.Errorf("ContradictoryGuards = %v, want [refund_unpaid_shipment]", got)
+	}
+	if !strings.Contains(report.String(), "refund_unpaid_shipment") {
+		t.Errorf("report does not mention the contradictory guard:\n%s", report)
+	}
+}
+
+func TestMinimalRepairPath(t *testing.T) {
+	b := gsm.NewRegistry("repairs")
+	a := b.Bool("a")
+	c := b.Bool("c")
+	b.Invariant("not_both").
+		Watches(a, c).
+		Holds(func(s gsm.State) bool { return !(s.GetBool(a) && s.GetBool(c)) }).
+		Repair(func(s gsm.State) gsm.State { return s.SetBool(a, false) }).
+		Add()
+	b.Invariant("c_off").
+		Watches(c).
+		Holds(func(s gsm.State) bool { return !s.GetBool(c) }).
+		Repair(func(s gsm.State) gsm.State { return s.SetBool(c, false) }).
+		Add()
+	b.Event("set_a").Writes(a).Apply(func(s gsm.State) gsm.State { return s.SetBool(a, true) }).Add()
+	m, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+
+	both := m.NewState().SetBool(a, true).SetBool(c, true)
+	// Normalize repairs not_both, then c_off; repairing c_off alone suffices.
+	if got := m.Normalize(both); got.GetBool(a) {
+		t.Fatalf("expected Normalize to take the priority path, got %s", got)
+	}
+	if got := m.MinimalRepairPath(both); !reflect.DeepEqual(got, []string{"c_off"}) {
+		t.Errorf("MinimalRepairPath(%s) = %v, want [c_off]", both, got)
+	}
+	if got := m.MinimalRepairPath(m.NewState()); got == nil || len(got) != 0 {
+		t.Errorf("valid state should have an empty path, got %#v", got)
+	}
+}
+
+func TestLimits(t *testing.T) {
+	build := func(limit bool) error {
+		b := gsm.NewRegistry("wide")
+		x := b.Int("x", 0, 1<<21-1)
+		b.Event("inc").Writes(x).Apply(func(s gsm.State) gsm.State { return s.SetInt(x, s.GetInt(x)+1) }).Add()
+		if limit {
+			b.Limits(21, 1<<21)
+		}
+		_, _, err := b.Build()
+		return err
+	}
+
+	if err := build(false); err == nil || !strings.Contains(err.Error(), "21 bits, max 20") {
+		t.Errorf("default limits should reject 21 bits, got %v", err)
+	}
+	if testing.Short() {
+		t.Skip("skipping 21-bit build in short mode")
+	}
+	if err := build(true); err != nil {
+		t.Errorf("raised limits should permit 21 bits: %v", err)
+	}
+}
+
+func TestLimitsStateCount(t *testing.T) {
+	b := gsm.NewRegistry("capped")
+	b.Int("x", 0, 99)
+	b.Limits(0, 50)
+	_, _, err := b.Build()
+	if err == nil || !strings.Contains(err.Error(), "exceeds limit 50") {
+		t.Errorf("expected the configured state limit in the error, got %v", err)
+	}
+}
+
+func TestEachValidState(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+
+	// status (4 labels) × paid (2) × inventory (6 values)
+	n := 0
+	last := -1
+	m.EachValidState(func(s gsm.State) bool {
+		if !m.WellFormed(s) {
+			t.Errorf("visited malformed state %d", s.ID())
+		}
+		if int(s.ID()) <= last {
+			t.Errorf("state %d visited out of order", s.ID())
+		}
+		last = int(s.ID())
+		n++
+		return true
+	})
+	if n != 4*2*6 {
+		t.Errorf("visited %d states, want %d", n, 4*2*6)
+	}
+
+	n = 0
+	m.EachValidState(func(gsm.State) bool {
+		n++
+		return n < 3
+	})
+	if n != 3 {
+		t.Errorf("early exit visited %d states, want 3", n)
+	}
+}
+
+func TestWouldCommute(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	inventory, _ := m.Var("inventory")
+	status, _ := m.Var("status")
+
+	// Another stock source commutes with everything restock commutes with.
+	restockTwo := func(s gsm.State) gsm.State { return s.SetInt(inventory, s.GetInt(inventory)+2) }
+	if ok, f := m.WouldCommute([]gsm.Var{inventory}, restockTwo, []string{"place_order", "process_payment", "restock"}); !ok {
+		t.Errorf("restock_two should commute: %+v", f)
+	}
+
+	// Shrinkage races with shipping, which also needs inventory.
+	shrink := func(s gsm.State) gsm.State { return s.SetInt(inventory, 0) }
+	ok, f := m.WouldCommute([]gsm.Var{inventory}, shrink, []string{"ship_item"})
+	if ok || f == nil {
+		t.Fatal("shrink should not commute with ship_item")
+	}
+	if f.Event1 != "ship_item" || f.Event2 != "(new)" || f.Result1.ID() == f.Result2.ID() {
+		t.Errorf("unexpected counterexample %+v", f)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected panic for an effect writing outside its write set")
+		}
+	}()
+	m.WouldCommute([]gsm.Var{inventory}, func(s gsm.State) gsm.State { return s.Set(status, "paid") }, nil)
+}
+
+func TestIndependentWhen(t *testing.T) {
+	build := func(conditional bool) (*gsm.Machine, error) {
+		// inc_one and inc_two diverge only when x >= 2, where the
+		// combined increment overflows the cap and the repair resets x.
+		b := gsm.NewRegistry("near_cap")
+		x := b.Int("x", 0, 4)
+		b.Invariant("x_bounded").
+			Watches(x).
+			Holds(func(s gsm.State) bool { return s.GetInt(x) <= 3 }).
+			Repair(func(s gsm.State) gsm.State { return s.SetInt(x, 0) }).
+			Add()
+		b.Event("inc_one").Writes(x).Apply(func(s gsm.State) gsm.State { return s.SetInt(x, s.GetInt(x)+1) }).Add()
+		b.Event("inc_two").Writes(x).Apply(func(s gsm.State) gsm.State { return s.SetInt(x, s.GetInt(x)+2) }).Add()
+		if conditional {
+			b.IndependentWhen("inc_one", "inc_two", func(s gsm.State) bool { return s.GetInt(x) < 2 })
+		} else {
+			b.Independent("inc_one", "inc_two")
+		}
+		m, _, err := b.Build()
+		return m, err
+	}
+
+	if _, err := build(false); err == nil {
+		t.Fatal("unconditional independence should fail CC")
+	}
+	m, err := build(true)
+	if err != nil {
+		t.Fatalf("conditional independence should pass: %v", err)
+	}
+	want := []gsm.VerifiedPair{{Event1: "inc_one", Event2: "inc_two", Method: "conditional"}}
+	if got := m.VerifiedPairs(); !reflect.DeepEqual(got, want) {
+		t.Errorf("VerifiedPairs = %v, want %v", got, want)
+	}
+}
+
+func TestEstimate(t *testing.T) {
+	b := gsm.NewRegistry("growing")
+	if bits, states, ok := b.Estimate(); bits != 0 || states != 1 || !ok {
+		t.Errorf("empty registry: Estimate() = %d, %d, %v", bits, states, ok)
+	}
+
+	b.Enum("status", "a", "b", "c")
+	b.Int("n", 0, 9)
+	if bits, states, ok := b.Estimate(); bits != 6 || states != 30 || !ok {
+		t.Errorf("Estimate() = %d, %d, %v; want 6, 30, true", bits, states, ok)
+	}
+
+	b.Int("wide", 0, 1<<16-1)
+	if bits, _, ok := b.Estimate(); bits != 22 || ok {
+		t.Errorf("Estimate() = %d bits, ok=%v; want 22 bits, not buildable", bits, ok)
+	}
+	b.Limits(22, 1<<22)
+	if _, _, ok := b.Estimate(); !ok {
+		t.Error("raised limits should make the estimate buildable")
+	}
+}
+
+func TestInvalidSourcePolicy(t *testing.T) {
+	build := func(policy gsm.InvalidPolicy, set bool) (*gsm.Machine, gsm.Var) {
+		b := gsm.NewRegistry("policy")
+		status := b.Enum("status", "new", "open", "closed") // raw 3 is malformed
+		b.Bool("flag")
+		b.Event("close").Writes(status).Apply(func(s gsm.State) gsm.State { return s.Set(status, "closed") }).Add()
+		b.InitialState(func(s gsm.State) gsm.State { return s.Set(status, "open") })
+		if set {
+			b.InvalidSourcePolicy(policy)
+		}
+		m, report, err := b.Build()
+		if err != nil {
+			t.Fatalf("Build failed: %v\n%s", err, report)
+		}
+		return m, status
+	}
+
+	// status raw value 3, flag true: outside the enum's three labels.
+	const corrupt = 3 | 1<<2
+
+	// The default silently maps the corrupt state to state 0, which looks
+	// like a real state ({status=new, flag=false}).
+	m, _ := build(0, false)
+	if got := m.Apply(m.StateFromID(corrupt), "close"); got.ID() != 0 || !m.WellFormed(got) {
+		t.Errorf("default policy: got %s, expected the silent zero state", got)
+	}
+
+	m, _ = build(gsm.InvalidToSelf, true)
+	if got := m.Apply(m.StateFromID(corrupt), "close"); got.ID() != corrupt || m.WellFormed(got) {
+		t.Errorf("InvalidToSelf: got ID %d, want the corrupt ID %d", got.ID(), corrupt)
+	}
+
+	m, status := build(gsm.InvalidToNormalForm, true)
+	got := m.Apply(m.StateFromID(corrupt), "close")
+	if want := m.Apply(m.Normalize(m.StateFromID(corrupt)), "close"); got.ID() != want.ID() || got.Get(status) != "closed" {
+		t.Errorf("InvalidToNormalForm: got %s, want %s", got, want)
+	}
+}
+
+func TestEventWriteSet(t *testing.T) {
+	machine, _ := buildOrderMachine(t)
+
+	got, ok := machine.EventWriteSet("ship_item")
+	if !ok || !reflect.DeepEqual(got, []string{"status", "inventory"}) {
+		t.Errorf("EventWriteSet(ship_item) = %v, %v; want [status inventory], true", got, ok)
+	}
+	if _, ok := machine.EventWriteSet("no_such_event"); ok {
+		t.Error("EventWriteSet should report false for an unknown event")
+	}
+
+	path := t.TempDir() + "/order.gsm.json"
+	if err := machine.Export(path); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	loaded, err := gsm.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if _, ok := loaded.EventWriteSet("ship_item"); ok {
+		t.Error("loaded machines do not carry write sets")
+	}
+}
+
+func TestEnabledEventsNormalized(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	s, err := m.StateFrom(map[string]interface{}{"status": "shipped", "paid": false})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.IsValid(s) {
+		t.Fatal("shipped and unpaid should violate no_ship_unpaid")
+	}
+
+	// Repair resets status to pending, which enables payment and cancellation.
+	want := []string{"place_order", "process_payment", "cancel_order", "restock"}
+	if got := m.EnabledEventsNormalized(s); !reflect.DeepEqual(got, want) {
+		t.Errorf("EnabledEventsNormalized = %v, want %v", got, want)
+	}
+
+	// Apply evaluates the guard on the raw state, where it fails.
+	status, _ := m.Var("status")
+	if got := m.Apply(s, "process_payment").Get(status); got != "pending" {
+		t.Errorf("Apply on the raw state: status %q, want pending", got)
+	}
+	if got := m.Apply(m.Normalize(s), "process_payment").Get(status); got != "paid" {
+		t.Errorf("Apply on the normal form: status %q, want paid", got)
+	}
+}
+
+func TestRecordWorstRepair(t *testing.T) {
+	newChain := func() *gsm.Registry {
+		b := gsm.NewRegistry("chain")
+		x := b.Int("x", 0, 3)
+		y := b.Int("y", 0, 3)
+		b.Invariant("x_small").
+			Watches(x, y).
+			Holds(func(s gsm.State) bool { return s.GetInt(x) <= 2 }).
+			Repair(func(s gsm.State) gsm.State { return s.SetInt(x, 0).SetInt(y, 3) }).
+			Add()
+		b.Invariant("y_small").
+			Watches(y).
+			Holds(func(s gsm.State) bool { return s.GetInt(y) <= 2 }).
+			Repair(func(s gsm.State) gsm.State { return s.SetInt(y, 0) }).
+			Add()
+		b.Event("bump").
+			Writes(x).
+			Apply(func(s gsm.State) gsm.State { return s.SetInt(x, s.GetInt(x)+1) }).
+			Add()
+		return b
+	}
+
+	_, report, err := newChain().Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if report.WorstRepairChain != nil {
+		t.Errorf("chain recorded without RecordWorstRepair: %v", report.WorstRepairChain)
+	}
+
+	m, report, err := newChain().RecordWorstRepair().Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	if report.MaxRepairLen != 2 {
+		t.Fatalf("MaxRepairLen = %d, want 2", report.MaxRepairLen)
+	}
+	want := []string{"{x=3, y=0}", "{x=0, y=3}", "{x=0, y=0}"}
+	got := make([]string, len(report.WorstRepairChain))
+	for i, s := range report.WorstRepairChain {
+		got[i] = s.String()
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("WorstRepairChain = %v, want %v", got, want)
+	}
+	if last := report.WorstRepairChain[2]; !m.IsValid(last) {
+		t.Errorf("chain ends in %s, which is not a normal form", last)
+	}
+	if !strings.Contains(report.String(), "Worst repair: {x=3, y=0} → {x=0, y=3} → {x=0, y=0}") {
+		t.Errorf("report does not show the chain:\n%s", report)
+	}
+}
+
+func TestStateBuilder(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	status, _ := m.Var("status")
+	paid, _ := m.Var("paid")
+	inventory, _ := m.Var("inventory")
+
+	sb := m.BuildState().SetEnum(status, "shipped").SetBool(paid, true).SetInt(inventory, 9)
+	got := sb.State()
+	want := m.NewState().Set(status, "shipped").SetBool(paid, true).SetInt(inventory, 9)
+	if got.ID() != want.ID() {
+		t.Fatalf("builder state %s, want %s", got, want)
+	}
+	if got.GetInt(inventory) != 5 {
+		t.Errorf("SetInt should clamp, got %d", got.GetInt(inventory))
+	}
+
+	// Later setters do not change states already returned.
+	sb.SetBool(paid, false)
+	if !got.GetBool(paid) || sb.State().GetBool(paid) {
+		t.Error("State must snapshot the builder")
+	}
+
+	for name, fn := range map[string]func(){
+		"unknown label": func() { m.BuildState().SetEnum(status, "archived") },
+		"foreign var":   func() { m.BuildState().SetBool(gsm.NewRegistry("x").Bool("flag"), true) },
+	} {
+		func() {
+			defer func() {
+				if recover() == nil {
+					t.Errorf("%s: expected panic", name)
+				}
+			}()
+			fn()
+		}()
+	}
+}
+
+func TestOrderedEnum(t *testing.T) {
+	build := func(advance, ordered bool) error {
+		b := gsm.NewRegistry("progress")
+		stage := b.Enum("stage", "pending", "paid", "shipped")
+		paid := b.Bool("paid")
+		b.Invariant("paid_matches_stage").
+			Watches(stage, paid).
+			Holds(func(s gsm.State) bool { return s.GetBool(paid) == (s.Get(stage) != "pending") }).
+			Repair(func(s gsm.State) gsm.State {
+				if advance && s.GetBool(paid) {
+					return s.Set(stage, "paid") // catches up with the flag: moves forward
+				}
+				return s.Set(stage, "pending").SetBool(paid, false)
+			}).
+			Add()
+		b.Event("pay").
+			Writes(stage, paid).
+			Guard(func(s gsm.State) bool { return s.Get(stage) == "pending" }).
+			Apply(func(s gsm.State) gsm.State { return s.Set(stage, "paid").SetBool(paid, true) }).
+			Add()
+		if ordered {
+			b.OrderedEnum(stage)
+		}
+		_, _, err := b.Build()
+		return err
+	}
+
+	if err := build(false, true); err != nil {
+		t.Fatalf("rollback-only repair rejected: %v", err)
+	}
+	if err := build(true, false); err != nil {
+		t.Fatalf("advancing repair rejected without OrderedEnum: %v", err)
+	}
+	err := build(true, true)
+	if err == nil {
+		t.Fatal("expected Build to reject a repair that advances an ordered enum")
+	}
+	if want := `invariant "paid_matches_stage" repair advances ordered enum "stage" from "pending" to "paid"`; !strings.Contains(err.Error(), want) {
+		t.Errorf("error %q does not contain %q", err, want)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("expected OrderedEnum on a bool to panic")
+		}
+	}()
+	b := gsm.NewRegistry("bad")
+	b.OrderedEnum(b.Bool("flag"))
+}
+
+func TestEventsByTag(t *testing.T) {
+	b := gsm.NewRegistry("tagged")
+	paid := b.Bool("paid")
+	stock := b.Int("stock", 0, 3)
+	b.Event("pay").Tag("payment").
+		Writes(paid).
+		Apply(func(s gsm.State) gsm.State { return s.SetBool(paid, true) }).
+		Add()
+	b.Event("restock").Tag("inventory").
+		Writes(stock).
+		Apply(func(s gsm.State) gsm.State { return s.SetInt(stock, s.GetInt(stock)+1) }).
+		Add()
+	b.Event("audit").Tag("payment", "inventory").
+		Writes(paid).
+		Apply(func(s gsm.State) gsm.State { return s }).
+		Add()
+	b.Event("noop").
+		Writes(paid).
+		Apply(func(s gsm.State) gsm.State { return s }).
+		Add()
+	m, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+
+	check := func(name string, m *gsm.Machine) {
+		t.Helper()
+		if got := m.EventsByTag("inventory"); !reflect.DeepEqual(got, []string{"restock", "audit"}) {
+			t.Errorf("%s: EventsByTag(inventory) = %v", name, got)
+		}
+		if got := m.EventsByTag("payment"); !reflect.DeepEqual(got, []string{"pay", "audit"}) {
+			t.Errorf("%s: EventsByTag(payment) = %v", name, got)
+		}
+		if got := m.EventsByTag("shipping"); got != nil {
+			t.Errorf("%s: EventsByTag(shipping) = %v, want nil", name, got)
+		}
+	}
+	check("built", m)
+
+	path := t.TempDir() + "/tagged.gsm.json"
+	if err := m.Export(path); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	loaded, err := gsm.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	check("loaded", loaded)
+
+	schema, err := gsm.LoadSchema(path)
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+	if _, ok := schema.EventTags["noop"]; ok || len(schema.EventTags) != 3 {
+		t.Errorf("schema tags = %v, want the three tagged events", schema.EventTags)
+	}
+}
+
+func TestDetectDuplicateStates(t *testing.T) {
+	b := gsm.NewRegistry("notes")
+	stage := b.Enum("stage", "draft", "sent")
+	note := b.Bool("note") // written but never read by a guard
+	b.Event("send").
+		Writes(stage).
+		Guard(func(s gsm.State) bool { return s.Get(stage) == "draft" }).
+		Apply(func(s gsm.State) gsm.State { return s.Set(stage, "sent") }).
+		Add()
+	b.Event("jot").
+		Writes(note).
+		Apply(func(s gsm.State) gsm.State { return s.SetBool(note, !s.GetBool(note)) }).
+		Add()
+
+	_, report, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.DuplicateStates != nil {
+		t.Errorf("duplicates reported without DetectDuplicateStates: %v", report.DuplicateStates)
+	}
+
+	_, report, err = b.DetectDuplicateStates().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, class := range report.DuplicateStates {
+		var members []string
+		for _, s := range class {
+			members = append(members, s.String())
+		}
+		got = append(got, strings.Join(members, " "))
+	}
+	want := []string{
+		"{stage=draft, note=false} {stage=draft, note=true}",
+		"{stage=sent, note=false} {stage=sent, note=true}",
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("DuplicateStates = %v, want %v", got, want)
+	}
+	if !strings.Contains(report.String(), "behaviorally equivalent states: 2 classes covering 4 states") {
+		t.Errorf("report does not mention the duplicates:\n%s", report)
+	}
+
+	// In the order machine, paid stops mattering once an order is
+	// cancelled: nothing reads it before place_order resets it.
+	_, report, err = newOrderRegistry().DetectDuplicateStates().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.DuplicateStates) != 6 {
+		t.Fatalf("got %d classes, want one per inventory level: %v", len(report.DuplicateStates), report.DuplicateStates)
+	}
+	for _, class := range report.DuplicateStates {
+		if len(class) != 2 || !strings.HasPrefix(class[0].String(), "{status=cancelled, paid=false") ||
+			!strings.HasPrefix(class[1].String(), "{status=cancelled, paid=true") {
+			t.Errorf("unexpected class %v", class)
+		}
+	}
+}
+
+func TestVerifyAllPairs(t *testing.T) {
+	newRegistry := func() *gsm.Registry {
+		b := gsm.NewRegistry("racing")
+		mode := b.Enum("mode", "a", "b")
+		seen := b.Bool("seen")
+		// A trivial invariant on mode puts the setters' footprints in
+		// conflict, so their pair needs a brute-force check.
+		b.Invariant("mode_set").
+			Watches(mode).
+			Holds(func(gsm.State) bool { return true }).
+			Repair(func(s gsm.State) gsm.State { return s }).
+			Add()
+		b.Event("set_a").Writes(mode).Apply(func(s gsm.State) gsm.State { return s.Set(mode, "a") }).Add()
+		b.Event("set_b").Writes(mode).Apply(func(s gsm.State) gsm.State { return s.Set(mode, "b") }).Add()
+		b.Event("tick").Writes(seen).Apply(func(s gsm.State) gsm.State { return s.SetBool(seen, true) }).Add()
+		b.Independent("set_a", "tick")
+		return b
+	}
+
+	// Declaring one pair silently drops the racing (set_a, set_b) pair,
+	// but the report says so.
+	_, report, err := newRegistry().Build()
+	if err != nil {
+		t.Fatalf("declared-only build failed: %v", err)
+	}
+	if report.CCScope != "declared" || report.PairsTotal != 1 || report.PairsUnchecked != 2 {
+		t.Errorf("scope %q, %d checked, %d unchecked; want declared, 1, 2",
+			report.CCScope, report.PairsTotal, report.PairsUnchecked)
+	}
+	if !strings.Contains(report.String(), "Scope: declared pairs only (2 unchecked") {
+		t.Errorf("report should state the declared scope:\n%s", report)
+	}
+
+	_, report, err = newRegistry().VerifyAllPairs().Build()
+	if err == nil {
+		t.Fatal("VerifyAllPairs should catch the undeclared racing pair")
+	}
+	if f := report.CCFailure; f == nil || f.Event1 != "set_a" || f.Event2 != "set_b" {
+		t.Errorf("CCFailure = %+v, want (set_a, set_b)", f)
+	}
+	if report.CCScope != "all" || report.PairsUnchecked != 0 {
+		t.Errorf("scope %q with %d unchecked, want all with 0", report.CCScope, report.PairsUnchecked)
+	}
+
+	// IndependentWhen conditions do not narrow an all-pairs check.
+	b := newRegistry()
+	b.IndependentWhen("set_a", "set_b", func(gsm.State) bool { return false })
+	if _, _, err := b.Build(); err != nil {
+		t.Errorf("conditional pair should pass in declared-only mode: %v", err)
+	}
+	b = newRegistry().VerifyAllPairs()
+	b.IndependentWhen("set_a", "set_b", func(gsm.State) bool { return false })
+	if _, _, err := b.Build(); err == nil {
+		t.Error("VerifyAllPairs should ignore IndependentWhen conditions")
+	}
+
+	// Without declarations every pair is checked by default.
+	b = gsm.NewRegistry("plain")
+	flag := b.Bool("flag")
+	b.Event("on").Writes(flag).Apply(func(s gsm.State) gsm.State { return s.SetBool(flag, true) }).Add()
+	b.Event("noop").Apply(func(s gsm.State) gsm.State { return s }).Add()
+	_, report, err = b.Build()
+	if err != nil || report.CCScope != "all" || !strings.Contains(report.String(), "Scope: all event pairs") {
+		t.Errorf("default build should check all pairs: scope %q, err %v", report.CCScope, err)
+	}
+}
+
+func TestMachineStats(t *testing.T) {
+	m, report := buildOrderMachine(t)
+	st := m.Stats()
+	want := gsm.MachineStats{
+		VarCount:       3,
+		EventCount:     5,
+		InvariantCount: 2,
+		TotalBits:      6, // 2 status + 1 paid + 3 inventory
+		ReachableCount: report.ReachableCount,
+		MaxRepairDepth: report.MaxRepairLen,
+	}
+	if st != want {
+		t.Errorf("Stats = %+v, want %+v", st, want)
+	}
+	if st.ReachableCount != len(m.ReachableStates()) {
+		t.Errorf("ReachableCount = %d, want %d", st.ReachableCount, len(m.ReachableStates()))
+	}
+
+	path := filepath.Join(t.TempDir(), "order.json")
+	if err := m.Export(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := gsm.Load(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want.InvariantCount, want.ReachableCount = 0, 0
+	if got := loaded.Stats(); got != want {
+		t.Errorf("loaded Stats = %+v, want %+v", got, want)
+	}
+}
+
+func TestDetectAsymmetricPairs(t *testing.T) {
+	_, report := buildOrderMachine(t)
+	if report.AsymmetricPairs != nil {
+		t.Errorf("AsymmetricPairs recorded without DetectAsymmetricPairs: %v", report.AsymmetricPairs)
+	}
+	_, report, err := newOrderRegistry().DetectAsymmetricPairs().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.AsymmetricPairs) != 0 {
+		t.Errorf("order machine pairs should be symmetric: %+v", report.AsymmetricPairs)
+	}
+
+	// fire needs arm first. With no invariants the pair is proved
+	// disjoint, but their guards make it a causal order.
+	b := gsm.NewRegistry("trigger")
+	armed := b.Bool("armed")
+	shot := b.Bool("shot")
+	b.Event("arm").Writes(armed).Apply(func(s gsm.State) gsm.State { return s.SetBool(armed, true) }).Add()
+	b.Event("fire").
+		Writes(shot).
+		Guard(func(s gsm.State) bool { return s.GetBool(armed) }).
+		Apply(func(s gsm.State) gsm.State { return s.SetBool(shot, true) }).
+		Add()
+	b.Independent("arm", "fire")
+	_, report, err = b.DetectAsymmetricPairs().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.AsymmetricPairs) != 1 {
+		t.Fatalf("AsymmetricPairs = %+v, want one", report.AsymmetricPairs)
+	}
+	a := report.AsymmetricPairs[0]
+	if a.Event1 != "arm" || a.Event2 != "fire" || !a.Fired1 || a.Fired2 || a.State.GetBool(armed) {
+		t.Errorf("AsymmetricPair = %+v, want arm→fire firing from unarmed", a)
+	}
+	if !strings.Contains(report.String(), "asymmetric pair (arm, fire)") {
+		t.Errorf("report should warn about the asymmetric pair:\n%s", report)
+	}
+}
+
+func TestApplyMany(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	reachable := m.ReachableStates()
+	ids := make([]uint64, len(reachable))
+	for i, s := range reachable {
+		ids[i] = s.ID()
+	}
+
+	got := m.ApplyMany(ids, "restock")
+	for i, s := range reachable {
+		if want := m.Apply(s, "restock").ID(); got[i] != want {
+			t.Fatalf("ApplyMany[%d] = %d, want %d", i, got[i], want)
+		}
+	}
+	if ids[1] != reachable[1].ID() {
+		t.Error("ApplyMany without InPlace modified its input")
+	}
+
+	inPlace := m.ApplyMany(ids, "restock", gsm.InPlace())
+	if &inPlace[0] != &ids[0] || !reflect.DeepEqual(ids, got) {
+		t.Error("InPlace should overwrite and return the input slice")
+	}
+	if out := m.ApplyMany(nil, "restock"); len(out) != 0 {
+		t.Errorf("ApplyMany(nil) = %v, want empty", out)
+	}
+}
+
+func TestInvariantCouples(t *testing.T) {
+	b := gsm.NewRegistry("coupled")
+	status := b.Enum("status", "pending", "shipped")
+	inventory := b.Int("inventory", 0, 3)
+	b.Invariant("shipped_decrements").
+		Couples(status, inventory, func(label string, n int) bool {
+			return label != "shipped" || n < 3
+		}).
+		Repair(func(s gsm.State) gsm.State { return s.SetInt(inventory, 2) }).
+		Add()
+	b.Event("ship").Writes(status).Apply(func(s gsm.State) gsm.State { return s.Set(status, "shipped") }).Add()
+	b.Event("restock").
+		Writes(inventory).
+		Guard(func(s gsm.State) bool { return s.GetInt(inventory) < 3 }).
+		Apply(func(s gsm.State) gsm.State { return s.SetInt(inventory, s.GetInt(inventory)+1) }).
+		Add()
+	b.Independent("ship", "restock")
+
+	m, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v\n%s", err, report)
+	}
+	// The pair writes different variables, but both are in the coupling
+	// invariant's footprint, so it cannot be proved disjoint.
+	if report.PairsBrute != 1 || report.PairsDisjoint != 0 {
+		t.Errorf("pairs: %d brute, %d disjoint; want 1 brute", report.PairsBrute, report.PairsDisjoint)
+	}
+	full := m.NewState().SetInt(inventory, 3)
+	if got := m.Apply(full, "ship"); got.GetInt(inventory) != 2 {
+		t.Errorf("ship at full stock = %s, want inventory repaired to 2", got)
+	}
+	if ok, _ := m.Check(full.Set(status, "shipped")); ok {
+		t.Error("shipped with inventory 3 should violate the coupling")
+	}
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "not an enum") {
+			t.Errorf("Couples with an int as the enum: recover = %v", r)
+		}
+	}()
+	b.Invariant("swapped").Couples(inventory, inventory, func(string, int) bool { return true })
+}
+
+func TestRecordRepairHistogram(t *testing.T) {
+	newChain := func() *gsm.Registry {
+		b := gsm.NewRegistry("chain")
+		x := b.Int("x", 0, 3)
+		y := b.Int("y", 0, 3)
+		b.Invariant("x_small").
+			Watches(x, y).
+			Holds(func(s gsm.State) bool { return s.GetInt(x) <= 2 }).
+			Repair(func(s gsm.State) gsm.State { return s.SetInt(x, 0).SetInt(y, 3) }).
+			Add()
+		b.Invariant("y_small").
+			Watches(y).
+			Holds(func(s gsm.State) bool { return s.GetInt(y) <= 2 }).
+			Repair(func(s gsm.State) gsm.State { return s.SetInt(y, 0) }).
+			Add()
+		return b
+	}
+
+	_, report, err := newChain().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.RepairHistogram != nil {
+		t.Errorf("histogram recorded without RecordRepairHistogram: %v", report.RepairHistogram)
+	}
+
+	_, report, err = newChain().RecordRepairHistogram().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 9 states satisfy both invariants, 3 only need y repaired, and the 4
+	// with x = 3 go through both repairs.
+	if want := []int{9, 3, 4}; !reflect.DeepEqual(report.RepairHistogram, want) {
+		t.Errorf("RepairHistogram = %v, want %v", report.RepairHistogram, want)
+	}
+	if len(report.RepairHistogram) != report.MaxRepairLen+1 {
+		t.Errorf("histogram has %d depths, want MaxRepairLen+1 = %d", len(report.RepairHistogram), report.MaxRepairLen+1)
+	}
+	if !strings.Contains(report.String(), "Repair depths: 0:9 1:3 2:4") {
+		t.Errorf("report should print the histogram:\n%s", report)
+	}
+}
+
+func TestFixpoint(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	inventory, _ := m.Var("inventory")
+
+	// restock saturates at the top of the inventory range.
+	s, n, ok := m.Fixpoint(m.NewState(), "restock", 0)
+	if !ok || n != 5 || s.GetInt(inventory) != 5 {
+		t.Errorf("Fixpoint(restock) = %s, %d, %v; want inventory=5 after 5, converged", s, n, ok)
+	}
+	if again, n, ok := m.Fixpoint(s, "restock", 0); !ok || n != 0 || again.ID() != s.ID() {
+		t.Errorf("Fixpoint at the fixpoint = %s, %d, %v; want itself, 0, true", again, n, ok)
+	}
+	if s, n, ok := m.Fixpoint(m.NewState(), "restock", 3); ok || n != 3 || s.GetInt(inventory) != 3 {
+		t.Errorf("Fixpoint(restock, 3) = %s, %d, %v; want inventory=3 after 3, not converged", s, n, ok)
+	}
+
+	// toggle flips a flag forever.
+	b := gsm.NewRegistry("toggle")
+	on := b.Bool("on")
+	b.Event("toggle").Writes(on).Apply(func(s gsm.State) gsm.State { return s.SetBool(on, !s.GetBool(on)) }).Add()
+	toggle, _, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, n, ok := toggle.Fixpoint(toggle.NewState(), "toggle", 0); ok || n != 2 {
+		t.Errorf("Fixpoint(toggle) = %d, %v; want 2 applications (the encoding count), not converged", n, ok)
+	}
+}
+
+func TestDetectRepairConflicts(t *testing.T) {
+	_, report, err := newOrderRegistry().DetectRepairConflicts().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.RepairConflicts) != 0 {
+		t.Errorf("order machine repairs touch disjoint variables: %+v", report.RepairConflicts)
+	}
+
+	var x gsm.Var
+	newRegistry := func() *gsm.Registry {
+		b := gsm.NewRegistry("competing")
+		x = b.Int("x", 0, 3)
+		b.Invariant("x_capped").
+			Watches(x).
+			Holds(func(s gsm.State) bool { return s.GetInt(x) <= 2 }).
+			Repair(func(s gsm.State) gsm.State { return s.SetInt(x, 2) }).
+			Add()
+		b.Invariant("x_even").
+			Watches(x).
+			Holds(func(s gsm.State) bool { return s.GetInt(x)%2 == 0 }).
+			Repair(func(s gsm.State) gsm.State { return s.SetInt(x, 0) }).
+			Add()
+		return b
+	}
+	_, report, err = newRegistry().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if report.RepairConflicts != nil {
+		t.Errorf("conflicts recorded without DetectRepairConflicts: %+v", report.RepairConflicts)
+	}
+
+	_, report, err = newRegistry().DetectRepairConflicts().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.RepairConflicts) != 1 {
+		t.Fatalf("RepairConflicts = %+v, want one", report.RepairConflicts)
+	}
+	c := report.RepairConflicts[0]
+	if c.Invariant1 != "x_capped" || c.Invariant2 != "x_even" || c.Var != "x" ||
+		c.State.GetInt(x) != 3 || c.Repair1.GetInt(x) != 2 || c.Repair2.GetInt(x) != 0 {
+		t.Errorf("RepairConflict = %+v, want x_capped (x=2) vs x_even (x=0) at x=3", c)
+	}
+	if !strings.Contains(report.String(), "repair conflict on x: x_capped and x_even") {
+		t.Errorf("report should warn about the conflict:\n%s", report)
+	}
+}
+
+func TestSetRawIntWraps(t *testing.T) {
+	b := gsm.NewRegistry("wrapping")
+	counter := b.Int("counter", 0, 7)
+	b.Event("tick").
+		Writes(counter).
+		Apply(func(s gsm.State) gsm.State { return s.SetRawInt(counter, s.GetInt(counter)+1) }).
+		Add()
+	b.Event("back").
+		Writes(counter).
+		Apply(func(s gsm.State) gsm.State { return s.SetRawInt(counter, s.GetInt(counter)-1) }).
+		Add()
+
+	m, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v\n%s", err, report)
+	}
+	s := m.NewState()
+	for i := 1; i <= 10; i++ {
+		s = m.Apply(s, "tick")
+		if got, want := s.GetInt(counter), i%8; got != want {
+			t.Fatalf("after %d ticks counter = %d, want %d", i, got, want)
+		}
+	}
+	if got := m.Apply(m.NewState(), "back").GetInt(counter); got != 7 {
+		t.Errorf("back from 0 = %d, want 7", got)
+	}
+	if n := len(m.ReachableStates()); n != 8 {
+		t.Errorf("reachable states = %d, want all 8", n)
+	}
+	// SetInt still clamps.
+	if got := m.NewState().SetInt(counter, 8).GetInt(counter); got != 7 {
+		t.Errorf("SetInt(8) = %d, want clamped 7", got)
+	}
+
+	// On a domain that is not a power of two, a wrapped write can land on a
+	// padding encoding; clampState moves it to the maximum.
+	b = gsm.NewRegistry("padded")
+	level := b.Int("level", 1, 5) // 3 bits, raw 0..4 in use
+	b.Event("up").
+		Writes(level).
+		Apply(func(s gsm.State) gsm.State { return s.SetRawInt(level, s.GetInt(level)+1) }).
+		Add()
+	m, report, err = b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v\n%s", err, report)
+	}
+	top := m.NewState().SetInt(level, 5)
+	if got := m.Apply(top, "up").GetInt(level); got != 5 {
+		t.Errorf("up from 5 = %d, want the padding encoding clamped to 5", got)
+	}
+
+	defer func() {
+		if r := recover(); r == nil || !strings.Contains(fmt.Sprint(r), "SetRawInt") {
+			t.Errorf("SetRawInt on an IntSet: recover = %v", r)
+		}
+	}()
+	sizes := gsm.NewRegistry("sizes").IntSet("size", 1, 2, 4)
+	m.NewState().SetRawInt(sizes, 2)
+}
+
+func TestApplyBatch(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+
+	// restock is independent of both: any order gives the declaration-order result.
+	s := m.Apply(m.NewState(), "place_order")
+	got, err := m.ApplyBatch(s, []string{"restock", "process_payment"})
+	if err != nil {
+		t.Fatalf("ApplyBatch: %v", err)
+	}
+	if want := m.Apply(m.Apply(s, "process_payment"), "restock"); got.ID() != want.ID() {
+		t.Errorf("batch = %s, want %s", got, want)
+	}
+	if other := m.Apply(m.Apply(s, "restock"), "process_payment"); got.ID() != other.ID() {
+		t.Errorf("batch = %s, reverse order gives %s", got, other)
+	}
+	if got, err := m.ApplyBatch(s, []string{"restock", "restock"}); err != nil || got.ID() != m.Apply(m.Apply(s, "restock"), "restock").ID() {
+		t.Errorf("repeated event: %s, %v", got, err)
+	}
+	if got, err := m.ApplyBatch(s, nil); err != nil || got.ID() != s.ID() {
+		t.Errorf("empty batch: %s, %v", got, err)
+	}
+
+	if _, err := m.ApplyBatch(s, []string{"process_payment", "restock", "ship_item"}); err == nil || !strings.Contains(err.Error(), `"process_payment" and "ship_item"`) {
+		t.Errorf("unverified pair: err = %v", err)
+	}
+	if _, err := m.ApplyBatch(s, []string{"restock", "refund"}); err == nil || !strings.Contains(err.Error(), "unknown event") {
+		t.Errorf("unknown event: err = %v", err)
+	}
+
+	// Conditional proofs do not cover every state, so they are refused.
+	b := gsm.NewRegistry("conditional")
+	x := b.Int("x", 0, 3)
+	b.Invariant("bounded").Watches(x).
+		Holds(func(s gsm.State) bool { return s.GetInt(x) <= 3 }).
+		Repair(func(s gsm.State) gsm.State { return s.SetInt(x, 3) }).
+		Add()
+	b.Event("inc").Writes(x).Apply(func(s gsm.State) gsm.State { return s.SetInt(x, s.GetInt(x)+1) }).Add()
+	b.Event("dec").Writes(x).Apply(func(s gsm.State) gsm.State { return s.SetInt(x, s.GetInt(x)-1) }).Add()
+	b.IndependentWhen("inc", "dec", func(s gsm.State) bool { return s.GetInt(x) == 1 })
+	cm, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build: %v\n%s", err, report)
+	}
+	if vp := cm.VerifiedPairs(); len(vp) != 1 || vp[0].Method != "conditional" {
+		t.Fatalf("VerifiedPairs = %+v, want one conditional pair", vp)
+	}
+	if _, err := cm.ApplyBatch(cm.NewState(), []string{"inc", "dec"}); err == nil {
+		t.Error("ApplyBatch accepted a conditionally proved pair")
+	}
+
+	// Brute-reachable proofs hold only from reachable states.
+	rm, report, err := buildGatedIncrements().CCOverReachable().Build()
+	if err != nil {
+		t.Fatalf("Build: %v\n%s", err, report)
+	}
+	if vp := rm.VerifiedPairs(); len(vp) != 1 || vp[0].Method != "brute-reachable" {
+		t.Fatalf("VerifiedPairs = %+v, want one brute-reachable pair", vp)
+	}
+	if got, err := rm.ApplyBatch(rm.NewState(), []string{"inc_two", "inc_one"}); err != nil || got.ID() != rm.NewState().ID() {
+		t.Errorf("batch from the initial state: %s, %v", got, err)
+	}
+	gx, _ := rm.Var("x")
+	enabled, _ := rm.Var("enabled")
+	unreachable := rm.NewState().SetBool(enabled, true).SetInt(gx, 2)
+	if _, err := rm.ApplyBatch(unreachable, []string{"inc_one", "inc_two"}); err == nil || !strings.Contains(err.Error(), "not reachable") {
+		t.Errorf("batch from an unreachable state: err = %v", err)
+	}
+}
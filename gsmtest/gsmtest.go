@@ -0,0 +1,95 @@
+// Package gsmtest provides test helpers for machines built with gsm.
+package gsmtest
+
+import (
+	"math/rand/v2"
+	"strings"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+// MaxPermutations caps the orderings AssertOrderIndependent tries. Up to
+// this many permutations (7 events) are enumerated exhaustively; beyond
+// that, MaxPermutations orderings are sampled with a fixed seed, so a
+// failure is reproducible from run to run.
+const MaxPermutations = 5040
+
+// T is the subset of testing.TB the helpers use.
+type T interface {
+	Helper()
+	Errorf(format string, args ...any)
+}
+
+// AssertOrderIndependent applies every permutation of events from
+// NewState() and fails t if they do not all end in the same state,
+// reporting the first diverging permutation next to the original order.
+// It exercises the Compensation Commutativity guarantee end to end, so it
+// holds only when every pair of the events is independent. Panics if an
+// event name is unknown.
+func AssertOrderIndependent(t T, m *gsm.Machine, events ...string) {
+	t.Helper()
+	if len(events) < 2 {
+		return
+	}
+	run := func(order []string) gsm.State {
+		s := m.NewState()
+		for _, e := range order {
+			s = m.Apply(s, e)
+		}
+		return s
+	}
+	want := run(events)
+
+	check := func(order []string) bool {
+		if got := run(order); got.ID() != want.ID() {
+			t.Errorf("gsmtest: order dependence:\n  %s → %s\n  %s → %s",
+				strings.Join(events, ", "), want, strings.Join(order, ", "), got)
+			return false
+		}
+		return true
+	}
+
+	order := append([]string(nil), events...)
+	if factorialAtMost(len(events), MaxPermutations) {
+		// Heap's algorithm, iterative form.
+		c := make([]int, len(order))
+		for i := 1; i < len(order); {
+			if c[i] < i {
+				if i%2 == 0 {
+					order[0], order[i] = order[i], order[0]
+				} else {
+					order[c[i]], order[i] = order[i], order[c[i]]
+				}
+				if !check(order) {
+					return
+				}
+				c[i]++
+				i = 1
+			} else {
+				c[i] = 0
+				i++
+			}
+		}
+		return
+	}
+
+	rng := rand.New(rand.NewPCG(1, uint64(len(events))))
+	for n := 0; n < MaxPermutations; n++ {
+		rng.Shuffle(len(order), func(i, j int) { order[i], order[j] = order[j], order[i] })
+		if !check(order) {
+			return
+		}
+	}
+}
+
+// factorialAtMost reports whether n! <= limit.
+func factorialAtMost(n, limit int) bool {
+	f := 1
+	for k := 2; k <= n; k++ {
+		f *= k
+		if f > limit {
+			return false
+		}
+	}
+	return true
+}
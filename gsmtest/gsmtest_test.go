@@ -0,0 +1,68 @@
+package gsmtest_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+	"github.com/blackwell-systems/gsm/gsmtest"
+)
+
+// recorder is a gsmtest.T that captures failures.
+type recorder struct{ errors []string }
+
+func (r *recorder) Helper() {}
+func (r *recorder) Errorf(format string, args ...any) {
+	r.errors = append(r.errors, fmt.Sprintf(format, args...))
+}
+
+// buildCounters builds n independent flag-setting events plus, if
+// withReset is set, a reset event that clears every flag.
+func buildCounters(t *testing.T, n int, withReset bool) *gsm.Machine {
+	t.Helper()
+	b := gsm.NewRegistry("flags")
+	flags := make([]gsm.Var, n)
+	for i := range flags {
+		flags[i] = b.Bool(fmt.Sprintf("f%d", i))
+	}
+	for i, f := range flags {
+		b.Event(fmt.Sprintf("set%d", i)).Writes(f).Apply(func(s gsm.State) gsm.State { return s.SetBool(f, true) }).Add()
+	}
+	if withReset {
+		b.Event("reset").Writes(flags...).Apply(func(s gsm.State) gsm.State {
+			for _, f := range flags {
+				s = s.SetBool(f, false)
+			}
+			return s
+		}).Add()
+	}
+	b.OnlyDeclaredPairs()
+	m, report, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v\n%s", err, report)
+	}
+	return m
+}
+
+func TestAssertOrderIndependent(t *testing.T) {
+	m := buildCounters(t, 4, false)
+	gsmtest.AssertOrderIndependent(t, m, "set0", "set1", "set2", "set3")
+
+	// Beyond the exhaustive cap, orderings are sampled.
+	big := buildCounters(t, 9, false)
+	events := big.Events()
+	gsmtest.AssertOrderIndependent(t, big, events...)
+}
+
+func TestAssertOrderIndependentFails(t *testing.T) {
+	m := buildCounters(t, 2, true)
+	var r recorder
+	gsmtest.AssertOrderIndependent(&r, m, "set0", "reset", "set1")
+	if len(r.errors) != 1 {
+		t.Fatalf("expected one failure, got %v", r.errors)
+	}
+	if !strings.Contains(r.errors[0], "set0, reset, set1") {
+		t.Errorf("failure should show the original order: %s", r.errors[0])
+	}
+}
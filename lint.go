@@ -0,0 +1,153 @@
+package gsm
+
+import "fmt"
+
+// Severity orders lint findings by how much attention they deserve.
+type Severity int
+
+const (
+	SeverityInfo Severity = iota
+	SeverityWarning
+	SeverityError
+)
+
+// String returns the lower-case severity name.
+func (s Severity) String() string {
+	switch s {
+	case SeverityInfo:
+		return "info"
+	case SeverityWarning:
+		return "warning"
+	case SeverityError:
+		return "error"
+	}
+	return fmt.Sprintf("Severity(%d)", int(s))
+}
+
+// Stable lint codes. Tooling may match on these; they will not change.
+const (
+	LintNoOpEvent          = "noop-event"          // event leaves every valid state unchanged
+	LintDeadEvent          = "dead-event"          // event leaves every reachable state unchanged
+	LintDeadlockState      = "deadlock-state"      // reachable state no event can leave
+	LintUnreachableStates  = "unreachable-states"  // valid states not reachable from the initial state
+	LintRedundantInvariant = "redundant-invariant" // invariant holds on every valid encoding
+)
+
+// Lint is a single advisory finding about a machine.
+type Lint struct {
+	Severity Severity
+	Code     string // one of the Lint* constants
+	Message  string
+	State    State // the offending state, or the zero State if not state-specific
+}
+
+// String formats the finding as "severity code: message".
+func (l Lint) String() string {
+	return fmt.Sprintf("%s %s: %s", l.Severity, l.Code, l.Message)
+}
+
+// Lint runs the advisory analyses over the machine and returns their
+// findings: inert and dead events, deadlock states, unreachable valid
+// states, and redundant invariants. None of these affect convergence;
+// callers decide which severities to treat as errors.
+//
+// Redundant-invariant detection needs the invariant closures, so it is
+// skipped for machines obtained from Load.
+func (m *Machine) Lint() []Lint {
+	var lints []Lint
+	mkState := func(id uint64) State { return State{packed: id, vars: m.vars} }
+	names := m.Events()
+	reachable := m.explore().order
+
+	// Events
+	for ei, name := range names {
+		inert := true
+		for i := range m.nf {
+			if m.nf[i] == uint64(i) && validEncoding(m.vars, uint64(i)) && m.step[ei][i] != uint64(i) {
+				inert = false
+				break
+			}
+		}
+		if inert {
+			lints = append(lints, Lint{
+				Severity: SeverityWarning,
+				Code:     LintNoOpEvent,
+				Message:  fmt.Sprintf("event %q leaves every valid state unchanged", name),
+			})
+			continue
+		}
+
+		dead := true
+		for _, id := range reachable {
+			if m.step[ei][id] != id {
+				dead = false
+				break
+			}
+		}
+		if dead {
+			lints = append(lints, Lint{
+				Severity: SeverityWarning,
+				Code:     LintDeadEvent,
+				Message:  fmt.Sprintf("event %q never changes a reachable state", name),
+			})
+		}
+	}
+
+	// Deadlock states
+	for _, id := range reachable {
+		stuck := true
+		for ei := range m.step {
+			if m.step[ei][id] != id {
+				stuck = false
+				break
+			}
+		}
+		if stuck {
+			lints = append(lints, Lint{
+				Severity: SeverityInfo,
+				Code:     LintDeadlockState,
+				Message:  fmt.Sprintf("no event leaves reachable state %s", mkState(id)),
+				State:    mkState(id),
+			})
+		}
+	}
+
+	// Unreachable valid states
+	isReachable := make(map[uint64]bool, len(reachable))
+	for _, id := range reachable {
+		isReachable[id] = true
+	}
+	unreachable := 0
+	for i := range m.nf {
+		if m.nf[i] == uint64(i) && validEncoding(m.vars, uint64(i)) && !isReachable[uint64(i)] {
+			unreachable++
+		}
+	}
+	if unreachable > 0 {
+		lints = append(lints, Lint{
+			Severity: SeverityInfo,
+			Code:     LintUnreachableStates,
+			Message:  fmt.Sprintf("%d valid states are unreachable from the initial state", unreachable),
+		})
+	}
+
+	// Redundant invariants
+	for _, inv := range m.invariants {
+		redundant := true
+		for i := range m.nf {
+			if validEncoding(m.vars, uint64(i)) && !inv.check(mkState(uint64(i))) {
+				redundant = false
+				break
+			}
+		}
+		if redundant {
+			lints = append(lints, Lint{
+				Severity: SeverityWarning,
+				Code:     LintRedundantInvariant,
+				Message:  fmt.Sprintf("invariant %q holds on every valid encoding; its repair never fires", inv.name),
+			})
+		}
+	}
+
+	return lints
+}
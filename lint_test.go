@@ -0,0 +1,86 @@
+package gsm_test
+
+import (
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+func lintCodes(lints []gsm.Lint) map[string]int {
+	codes := make(map[string]int)
+	for _, l := range lints {
+		codes[l.Code]++
+	}
+	return codes
+}
+
+func TestLintOrderMachine(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	lints := m.Lint()
+	for _, l := range lints {
+		t.Log(l)
+	}
+
+	codes := lintCodes(lints)
+	// Ints clamp, so stock can never go negative.
+	if codes[gsm.LintRedundantInvariant] != 1 {
+		t.Errorf("expected stock_non_negative to be flagged redundant, got %v", codes)
+	}
+	if codes[gsm.LintNoOpEvent] != 0 || codes[gsm.LintDeadEvent] != 0 {
+		t.Errorf("order machine has no inert or dead events, got %v", codes)
+	}
+	// status and paid always move together, so e.g. {status=paid,
+	// paid=false} is valid but never reached.
+	if codes[gsm.LintUnreachableStates] != 1 {
+		t.Errorf("expected unreachable valid states to be flagged, got %v", codes)
+	}
+}
+
+func TestLintFindings(t *testing.T) {
+	b := gsm.NewRegistry("lint")
+
+	phase := b.Enum("phase", "open", "closed")
+	locked := b.Bool("locked")
+	touched := b.Bool("touched")
+
+	b.Event("close").
+		Writes(phase).
+		Apply(func(s gsm.State) gsm.State { return s.Set(phase, "closed") }).
+		Add()
+
+	// Only fires when locked, which nothing ever sets.
+	b.Event("unlock").
+		Writes(locked).
+		Guard(func(s gsm.State) bool { return s.GetBool(locked) }).
+		Apply(func(s gsm.State) gsm.State { return s.SetBool(locked, false) }).
+		Add()
+
+	b.Event("noop").
+		Writes(touched).
+		Apply(func(s gsm.State) gsm.State { return s }).
+		Add()
+
+	b.OnlyDeclaredPairs()
+	m, _, err := b.Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	lints := m.Lint()
+	codes := lintCodes(lints)
+	for code, want := range map[string]int{
+		gsm.LintNoOpEvent:         1,
+		gsm.LintDeadEvent:         1,
+		gsm.LintDeadlockState:     1, // phase=closed
+		gsm.LintUnreachableStates: 1,
+	} {
+		if codes[code] != want {
+			t.Errorf("expected %d %s findings, got %d", want, code, codes[code])
+		}
+	}
+	for _, l := range lints {
+		if l.Code == gsm.LintDeadlockState && l.State.Get(phase) != "closed" {
+			t.Errorf("expected deadlock at phase=closed, got %s", l.State)
+		}
+	}
+}
@@ -0,0 +1,268 @@
+package gsm
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+)
+
+// LoadOption configures Load.
+type LoadOption func(*loadConfig)
+
+type loadConfig struct {
+	fingerprints  map[string]string // enum var name → expected fingerprint
+	strictVersion bool              // if true, newer versions are errors rather than warnings
+	warn          func(error)       // receives warnings; nil logs them
+}
+
+// StrictVersion makes Load fail on an export whose format version, or
+// verification algorithm version, is newer than this library knows,
+// instead of warning and loading it on a best-effort basis.
+func StrictVersion() LoadOption {
+	return func(c *loadConfig) { c.strictVersion = true }
+}
+
+// OnLoadWarning sends Load's warnings to fn instead of the standard
+// logger. Load warns when an export is newer than this library knows.
+func OnLoadWarning(fn func(error)) LoadOption {
+	return func(c *loadConfig) { c.warn = fn }
+}
+
+// checkVersions accepts the format and algorithm versions of an export
+// this library knows, and warns about newer ones, reading them as the
+// newest known version: fields a newer writer added are ignored. Under
+// StrictVersion newer versions are errors. Versions below 1 are always
+// errors. Load and LoadSchema share it, so both apply one policy.
+func (c *loadConfig) checkVersions(version, algorithm int, libVersion string) error {
+	if version < 1 {
+		return fmt.Errorf("gsm: unsupported export version %d", version)
+	}
+	var newer []error
+	if version > formatVersion {
+		newer = append(newer, fmt.Errorf("gsm: export format version %d is newer than this library's %d (written by %s)", version, formatVersion, writtenBy(libVersion)))
+	}
+	if algorithm > verifyAlgorithm {
+		newer = append(newer, fmt.Errorf("gsm: export verification algorithm %d is newer than this library's %d (written by %s)", algorithm, verifyAlgorithm, writtenBy(libVersion)))
+	}
+	for _, err := range newer {
+		if c.strictVersion {
+			return err
+		}
+		if c.warn != nil {
+			c.warn(err)
+		} else {
+			log.Print(err)
+		}
+	}
+	return nil
+}
+
+// writtenBy describes the library version that wrote an export.
+func writtenBy(libVersion string) string {
+	if libVersion == "" {
+		return "an unrecorded gsm version"
+	}
+	return "gsm " + libVersion
+}
+
+// checkFingerprints enforces the ExpectFingerprint options against an
+// imported variable layout.
+func (c *loadConfig) checkFingerprints(vars []Var) error {
+	for name, want := range c.fingerprints {
+		found := false
+		for _, v := range vars {
+			if v.name == name {
+				found = true
+				if got := v.Fingerprint(); got != want {
+					return fmt.Errorf("gsm: enum %q fingerprint %q does not match expected %q (labels reordered?)", name, got, want)
+				}
+			}
+		}
+		if !found {
+			return fmt.Errorf("gsm: expected fingerprint for unknown variable %q", name)
+		}
+	}
+	return nil
+}
+
+// ExpectFingerprint makes Load fail unless the named enum variable exists
+// in the export with the given label fingerprint (see Var.Fingerprint).
+// Use it to catch exports produced after enum labels were reordered, which
+// silently changes the meaning of every stored state ID.
+func ExpectFingerprint(varName, fingerprint string) LoadOption {
+	return func(c *loadConfig) {
+		if c.fingerprints == nil {
+			c.fingerprints = make(map[string]string)
+		}
+		c.fingerprints[varName] = fingerprint
+	}
+}
+
+// Load reads a machine written by Export. The loaded machine carries the
+// precomputed tables and variable layout, so Apply, Normalize, and IsValid
+// behave exactly as on the original. Invariant and event closures are not
+// part of the export, so diagnostics that need them (Check,
+// ViolatedInvariants) report no violations.
+//
+// Load validates the table shapes against the variable layout, rejects
+// exports whose enum fingerprints do not match their labels, and runs
+// Validate to reject tables that were tampered with after export. Exports
+// from a newer library version with an unknown format or verification
+// algorithm version load with a warning (see OnLoadWarning), or fail under
+// StrictVersion.
+func Load(path string, opts ...LoadOption) (*Machine, error) {
+	var cfg loadConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("gsm: read failed: %w", err)
+	}
+
+	var ex exportFormat
+	if err := json.Unmarshal(data, &ex); err != nil {
+		return nil, fmt.Errorf("gsm: unmarshal failed: %w", err)
+	}
+	if err := cfg.checkVersions(ex.Version, ex.Verification.Algorithm, ex.LibVersion); err != nil {
+		return nil, err
+	}
+	if ex.Schema {
+		return nil, fmt.Errorf("gsm: %s is a schema-only export without tables (use LoadSchema)", path)
+	}
+	if err := ex.decodeStep(); err != nil {
+		return nil, err
+	}
+
+	vars, totalBits, err := importVars(ex.Vars)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := cfg.checkFingerprints(vars); err != nil {
+		return nil, err
+	}
+
+	if err := checkTableShapes(1<<totalBits, ex.Events, ex.Initial, ex.NF, ex.Step); err != nil {
+		return nil, err
+	}
+
+	m := &Machine{
+		name:       ex.Name,
+		vars:       vars,
+		events:     make(map[string]int),
+		step:       ex.Step,
+		nf:         ex.NF,
+		initial:    ex.Initial,
+		maxRepair:  ex.Verification.MaxRepairLen,
+		libVersion: ex.LibVersion,
+	}
+	for i, name := range ex.Events {
+		if _, dup := m.events[name]; dup {
+			return nil, fmt.Errorf("gsm: duplicate event %q", name)
+		}
+		m.events[name] = i
+	}
+	if len(ex.EventTags) > 0 {
+		m.tags = make([][]string, len(ex.Events))
+		for name, tags := range ex.EventTags {
+			ei, ok := m.events[name]
+			if !ok {
+				return nil, fmt.Errorf("gsm: event_tags names unknown event %q", name)
+			}
+			m.tags[ei] = tags
+		}
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// checkTableShapes checks that the tables of a deserialized machine have
+// one entry per encoding and one row per event, and that every entry is an
+// encoding, so table lookups cannot go out of range.
+func checkTableShapes(packedCount int, events []string, initial uint64, nf []uint64, step [][]uint64) error {
+	if len(nf) != packedCount {
+		return fmt.Errorf("gsm: nf table has %d entries, want %d", len(nf), packedCount)
+	}
+	if len(step) != len(events) {
+		return fmt.Errorf("gsm: step table has %d rows, want %d", len(step), len(events))
+	}
+	for _, id := range nf {
+		if id >= uint64(packedCount) {
+			return fmt.Errorf("gsm: nf entry %d out of range", id)
+		}
+	}
+	for ei, row := range step {
+		if len(row) != packedCount {
+			return fmt.Errorf("gsm: step row %q has %d entries, want %d", events[ei], len(row), packedCount)
+		}
+		for _, id := range row {
+			if id >= uint64(packedCount) {
+				return fmt.Errorf("gsm: step entry %d out of range in row %q", id, events[ei])
+			}
+		}
+	}
+	if initial >= uint64(packedCount) {
+		return fmt.Errorf("gsm: initial state %d out of range", initial)
+	}
+	return nil
+}
+
+// importVars rebuilds the variable layout from its exported description,
+// assigning offsets in declaration order exactly as the Registry does.
+func importVars(exported []varExport) ([]Var, uint, error) {
+	vars := make([]Var, len(exported))
+	var totalBits uint
+	for i, vd := range exported {
+		v := Var{name: vd.Name, index: i, offset: totalBits}
+		switch vd.Kind {
+		case "bool":
+			v.kind = BoolKind
+			v.domain = 2
+		case "enum":
+			if len(vd.Labels) < 2 {
+				return nil, 0, fmt.Errorf("gsm: enum %q needs at least 2 values", vd.Name)
+			}
+			if vd.Fingerprint != "" && vd.Fingerprint != labelFingerprint(vd.Labels) {
+				return nil, 0, fmt.Errorf("gsm: enum %q fingerprint does not match its labels", vd.Name)
+			}
+			v.kind = EnumKind
+			v.labels = vd.Labels
+			v.domain = len(vd.Labels)
+		case "int":
+			v.kind = IntKind
+			v.unit = vd.Unit
+			if vd.Values != nil {
+				if len(vd.Values) == 0 {
+					return nil, 0, fmt.Errorf("gsm: int set %q needs at least 1 value", vd.Name)
+				}
+				for k := 1; k < len(vd.Values); k++ {
+					if vd.Values[k] <= vd.Values[k-1] {
+						return nil, 0, fmt.Errorf("gsm: int set %q values not strictly ascending", vd.Name)
+					}
+				}
+				v.values = vd.Values
+				v.domain = len(vd.Values)
+				break
+			}
+			if vd.Max < vd.Min {
+				return nil, 0, fmt.Errorf("gsm: int %q has max < min", vd.Name)
+			}
+			v.min = vd.Min
+			v.domain = vd.Max - vd.Min + 1
+		default:
+			return nil, 0, fmt.Errorf("gsm: variable %q has unknown kind %q", vd.Name, vd.Kind)
+		}
+		v.bits = bitsNeeded(v.domain)
+		totalBits += v.bits
+		if totalBits > 32 {
+			return nil, 0, fmt.Errorf("gsm: state space too large (%d bits)", totalBits)
+		}
+		vars[i] = v
+	}
+	return vars, totalBits, nil
+}
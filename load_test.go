@@ -0,0 +1,477 @@
+package gsm_test
+
+import (
+	"encoding/json"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+func TestLoadRoundTrip(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+
+	path := t.TempDir() + "/order.gsm.json"
+	if err := m.Export(path); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	loaded, err := gsm.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if loaded.Name() != m.Name() {
+		t.Errorf("name %q, want %q", loaded.Name(), m.Name())
+	}
+
+	seq := []string{"place_order", "restock", "process_payment", "ship_item", "restock"}
+	s1, s2 := m.NewState(), loaded.NewState()
+	for _, ev := range seq {
+		s1 = m.Apply(s1, ev)
+		s2 = loaded.Apply(s2, ev)
+		if s1.ID() != s2.ID() || s1.String() != s2.String() {
+			t.Fatalf("after %s: original %s, loaded %s", ev, s1, s2)
+		}
+	}
+}
+
+func TestEnumFingerprintChangesWithLabelOrder(t *testing.T) {
+	b1 := gsm.NewRegistry("a")
+	v1 := b1.Enum("status", "pending", "paid", "shipped")
+	b2 := gsm.NewRegistry("b")
+	v2 := b2.Enum("status", "paid", "pending", "shipped")
+	b3 := gsm.NewRegistry("c")
+	v3 := b3.Enum("status", "pending", "paid", "shipped")
+
+	if v1.Fingerprint() == v2.Fingerprint() {
+		t.Fatal("reordering labels must change the fingerprint")
+	}
+	if v1.Fingerprint() != v3.Fingerprint() {
+		t.Fatal("identical labels must have identical fingerprints")
+	}
+	if b1.Bool("flag").Fingerprint() != "" {
+		t.Fatal("non-enum variables have no fingerprint")
+	}
+}
+
+func TestLoadExpectFingerprint(t *testing.T) {
+	export := func(labels ...string) (string, gsm.Var) {
+		b := gsm.NewRegistry("fp")
+		status := b.Enum("status", labels...)
+		b.Event("advance").
+			Writes(status).
+			Apply(func(s gsm.State) gsm.State { return s.Set(status, labels[1]) }).
+			Add()
+		m, _, err := b.Build()
+		if err != nil {
+			t.Fatalf("Build failed: %v", err)
+		}
+		path := t.TempDir() + "/fp.gsm.json"
+		if err := m.Export(path); err != nil {
+			t.Fatalf("Export failed: %v", err)
+		}
+		return path, status
+	}
+
+	path, status := export("pending", "paid", "shipped")
+	if _, err := gsm.Load(path, gsm.ExpectFingerprint("status", status.Fingerprint())); err != nil {
+		t.Fatalf("Load with matching fingerprint failed: %v", err)
+	}
+
+	reordered, _ := export("paid", "pending", "shipped")
+	_, err := gsm.Load(reordered, gsm.ExpectFingerprint("status", status.Fingerprint()))
+	if err == nil || !strings.Contains(err.Error(), "fingerprint") {
+		t.Fatalf("expected fingerprint mismatch, got %v", err)
+	}
+
+	if _, err := gsm.Load(path, gsm.ExpectFingerprint("missing", "x")); err == nil {
+		t.Fatal("expected error for unknown variable")
+	}
+}
+
+func TestLoadRejectsTamperedLabels(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	path := t.TempDir() + "/order.gsm.json"
+	if err := m.Export(path); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tampered := strings.Replace(string(data), `"pending",`, `"waiting",`, 1)
+	if err := os.WriteFile(path, []byte(tampered), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := gsm.Load(path); err == nil {
+		t.Fatal("expected Load to reject labels that don't match the fingerprint")
+	}
+}
+
+// TestExportNFNormalizesAnyEncoding checks that a foreign runtime can repair
+// any encoding using only the exported nf table.
+func TestExportNFNormalizesAnyEncoding(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+
+	path := t.TempDir() + "/order.gsm.json"
+	if err := m.Export(path); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var export struct {
+		NF []uint64 `json:"nf"`
+	}
+	if err := json.Unmarshal(data, &export); err != nil {
+		t.Fatal(err)
+	}
+
+	malformed := 0
+	for id, n := range export.NF {
+		s := m.StateFromID(uint64(id))
+		if !m.WellFormed(s) {
+			malformed++
+		}
+		target := m.StateFromID(n)
+		if !m.WellFormed(target) || !m.IsValid(target) {
+			t.Fatalf("nf[%d] = %s is not a valid state", id, target)
+		}
+		if export.NF[n] != n {
+			t.Fatalf("nf is not idempotent at %d", id)
+		}
+		if ok, _ := m.Check(target); !ok {
+			t.Fatalf("nf[%d] = %s violates an invariant", id, target)
+		}
+	}
+	if malformed == 0 {
+		t.Fatal("expected the order machine to have malformed padding encodings")
+	}
+
+	// A malformed encoding is no longer reported as valid.
+	if m.IsValid(m.StateFromID(7 << 3)) {
+		t.Fatal("malformed encoding reported valid")
+	}
+}
+
+func TestExportSchema(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+
+	dir := t.TempDir()
+	path := dir + "/order.schema.json"
+	if err := m.ExportSchema(path); err != nil {
+		t.Fatalf("ExportSchema failed: %v", err)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("Read failed: %v", err)
+	}
+	var raw map[string]json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatalf("JSON unmarshal failed: %v", err)
+	}
+	for _, key := range []string{"nf", "step", "step_rle", "initial"} {
+		if _, ok := raw[key]; ok {
+			t.Errorf("schema export contains %q", key)
+		}
+	}
+
+	schema, err := gsm.LoadSchema(path)
+	if err != nil {
+		t.Fatalf("LoadSchema failed: %v", err)
+	}
+	if schema.Name != m.Name() || !schema.WFC || !schema.CC || schema.StateCount != 64 {
+		t.Errorf("schema metadata = %+v", schema)
+	}
+	if strings.Join(schema.Events, ",") != strings.Join(m.Events(), ",") {
+		t.Errorf("schema events %v, want %v", schema.Events, m.Events())
+	}
+	if len(schema.Vars) != 3 || schema.Vars[0].Name != "status" || schema.Vars[0].Kind != "enum" ||
+		len(schema.Vars[0].Labels) != 4 || schema.Vars[2].Kind != "int" || schema.Vars[2].Max != 5 {
+		t.Errorf("schema vars = %+v", schema.Vars)
+	}
+
+	// A full export carries the same schema.
+	full := dir + "/order.gsm.json"
+	if err := m.Export(full); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	fromFull, err := gsm.LoadSchema(full)
+	if err != nil {
+		t.Fatalf("LoadSchema(full export) failed: %v", err)
+	}
+	if fromFull.Name != schema.Name || len(fromFull.Vars) != len(schema.Vars) || len(fromFull.Events) != len(schema.Events) {
+		t.Errorf("schema from full export = %+v, want %+v", fromFull, schema)
+	}
+
+	if _, err := gsm.Load(path); err == nil || !strings.Contains(err.Error(), "schema-only") {
+		t.Errorf("Load(schema) error = %v, want schema-only rejection", err)
+	}
+}
+
+func TestIntWithUnit(t *testing.T) {
+	b := gsm.NewRegistry("wallet")
+	balance := b.IntWithUnit("balance", 0, 9, "USD cents")
+	count := b.Int("count", 0, 3)
+	b.Event("deposit").
+		Writes(balance).
+		Apply(func(s gsm.State) gsm.State { return s.SetInt(balance, s.GetInt(balance)+1) }).
+		Add()
+	m, _, err := b.Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if balance.Unit() != "USD cents" || count.Unit() != "" {
+		t.Fatalf("units %q, %q", balance.Unit(), count.Unit())
+	}
+	if v, _ := m.Var("balance"); v.Unit() != "USD cents" {
+		t.Errorf("machine var unit %q", v.Unit())
+	}
+
+	dir := t.TempDir()
+	path := dir + "/wallet.gsm.json"
+	if err := m.Export(path); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Count(string(data), `"unit"`) != 1 {
+		t.Errorf("expected exactly one unit field in the export:\n%s", data)
+	}
+
+	loaded, err := gsm.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	if v, _ := loaded.Var("balance"); v.Unit() != "USD cents" {
+		t.Errorf("loaded unit %q, want USD cents", v.Unit())
+	}
+
+	schemaPath := dir + "/wallet.schema.json"
+	if err := m.ExportSchema(schemaPath); err != nil {
+		t.Fatal(err)
+	}
+	schema, err := gsm.LoadSchema(schemaPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if schema.Vars[0].Unit != "USD cents" {
+		t.Errorf("schema unit %q", schema.Vars[0].Unit)
+	}
+}
+
+func TestUpdateExportMetadata(t *testing.T) {
+	m, report := buildOrderMachine(t)
+	dir := t.TempDir()
+
+	path := dir + "/order.gsm.json"
+	if err := m.Export(path); err != nil {
+		t.Fatal(err)
+	}
+	before, _ := os.ReadFile(path)
+	if err := gsm.UpdateExportMetadata(path, report); err != nil {
+		t.Fatalf("UpdateExportMetadata: %v", err)
+	}
+	after, _ := os.ReadFile(path)
+
+	// Everything ahead of the trailing metadata is byte-for-byte unchanged.
+	cut := strings.Index(string(before), `"verification"`)
+	if cut < 0 || string(after[:cut]) != string(before[:cut]) {
+		t.Error("tables changed")
+	}
+	var ex struct {
+		Verification struct {
+			VerifiedAt   string `json:"verified_at"`
+			MaxRepairLen int    `json:"max_repair_depth"`
+		} `json:"verification"`
+	}
+	if err := json.Unmarshal(after, &ex); err != nil {
+		t.Fatal(err)
+	}
+	if ex.Verification.VerifiedAt == "" || ex.Verification.MaxRepairLen != report.MaxRepairLen {
+		t.Errorf("verification = %+v, want verified_at set and depth %d", ex.Verification, report.MaxRepairLen)
+	}
+	if _, err := gsm.Load(path); err != nil {
+		t.Errorf("updated export does not load: %v", err)
+	}
+
+	// Streamed exports keep their compact layout, tables last.
+	streamed := dir + "/streamed.gsm.json"
+	f, err := os.Create(streamed)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newOrderRegistry().BuildAndStreamExport(f); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	before, _ = os.ReadFile(streamed)
+	if err := gsm.UpdateExportMetadata(streamed, report); err != nil {
+		t.Fatalf("UpdateExportMetadata (streamed): %v", err)
+	}
+	after, _ = os.ReadFile(streamed)
+	cut = strings.Index(string(before), `"step"`)
+	if !strings.HasSuffix(string(after), string(before[cut:])) || strings.Count(string(after), "\n") != 1 {
+		t.Error("streamed export reformatted or tables changed")
+	}
+
+	// A report for a different machine is rejected and the file kept.
+	kept, _ := os.ReadFile(path)
+	_, other, err := newLightRegistry().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := gsm.UpdateExportMetadata(path, other); err == nil || !strings.Contains(err.Error(), "does not describe") {
+		t.Errorf("mismatched report: err = %v", err)
+	}
+	// So is one with the same counts but a different layout or events.
+	relabeled := gsm.NewRegistry("order_fulfillment")
+	status := relabeled.Enum("status", "pending", "paid", "shipped", "refunded")
+	relabeled.Bool("paid")
+	relabeled.Int("inventory", 0, 5)
+	for _, name := range m.Events() {
+		relabeled.Event(name).Writes(status).Apply(func(s gsm.State) gsm.State { return s }).Add()
+	}
+	_, other, err = relabeled.Build()
+	if err != nil {
+		t.Fatalf("Build: %v\n%s", err, other)
+	}
+	if err := gsm.UpdateExportMetadata(path, other); err == nil || !strings.Contains(err.Error(), "variable layout") {
+		t.Errorf("relabeled enum: err = %v", err)
+	}
+	renamed := newOrderRegistry()
+	renamed.RemoveEvent("restock")
+	renamed.Event("restock_all").Apply(func(s gsm.State) gsm.State { return s }).Add()
+	_, other, err = renamed.Build()
+	if err != nil {
+		t.Fatalf("Build: %v\n%s", err, other)
+	}
+	if err := gsm.UpdateExportMetadata(path, other); err == nil || !strings.Contains(err.Error(), "events of export") {
+		t.Errorf("renamed event: err = %v", err)
+	}
+
+	failed := *report
+	failed.CC = false
+	if err := gsm.UpdateExportMetadata(path, &failed); err == nil {
+		t.Error("failed verification should be rejected")
+	}
+	if got, _ := os.ReadFile(path); string(got) != string(kept) {
+		t.Error("rejected update modified the file")
+	}
+}
+
+func TestExportVersions(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	if m.ProducedBy() != gsm.LibVersion {
+		t.Errorf("built machine ProducedBy = %q, want %q", m.ProducedBy(), gsm.LibVersion)
+	}
+	path := t.TempDir() + "/order.gsm.json"
+	if err := m.Export(path); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	verification := raw["verification"].(map[string]any)
+	if raw["version"] != 1.0 || raw["lib_version"] != gsm.LibVersion || verification["algorithm"] != 1.0 {
+		t.Errorf("export records version %v, lib_version %v, algorithm %v; want 1, %q, 1",
+			raw["version"], raw["lib_version"], verification["algorithm"], gsm.LibVersion)
+	}
+
+	// rewrite saves the export with fields changed, as another library
+	// version might have written it.
+	rewrite := func(edit func(map[string]any)) string {
+		var ex map[string]any
+		if err := json.Unmarshal(data, &ex); err != nil {
+			t.Fatal(err)
+		}
+		edit(ex)
+		out, err := json.Marshal(ex)
+		if err != nil {
+			t.Fatal(err)
+		}
+		p := t.TempDir() + "/edited.gsm.json"
+		if err := os.WriteFile(p, out, 0o644); err != nil {
+			t.Fatal(err)
+		}
+		return p
+	}
+
+	// Exports from before the version fields load, and say so.
+	old := rewrite(func(ex map[string]any) {
+		delete(ex, "lib_version")
+		delete(ex["verification"].(map[string]any), "algorithm")
+	})
+	loaded, err := gsm.Load(old)
+	if err != nil {
+		t.Fatalf("Load of an export without version fields: %v", err)
+	}
+	if loaded.ProducedBy() != "" {
+		t.Errorf("ProducedBy = %q, want empty", loaded.ProducedBy())
+	}
+
+	// A newer format version warns by default and fails under StrictVersion.
+	newer := rewrite(func(ex map[string]any) {
+		ex["version"] = 2
+		ex["lib_version"] = "9.0.0"
+	})
+	var warnings []error
+	loaded, err = gsm.Load(newer, gsm.OnLoadWarning(func(err error) { warnings = append(warnings, err) }))
+	if err != nil {
+		t.Fatalf("Load of a newer format: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Error(), "format version 2 is newer") ||
+		!strings.Contains(warnings[0].Error(), "gsm 9.0.0") {
+		t.Errorf("warnings = %v, want one naming format version 2 and gsm 9.0.0", warnings)
+	}
+	if loaded.ProducedBy() != "9.0.0" {
+		t.Errorf("ProducedBy = %q, want 9.0.0", loaded.ProducedBy())
+	}
+	if _, err := gsm.Load(newer, gsm.StrictVersion()); err == nil || !strings.Contains(err.Error(), "newer than") {
+		t.Errorf("StrictVersion: err = %v, want newer-version error", err)
+	}
+
+	// So does a newer verification algorithm.
+	newAlgo := rewrite(func(ex map[string]any) {
+		ex["verification"].(map[string]any)["algorithm"] = 2
+	})
+	if _, err := gsm.Load(newAlgo, gsm.StrictVersion()); err == nil || !strings.Contains(err.Error(), "algorithm 2") {
+		t.Errorf("StrictVersion: err = %v, want newer-algorithm error", err)
+	}
+
+	// Versions below 1 never load.
+	zero := rewrite(func(ex map[string]any) { ex["version"] = 0 })
+	if _, err := gsm.Load(zero); err == nil || !strings.Contains(err.Error(), "unsupported export version 0") {
+		t.Errorf("version 0: err = %v", err)
+	}
+
+	// LoadSchema applies the same policy with the same messages.
+	warnings = nil
+	if _, err := gsm.LoadSchema(newer, gsm.OnLoadWarning(func(err error) { warnings = append(warnings, err) })); err != nil {
+		t.Fatalf("LoadSchema of a newer format: %v", err)
+	}
+	if len(warnings) != 1 || !strings.Contains(warnings[0].Error(), "format version 2 is newer") {
+		t.Errorf("LoadSchema warnings = %v, want the format version warning", warnings)
+	}
+	if _, err := gsm.LoadSchema(newAlgo, gsm.StrictVersion()); err == nil || !strings.Contains(err.Error(), "algorithm 2") {
+		t.Errorf("LoadSchema StrictVersion: err = %v, want newer-algorithm error", err)
+	}
+	if _, err := gsm.LoadSchema(zero); err == nil || !strings.Contains(err.Error(), "unsupported export version 0") {
+		t.Errorf("LoadSchema version 0: err = %v", err)
+	}
+	if _, err := gsm.LoadSchema(path, gsm.ExpectFingerprint("status", "bogus")); err == nil || !strings.Contains(err.Error(), "does not match") {
+		t.Errorf("LoadSchema ExpectFingerprint: err = %v", err)
+	}
+}
@@ -2,8 +2,12 @@ package gsm
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"slices"
+	"sync"
 	"time"
 )
 
@@ -11,24 +15,117 @@ import (
 // Created by Builder.Build() after WFC and CC verification passes.
 // All operations are table lookups — no computation at runtime.
 type Machine struct {
-	name   string
-	vars   []Var
-	events map[string]int // event name → index
-	step   [][]uint64     // step[event][stateID] → normal form stateID
-	nf     []uint64       // nf[stateID] → normal form stateID
+	name        string
+	vars        []Var
+	events      map[string]int            // event name → index
+	step        [][]uint64                // step[event][stateID] → normal form stateID
+	nf          []uint64                  // nf[stateID] → normal form stateID
+	invariants  []invariantDef            // retained for diagnostics, in priority order
+	defs        []eventDef                // retained for diagnostics, indexed like step
+	compensated []bitset                  // compensated[event] has stateIDs whose transition needed repair
+	initial     uint64                    // initial stateID returned by NewState
+	verified    []VerifiedPair            // CC proofs from Build, in check order
+	groups      map[int]map[string]uint64 // enum groups: var index → group → label bitmask
+	tags        [][]string                // tags[event] from EventBuilder.Tag, indexed like step
+	prev        [][]int                   // prev[event]: allowed predecessors from RequiresPrev; nil if none declared
+	maxRepair   int                       // longest compensation chain (Report.MaxRepairLen)
+	libVersion  string                    // LibVersion of the library that built or exported it
+	reachCount  int                       // reachable states found by Build; 0 if not analyzed
+	pairConds   map[[2]int]CheckFunc      // IndependentWhen conditions by event indices, low first; nil without closures
+	ccReachable bool                      // brute-force CC ran over reachable states (CCOverReachable)
+
+	// Lazily computed analysis caches. The tables above never change, so
+	// each cache is computed at most once under its sync.Once and is then
+	// shared read-only, making concurrent use of a Machine safe. New caches
+	// should follow the same pattern rather than adding locks.
+	reachOnce sync.Once
+	reach     reachability
+	predOnce  sync.Once
+	preds     []map[uint64][]uint64 // preds[event][stateID] → reachable predecessors
 }
 
 // Name returns the machine's name.
 func (m *Machine) Name() string { return m.name }
 
-// NewState returns the zero state (all variables at their minimum/first value).
+// NewState returns the initial state. Unless Registry.InitialState was
+// used, this is the zero state (all variables at their minimum/first value).
 func (m *Machine) NewState() State {
-	return State{packed: 0, vars: m.vars}
+	return State{packed: m.initial, vars: m.vars}
+}
+
+// StateFrom builds a state from named variable values, starting from
+// NewState(). Values are typed by the variable's kind: string for enums,
+// bool for bools, and an integer for ints (float64 is accepted when it is
+// integral, as produced by encoding/json). Returns an error for unknown
+// names, wrong types, unknown enum labels, or out-of-range ints.
+func (m *Machine) StateFrom(values map[string]interface{}) (State, error) {
+	return m.setValues(m.NewState(), values)
+}
+
+// ApplyPatch applies a partial update of named variable values to s, typed
+// as for StateFrom, and returns the normal form of the result, so updates
+// that violate invariants come back repaired. The patch is atomic: on any
+// unknown name, wrong type, unknown label, or out-of-range int it returns
+// an error and no state.
+func (m *Machine) ApplyPatch(s State, patch map[string]interface{}) (State, error) {
+	patched, err := m.setValues(s, patch)
+	if err != nil {
+		return State{}, err
+	}
+	return m.Normalize(patched), nil
+}
+
+// setValues applies named values to s in name order, so the first error
+// reported for a bad map is deterministic.
+func (m *Machine) setValues(s State, values map[string]interface{}) (State, error) {
+	names := make([]string, 0, len(values))
+	for name := range values {
+		names = append(names, name)
+	}
+	slices.Sort(names)
+	for _, name := range names {
+		v, ok := m.Var(name)
+		if !ok {
+			return State{}, fmt.Errorf("gsm: unknown variable %q", name)
+		}
+		var err error
+		s, err = s.setValue(v, values[name])
+		if err != nil {
+			return State{}, err
+		}
+	}
+	return s, nil
+}
+
+// Var looks up a declared variable by name. It gives callers of Load,
+// and others without the Registry's handles, access to typed getters.
+func (m *Machine) Var(name string) (Var, bool) {
+	for _, v := range m.vars {
+		if v.name == name {
+			return v, true
+		}
+	}
+	return Var{}, false
 }
 
 // Apply processes an event, returning the unique normal form.
 // This is a single table lookup — O(1).
 // Panics if the event name is unknown.
+//
+// Apply does not normalize its input. For a state that violates an
+// invariant (IsValid is false), the event's guard and effect run on the
+// unrepaired state and only the result is normalized. That is the
+// transition Build verified (brute-force CC covers such states unless
+// CCOverReachable was used), and the result is always a normal form. It
+// can differ from Apply(Normalize(s), event), for example when repair
+// would enable a guard the raw state fails. Callers holding states from
+// outside the machine (patched, decoded, or hand-built) should normalize
+// them first; see EnabledEventsNormalized.
+//
+// Apply does not check that s is a well-formed encoding either: the lookup
+// stays a single index, and a malformed ID (from StateFromID or an export)
+// is looked up as is, panicking if it is out of range. Use ApplyChecked
+// for states from untrusted sources.
 func (m *Machine) Apply(s State, event string) State {
 	ei, ok := m.events[event]
 	if !ok {
@@ -40,8 +137,259 @@ func (m *Machine) Apply(s State, event string) State {
 	}
 }
 
+// ApplyChecked is Apply for states from outside the machine. It returns an
+// error, rather than panicking or looking up a meaningless entry, if the
+// event name is unknown or s is not a well-formed encoding (see
+// WellFormed).
+func (m *Machine) ApplyChecked(s State, event string) (State, error) {
+	ei, ok := m.events[event]
+	if !ok {
+		return State{}, fmt.Errorf("gsm: unknown event %q", event)
+	}
+	if !m.WellFormed(s) {
+		return State{}, fmt.Errorf("gsm: state ID %d is not a well-formed encoding for %s", s.packed, m.name)
+	}
+	return m.ApplyByIndex(s, ei), nil
+}
+
+// EnabledEventsNormalized returns the events whose guards pass on the
+// normal form of s, in declaration order. This is the view Apply takes of
+// a state that has already been normalized: a raw state that violates an
+// invariant may fail guards its repaired form passes, and vice versa, and
+// Apply on the raw state evaluates them raw (see Apply). ApplyErr events
+// count as enabled where their effect succeeds. Machines from Load carry
+// no guards, so every event is reported enabled.
+func (m *Machine) EnabledEventsNormalized(s State) []string {
+	n := m.Normalize(s)
+	names := m.Events()
+	var enabled []string
+	for ei, name := range names {
+		if m.defs == nil || m.defs[ei].enabled(n) {
+			enabled = append(enabled, name)
+		}
+	}
+	return enabled
+}
+
+// AllowedAfter reports whether event may fire directly after prev under
+// the RequiresPrev constraints, where prev == "" means no event has been
+// applied yet. Events without RequiresPrev are always allowed. The check
+// is history-dependent and not part of the step tables; Stream and
+// Explorer enforce it, Apply does not. Machines from Load carry no
+// precedence constraints. Panics if either event name is unknown.
+func (m *Machine) AllowedAfter(prev, event string) bool {
+	ei, ok := m.events[event]
+	if !ok {
+		panic(fmt.Sprintf("gsm: unknown event %q", event))
+	}
+	pi := -1
+	if prev != "" {
+		if pi, ok = m.events[prev]; !ok {
+			panic(fmt.Sprintf("gsm: unknown event %q", prev))
+		}
+	}
+	return m.allowedAfter(pi, ei)
+}
+
+// allowedAfter is AllowedAfter on event indices, with prev -1 for none.
+func (m *Machine) allowedAfter(prev, ei int) bool {
+	if m.prev == nil || len(m.prev[ei]) == 0 {
+		return true
+	}
+	return slices.Contains(m.prev[ei], prev)
+}
+
+// EventIndex returns the index of a named event, for use with ApplyByIndex.
+// Indices follow declaration order, matching Events().
+func (m *Machine) EventIndex(event string) (int, bool) {
+	ei, ok := m.events[event]
+	return ei, ok
+}
+
+// ApplyByIndex is Apply with the event given by index (see EventIndex),
+// skipping the name lookup in hot loops. Panics if the index is out of
+// range.
+func (m *Machine) ApplyByIndex(s State, ei int) State {
+	return State{
+		packed: m.step[ei][s.packed],
+		vars:   m.vars,
+	}
+}
+
+// ApplyRaw is ApplyByIndex on packed state IDs: step[ei][id]. It avoids
+// carrying the State wrapper through replay loops over millions of events;
+// wrap the final ID with StateFromID. Panics if either index is out of
+// range.
+func (m *Machine) ApplyRaw(id uint64, ei int) uint64 {
+	return m.step[ei][id]
+}
+
+// Fixpoint applies event to s repeatedly until the state stops changing,
+// as an event that saturates against an invariant eventually does. It
+// returns the final state, the number of applications that changed the
+// state, and whether a fixpoint was reached within maxIter of them; a
+// state that is already fixed returns itself, 0, and true. Events that
+// cycle through several states never converge. A non-positive maxIter is
+// replaced by the number of encodings, past which the sequence must be
+// cycling. Panics if the event name is unknown.
+func (m *Machine) Fixpoint(s State, event string, maxIter int) (State, int, bool) {
+	ei, ok := m.events[event]
+	if !ok {
+		panic(fmt.Sprintf("gsm: unknown event %q", event))
+	}
+	if maxIter <= 0 {
+		maxIter = len(m.nf)
+	}
+	row := m.step[ei]
+	id := s.packed
+	for n := 0; ; n++ {
+		next := row[id]
+		if next == id {
+			return State{packed: id, vars: m.vars}, n, true
+		}
+		if n == maxIter {
+			return State{packed: id, vars: m.vars}, n, false
+		}
+		id = next
+	}
+}
+
+// ApplyOption configures ApplyMany.
+type ApplyOption func(*applyConfig)
+
+type applyConfig struct {
+	inPlace bool
+}
+
+// InPlace makes ApplyMany write the results over its input slice and
+// return it, instead of allocating a new one.
+func InPlace() ApplyOption {
+	return func(c *applyConfig) { c.inPlace = true }
+}
+
+// ApplyMany applies one event to every packed state ID in states and
+// returns the results in the same order, in a new slice unless InPlace is
+// given. The event name is resolved once for the whole batch, and the loop
+// reads a single step row, which suits Monte Carlo sweeps over many
+// states. Panics if the event name is unknown or an ID is out of range.
+func (m *Machine) ApplyMany(states []uint64, event string, opts ...ApplyOption) []uint64 {
+	var cfg applyConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	ei, ok := m.events[event]
+	if !ok {
+		panic(fmt.Sprintf("gsm: unknown event %q", event))
+	}
+	out := states
+	if !cfg.inPlace {
+		out = make([]uint64, len(states))
+	}
+	row := m.step[ei]
+	for i, id := range states {
+		out[i] = row[id]
+	}
+	return out
+}
+
+// ApplyBatch applies a set of concurrent events to s and returns the
+// result, which is the same in every arrival order. It returns an error
+// unless every pair of distinct events in the batch is one Build proved to
+// commute (see VerifiedPairs), and then applies them in declaration order.
+// Pairwise commutativity extends to the whole batch, since any order can
+// be reached from another by swapping adjacent events. An event may appear
+// more than once.
+//
+// Pairs proved with method "conditional" are refused, because their
+// guarantee covers only the states satisfying the pair's condition.
+// Pairs proved with "brute-reachable" were checked only from reachable
+// states, so a batch containing one is refused unless s is reachable.
+// Machines from Load carry no proofs, so any batch of two or more distinct
+// events fails. Returns an error if an event name is unknown.
+func (m *Machine) ApplyBatch(s State, events []string) (State, error) {
+	idx := make([]int, len(events))
+	for i, name := range events {
+		ei, ok := m.events[name]
+		if !ok {
+			return State{}, fmt.Errorf("gsm: unknown event %q", name)
+		}
+		idx[i] = ei
+	}
+	method := make(map[[2]string]string, 2*len(m.verified))
+	for _, vp := range m.verified {
+		method[[2]string{vp.Event1, vp.Event2}] = vp.Method
+		method[[2]string{vp.Event2, vp.Event1}] = vp.Method
+	}
+	for i, a := range events {
+		for _, b := range events[i+1:] {
+			if a == b {
+				continue
+			}
+			switch method[[2]string{a, b}] {
+			case "", "conditional":
+				return State{}, fmt.Errorf("gsm: batch events %q and %q are not a verified independent pair", a, b)
+			case "brute-reachable":
+				if !m.explore().seen.has(s.packed) {
+					return State{}, fmt.Errorf("gsm: batch events %q and %q commute only from reachable states, and %s is not reachable", a, b, s)
+				}
+			}
+		}
+	}
+	slices.Sort(idx)
+	for _, ei := range idx {
+		s = m.ApplyByIndex(s, ei)
+	}
+	return s, nil
+}
+
+// NormalizeRaw is Normalize on a packed state ID.
+func (m *Machine) NormalizeRaw(id uint64) uint64 {
+	return m.nf[id]
+}
+
+// NormalizeID returns the normal form of an externally supplied packed
+// state ID: its repaired form if it violates invariants or is a malformed
+// encoding. Unlike NormalizeRaw it bounds-checks the ID and returns an
+// error, rather than panicking, for IDs wider than the machine's encoding.
+func (m *Machine) NormalizeID(id uint64) (uint64, error) {
+	if id >= uint64(len(m.nf)) {
+		return 0, fmt.Errorf("gsm: state ID %d out of range (machine has %d encodings)", id, len(m.nf))
+	}
+	return m.nf[id], nil
+}
+
+// ApplyWithHook is Apply with a callback for compensation. When the event's
+// raw effect violates an invariant, onCompensate is called once per repair
+// in the chain, with the state before the repair, the invariant that fired,
+// and the repaired state. The result is the same as Apply.
+//
+// Whether a transition compensates is precomputed at build time, so
+// transitions that need no repair cost one extra bit test. Only
+// compensating transitions replay the event and repair closures. Machines
+// from Load have no closures and never call the hook.
+func (m *Machine) ApplyWithHook(s State, event string, onCompensate func(from State, invariant string, to State)) State {
+	next := m.Apply(s, event)
+	ei := m.events[event]
+	if onCompensate == nil || m.defs == nil || !m.compensated[ei].has(s.packed) {
+		return next
+	}
+
+	cur := clampState(m.vars, m.defs[ei].apply(s))
+	for {
+		ii := firstViolated(m.invariants, cur)
+		if ii < 0 {
+			break
+		}
+		repaired := m.invariants[ii].repair(cur)
+		onCompensate(cur, m.invariants[ii].name, repaired)
+		cur = repaired
+	}
+	return next
+}
+
 // Normalize returns the normal form of a state.
-// If the state is already valid, returns it unchanged.
+// If the state is already valid, returns it unchanged. Malformed encodings
+// (see WellFormed) are clamped into range and then normalized.
 func (m *Machine) Normalize(s State) State {
 	return State{
 		packed: m.nf[s.packed],
@@ -54,6 +402,120 @@ func (m *Machine) IsValid(s State) bool {
 	return m.nf[s.packed] == s.packed
 }
 
+// StateFromID wraps a packed state ID (from State.ID or an export) as a
+// State of this machine. The ID is not checked; see WellFormed.
+func (m *Machine) StateFromID(id uint64) State {
+	return State{packed: id, vars: m.vars}
+}
+
+// WellFormed reports whether the state is a structurally valid encoding
+// for this machine: every variable's raw value is within its domain and no
+// bits are set beyond the last variable. It says nothing about invariants;
+// see IsValid.
+func (m *Machine) WellFormed(s State) bool {
+	return s.packed < uint64(len(m.nf)) && validEncoding(m.vars, s.packed)
+}
+
+// EachValidState calls fn for every well-formed encoding (see WellFormed)
+// in ascending ID order, stopping early if fn returns false. This is the
+// enumeration Build verifies over: it includes states that violate
+// invariants, so combine it with IsValid to visit only normal forms.
+func (m *Machine) EachValidState(fn func(State) bool) {
+	for id := range m.nf {
+		if validEncoding(m.vars, uint64(id)) && !fn(State{packed: uint64(id), vars: m.vars}) {
+			return
+		}
+	}
+}
+
+// ValidateEncoding returns the names of variables whose raw value in s is
+// outside their domain, in declaration order. It is the per-variable form
+// of WellFormed, useful for tracking down hand-constructed or migrated
+// states. Bits set beyond the last variable belong to no variable and are
+// reported only by WellFormed.
+func (m *Machine) ValidateEncoding(s State) []string {
+	var bad []string
+	for _, v := range m.vars {
+		mask := uint64((1 << v.bits) - 1)
+		if int((s.packed>>v.offset)&mask) >= v.domain {
+			bad = append(bad, v.name)
+		}
+	}
+	return bad
+}
+
+// Check reports whether all invariants hold for the state and, if not,
+// the names of the violated invariants in priority order.
+func (m *Machine) Check(s State) (bool, []string) {
+	violated := m.ViolatedInvariants(s)
+	return len(violated) == 0, violated
+}
+
+// ViolatedInvariants returns the names of the invariants that do not hold
+// for the state, in priority order. Returns nil for a valid state.
+func (m *Machine) ViolatedInvariants(s State) []string {
+	var names []string
+	for _, inv := range m.invariants {
+		if !inv.check(s) {
+			names = append(names, inv.name)
+		}
+	}
+	return names
+}
+
+// InGroup reports whether enum v's value in s belongs to the named group
+// declared with Registry.EnumGroups or EnumGroupsExhaustive. Unknown groups
+// contain no labels.
+func (m *Machine) InGroup(s State, v Var, group string) bool {
+	raw := s.getRaw(v)
+	return raw < 64 && m.groups[v.index][group]&(1<<raw) != 0
+}
+
+// VerifiedPairs returns the event pairs Build proved to satisfy CC, with the
+// proof method for each, in the order they were checked. It is a durable
+// record of the verification scope for audit; pairs never declared
+// independent are absent. Loaded machines return nil, since the export
+// does not carry proofs.
+func (m *Machine) VerifiedPairs() []VerifiedPair {
+	return slices.Clone(m.verified)
+}
+
+// ProducedBy returns the version of this library that built the machine:
+// LibVersion for machines from Build, and the recorded version for
+// machines from Load or GobDecode. It is empty for exports written before
+// the version was recorded.
+func (m *Machine) ProducedBy() string { return m.libVersion }
+
+// MachineStats is a numeric summary of a machine's structure, for
+// dashboards that want counts without parsing an export.
+type MachineStats struct {
+	VarCount       int
+	EventCount     int
+	InvariantCount int  // 0 for machines from Load, which carry no invariants
+	TotalBits      uint // width of the packed state encoding
+	ReachableCount int  // states reachable from NewState; 0 if not analyzed
+	MaxRepairDepth int  // longest compensation chain (Report.MaxRepairLen)
+}
+
+// Stats returns the machine's MachineStats. Everything is retained from
+// Build, so Stats does no analysis of its own. Exports record the repair
+// depth but not the reachable count, so machines from Load report a
+// ReachableCount of 0; len(ReachableStates()) computes it.
+func (m *Machine) Stats() MachineStats {
+	var bits uint
+	for _, v := range m.vars {
+		bits += v.bits
+	}
+	return MachineStats{
+		VarCount:       len(m.vars),
+		EventCount:     len(m.events),
+		InvariantCount: len(m.invariants),
+		TotalBits:      bits,
+		ReachableCount: m.reachCount,
+		MaxRepairDepth: m.maxRepair,
+	}
+}
+
 // Events returns the names of all declared events.
 func (m *Machine) Events() []string {
 	names := make([]string, len(m.events))
@@ -63,26 +525,84 @@ func (m *Machine) Events() []string {
 	return names
 }
 
+// EventsByTag returns the names of the events tagged tag (see
+// EventBuilder.Tag), in declaration order. Tags are exported, so loaded
+// machines support it too.
+func (m *Machine) EventsByTag(tag string) []string {
+	names := m.Events()
+	var tagged []string
+	for ei, t := range m.tags {
+		if slices.Contains(t, tag) {
+			tagged = append(tagged, names[ei])
+		}
+	}
+	return tagged
+}
+
+// EventWriteSet returns the names of the variables the event declares it
+// writes, in the order passed to EventBuilder.Writes. It returns false
+// if the event is unknown or the machine was loaded from an export, which
+// does not carry write sets.
+func (m *Machine) EventWriteSet(event string) ([]string, bool) {
+	ei, ok := m.events[event]
+	if !ok || m.defs == nil {
+		return nil, false
+	}
+	names := make([]string, len(m.defs[ei].writes))
+	for i, vi := range m.defs[ei].writes {
+		names[i] = m.vars[vi].name
+	}
+	return names, true
+}
+
+// LibVersion is the version of this library. Export records it as
+// "lib_version", so a loaded machine can report what produced it (see
+// Machine.ProducedBy).
+const LibVersion = "0.2.0-dev"
+
+// formatVersion is the export format version, recorded as "version". It
+// changes only when the layout changes so that older readers would
+// misread an export; fields they can ignore do not bump it. Optional
+// encodings selected by an ExportOption keep the version too, so a
+// CompressExport export is still version 1 but has no "step" table: its
+// reader must understand "step_encoding" and "step_rle".
+const formatVersion = 1
+
+// verifyAlgorithm versions the verification semantics Build applies before
+// a machine can be exported (WFC over every valid encoding, CC for the
+// checked pairs), recorded as verification.algorithm. It changes when a
+// machine that passed before could fail, or the reverse.
+const verifyAlgorithm = 1
+
 // exportFormat is the portable JSON/MessagePack representation of a verified machine.
 // Runtime implementations in other languages can load this format and perform
 // O(1) event application via table lookups, without reimplementing verification.
 type exportFormat struct {
-	Name         string      `json:"name"`
-	Version      int         `json:"version"`
-	Vars         []varExport `json:"vars"`
-	Events       []string    `json:"events"`
-	NF           []uint64    `json:"nf"`
-	Step         [][]uint64  `json:"step"`
-	Verification verifyInfo  `json:"verification"`
-	ExportedAt   string      `json:"exported_at"`
+	Name         string              `json:"name"`
+	Version      int                 `json:"version"`               // format version; see formatVersion
+	LibVersion   string              `json:"lib_version,omitempty"` // LibVersion of the exporting library
+	Schema       bool                `json:"schema,omitempty"`      // set by ExportSchema; no tables
+	Vars         []varExport         `json:"vars"`
+	Events       []string            `json:"events"`
+	EventTags    map[string][]string `json:"event_tags,omitempty"` // event name → tags, for tagged events
+	Initial      uint64              `json:"initial"`
+	NF           []uint64            `json:"nf"`
+	Step         [][]uint64          `json:"step,omitempty"`
+	StepEncoding string              `json:"step_encoding,omitempty"` // "rle" with CompressExport
+	StepRLE      [][][3]int64        `json:"step_rle,omitempty"`
+	Verification verifyInfo          `json:"verification"`
+	ExportedAt   string              `json:"exported_at"`
 }
 
 type varExport struct {
-	Name   string   `json:"name"`
-	Kind   string   `json:"kind"`             // "bool", "enum", "int"
-	Labels []string `json:"labels,omitempty"` // enum only
-	Min    int      `json:"min,omitempty"`    // int only
-	Max    int      `json:"max,omitempty"`    // int only
+	Name        string   `json:"name"`
+	Kind        string   `json:"kind"`                  // "bool", "enum", "int"
+	Labels      []string `json:"labels,omitempty"`      // enum only
+	Fingerprint string   `json:"fingerprint,omitempty"` // enum only: hash of ordered labels
+	Min         int      `json:"min,omitempty"`         // int only
+	Max         int      `json:"max,omitempty"`         // int only
+	Values      []int    `json:"values,omitempty"`      // int set only: member values by index
+	Unit        string   `json:"unit,omitempty"`        // int only: display unit
 }
 
 type verifyInfo struct {
@@ -92,6 +612,7 @@ type verifyInfo struct {
 	StateCount   int    `json:"state_count"`
 	EventCount   int    `json:"event_count"`
 	VerifiedAt   string `json:"verified_at,omitempty"`
+	Algorithm    int    `json:"algorithm,omitempty"` // see verifyAlgorithm; 0 in exports predating it
 }
 
 // Export writes the verified machine to a portable JSON format.
@@ -101,10 +622,17 @@ type verifyInfo struct {
 // The format contains:
 //   - State variable definitions (types, domains)
 //   - Event names (ordered)
-//   - Normal form table: nf[stateID] → normalized stateID
+//   - Event tags, for events that have any (see EventBuilder.Tag)
+//   - Initial stateID
+//   - Normal form table: nf[stateID] → normalized stateID, covering every
+//     encoding: states that violate invariants map to their repaired form,
+//     and malformed encodings (raw values outside a domain) are clamped
+//     into range first. Every entry is a valid state.
 //   - Step table: step[eventID][stateID] → normalized result stateID
 //   - Verification metadata (WFC/CC results, state count, etc.)
 //
+// With CompressExport, the step table is run-length encoded instead.
+//
 // Runtime libraries only need to:
 //  1. Load the JSON
 //  2. Implement Apply(state, event) as step[events[event]][state]
@@ -120,11 +648,74 @@ type verifyInfo struct {
 //	        self.step = d['step']
 //	    def apply(self, state, event):
 //	        return self.step[self.events[event]][state]
-func (m *Machine) Export(path string) error {
-	eventNames := m.Events()
+func (m *Machine) Export(path string, opts ...ExportOption) error {
+	var cfg exportConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	export := newExport(m.name, m.vars, m.Events(), m.tags, m.initial, m.nf)
+	export.Step = m.step
+	export.Verification.MaxRepairLen = m.maxRepair
+
+	if cfg.compress {
+		export.Step = nil
+		export.StepEncoding = "rle"
+		export.StepRLE = make([][][3]int64, len(m.step))
+		for ei, row := range m.step {
+			export.StepRLE[ei] = encodeRLE(row)
+		}
+	}
+
+	data, err := json.MarshalIndent(export, "", "  ")
+	if err != nil {
+		return fmt.Errorf("gsm: marshal failed: %w", err)
+	}
+
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("gsm: write failed: %w", err)
+	}
+
+	return nil
+}
+
+// newExport returns the export of a verified machine without its step
+// table, which the caller fills in. tags is indexed like events and may be
+// nil.
+func newExport(name string, vars []Var, events []string, tags [][]string, initial uint64, nf []uint64) exportFormat {
+	var eventTags map[string][]string
+	for ei, t := range tags {
+		if len(t) > 0 {
+			if eventTags == nil {
+				eventTags = make(map[string][]string)
+			}
+			eventTags[events[ei]] = t
+		}
+	}
 
-	vars := make([]varExport, len(m.vars))
-	for i, v := range m.vars {
+	return exportFormat{
+		Name:       name,
+		Version:    formatVersion,
+		LibVersion: LibVersion,
+		Vars:       exportVars(vars),
+		Events:     events,
+		EventTags:  eventTags,
+		Initial:    initial,
+		NF:         nf,
+		ExportedAt: time.Now().UTC().Format(time.RFC3339),
+		Verification: verifyInfo{
+			WFC:        true, // only verified machines are exported
+			CC:         true,
+			StateCount: len(nf),
+			EventCount: len(events),
+			Algorithm:  verifyAlgorithm,
+		},
+	}
+}
+
+// exportVars returns the exported layout of vars.
+func exportVars(vars []Var) []varExport {
+	exported := make([]varExport, len(vars))
+	for i, v := range vars {
 		vd := varExport{Name: v.name}
 		switch v.kind {
 		case BoolKind:
@@ -132,38 +723,45 @@ func (m *Machine) Export(path string) error {
 		case EnumKind:
 			vd.Kind = "enum"
 			vd.Labels = v.labels
+			vd.Fingerprint = v.Fingerprint()
 		case IntKind:
 			vd.Kind = "int"
-			vd.Min = v.min
-			vd.Max = v.min + v.domain - 1
+			if v.values != nil {
+				vd.Values = v.values
+				vd.Min = v.values[0]
+				vd.Max = v.values[len(v.values)-1]
+			} else {
+				vd.Min = v.min
+				vd.Max = v.min + v.domain - 1
+			}
+			vd.Unit = v.unit
 		}
-		vars[i] = vd
-	}
-
-	export := exportFormat{
-		Name:       m.name,
-		Version:    1,
-		Vars:       vars,
-		Events:     eventNames,
-		NF:         m.nf,
-		Step:       m.step,
-		ExportedAt: time.Now().UTC().Format(time.RFC3339),
-		Verification: verifyInfo{
-			WFC:        true, // Machine only exists if verification passed
-			CC:         true,
-			StateCount: len(m.nf),
-			EventCount: len(eventNames),
-		},
+		exported[i] = vd
 	}
+	return exported
+}
 
-	data, err := json.MarshalIndent(export, "", "  ")
+// writeFileAtomic writes data to a temporary file in the destination
+// directory and renames it into place, so readers never observe a partially
+// written export. The temporary file is removed on any failure.
+func writeFileAtomic(path string, data []byte) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
 	if err != nil {
-		return fmt.Errorf("gsm: marshal failed: %w", err)
+		return err
 	}
+	tmpName := tmp.Name()
 
-	if err := os.WriteFile(path, data, 0600); err != nil {
-		return fmt.Errorf("gsm: write failed: %w", err)
+	if _, err := tmp.Write(data); err != nil {
+		return errors.Join(err, tmp.Close(), os.Remove(tmpName))
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Join(err, os.Remove(tmpName))
+	}
+	if err := os.Chmod(tmpName, 0600); err != nil {
+		return errors.Join(err, os.Remove(tmpName))
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return errors.Join(err, os.Remove(tmpName))
 	}
-
 	return nil
 }
@@ -0,0 +1,139 @@
+package gsm
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"reflect"
+	"slices"
+	"time"
+)
+
+// UpdateExportMetadata refreshes the metadata of the export at path after
+// re-verification: exported_at, and the verification block with the WFC
+// and CC results and repair depth from report and the current time as
+// verified_at. Every other byte of the file is kept, so re-verifying an
+// unchanged machine touches only those lines of a committed artifact,
+// whether written by Export or BuildAndStreamExport.
+//
+// The export is first loaded as Load would, so tables that fail Load's
+// checks are rejected. The report must come from a successful build of a
+// machine with the export's name, variable layout (names, kinds, domains,
+// and enum labels), and event names, and the rewritten file must decode to
+// the same tables as before; otherwise the file is left unchanged.
+func UpdateExportMetadata(path string, report *Report) error {
+	if report == nil {
+		return fmt.Errorf("gsm: nil report")
+	}
+	if !report.WFC || !report.CC {
+		return fmt.Errorf("gsm: report for %s records a failed verification", report.Name)
+	}
+	if _, err := Load(path); err != nil {
+		return err
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("gsm: read failed: %w", err)
+	}
+	var old exportFormat
+	if err := json.Unmarshal(data, &old); err != nil {
+		return fmt.Errorf("gsm: unmarshal failed: %w", err)
+	}
+	if report.Name != old.Name || report.VarCount != len(old.Vars) || report.EventCount != len(old.Events) {
+		return fmt.Errorf("gsm: report for %s (%d vars, %d events) does not describe export %s (%d vars, %d events)",
+			report.Name, report.VarCount, report.EventCount, old.Name, len(old.Vars), len(old.Events))
+	}
+	if !reflect.DeepEqual(exportVars(report.vars), old.Vars) {
+		return fmt.Errorf("gsm: report for %s does not describe the variable layout of export %s", report.Name, path)
+	}
+	if !slices.Equal(report.events, old.Events) {
+		return fmt.Errorf("gsm: report for %s does not describe the events of export %s", report.Name, path)
+	}
+
+	now := time.Now().UTC().Format(time.RFC3339)
+	info := old.Verification
+	info.WFC, info.CC = report.WFC, report.CC
+	info.MaxRepairLen = report.MaxRepairLen
+	info.VerifiedAt = now
+	updated, err := replaceTopLevel(data, map[string]any{
+		"exported_at":  now,
+		"verification": info,
+	})
+	if err != nil {
+		return err
+	}
+
+	var check exportFormat
+	if err := json.Unmarshal(updated, &check); err != nil {
+		return fmt.Errorf("gsm: rewritten export does not decode: %w", err)
+	}
+	old.ExportedAt, old.Verification = check.ExportedAt, check.Verification
+	if !reflect.DeepEqual(old, check) {
+		return fmt.Errorf("gsm: rewriting metadata of %s would change its tables", path)
+	}
+	if err := writeFileAtomic(path, updated); err != nil {
+		return fmt.Errorf("gsm: write failed: %w", err)
+	}
+	return nil
+}
+
+// replaceTopLevel returns data with the values of the named top-level keys
+// of its JSON object replaced, leaving every other byte in place. Values
+// that spanned several lines are re-encoded indented to match; others are
+// encoded compactly. Every key must be present.
+func replaceTopLevel(data []byte, values map[string]any) ([]byte, error) {
+	type span struct {
+		start, end int
+		value      []byte
+	}
+	var spans []span
+
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if tok, err := dec.Token(); err != nil || tok != json.Delim('{') {
+		return nil, fmt.Errorf("gsm: export is not a JSON object")
+	}
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, fmt.Errorf("gsm: unmarshal failed: %w", err)
+		}
+		var raw json.RawMessage
+		if err := dec.Decode(&raw); err != nil {
+			return nil, fmt.Errorf("gsm: unmarshal failed: %w", err)
+		}
+		v, ok := values[tok.(string)]
+		if !ok {
+			continue
+		}
+		end := int(dec.InputOffset())
+		start := end - len(raw)
+		var enc []byte
+		if bytes.ContainsRune(raw, '\n') {
+			lineStart := bytes.LastIndexByte(data[:start], '\n') + 1
+			line := data[lineStart:start]
+			indent := line[:len(line)-len(bytes.TrimLeft(line, " \t"))]
+			enc, err = json.MarshalIndent(v, string(indent), "  ")
+		} else {
+			enc, err = json.Marshal(v)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("gsm: marshal failed: %w", err)
+		}
+		spans = append(spans, span{start, end, enc})
+		delete(values, tok.(string))
+	}
+	for key := range values {
+		return nil, fmt.Errorf("gsm: export has no %q field", key)
+	}
+
+	var out bytes.Buffer
+	prev := 0
+	for _, sp := range spans {
+		out.Write(data[prev:sp.start])
+		out.Write(sp.value)
+		prev = sp.end
+	}
+	out.Write(data[prev:])
+	return out.Bytes(), nil
+}
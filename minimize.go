@@ -0,0 +1,75 @@
+package gsm
+
+import "fmt"
+
+// Minimize returns a machine over the quotient of m's reachable states by
+// bisimulation, the classes Report.DuplicateStates lists: unreachable
+// states are dropped and states no event sequence can tell apart are
+// merged. Minimized state i is the i-th class in breadth-first order of
+// its first member, so the initial state is 0, and the machine has a
+// single int variable "state" ranging over the class numbers.
+//
+// The tables match m on every reachable state: for reachable s reached by
+// a path, replaying the path on the minimized machine from NewState lands
+// on the class of s, and each event then leads to the class of
+// m.Apply(s, event). ShortestPath gives such a path for any reachable s.
+// Event names, tags, RequiresPrev constraints, and verified pairs carry
+// over. The variables of m do not, so, like a machine from Load, the
+// result has no invariants or guards, and its exports hold only the class
+// numbers.
+//
+// States are told apart by which events their guards enable, so Minimize
+// needs the guards and returns an error for machines from Load or
+// GobDecode.
+func (m *Machine) Minimize() (*Machine, error) {
+	if m.defs == nil {
+		return nil, fmt.Errorf("gsm: Minimize needs the event guards, which %s was loaded without", m.name)
+	}
+	order := m.explore().order
+	block, classes := bisimulation(order, stepTables(m.step), func(ei int, id uint64) bool {
+		return m.defs[ei].enabled(State{packed: id, vars: m.vars})
+	})
+
+	v := Var{name: "state", kind: IntKind, domain: classes, bits: bitsNeeded(classes)}
+	packedCount := 1 << v.bits
+	class := make(map[uint64]uint64, len(order))
+	var rep []uint64 // first member of each class
+	for i, id := range order {
+		class[id] = uint64(block[i])
+		if block[i] == len(rep) {
+			rep = append(rep, id)
+		}
+	}
+
+	// Encodings past the last class are malformed: nf clamps them like any
+	// int, and step sends them to state 0 (InvalidToZero).
+	nf := make([]uint64, packedCount)
+	for x := range nf {
+		nf[x] = uint64(min(x, classes-1))
+	}
+	step := make([][]uint64, len(m.step))
+	for ei, row := range m.step {
+		step[ei] = make([]uint64, packedCount)
+		for c, id := range rep {
+			step[ei][c] = class[row[id]]
+		}
+	}
+
+	q := &Machine{
+		name:       m.name,
+		vars:       []Var{v},
+		events:     m.events,
+		step:       step,
+		nf:         nf,
+		tags:       m.tags,
+		prev:       m.prev,
+		verified:   m.verified,
+		maxRepair:  m.maxRepair,
+		reachCount: classes,
+		libVersion: m.libVersion,
+	}
+	if err := q.Validate(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
@@ -0,0 +1,66 @@
+package gsm_test
+
+import (
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+func TestMinimize(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	_, report, err := newOrderRegistry().DetectDuplicateStates().Build()
+	if err != nil {
+		t.Fatal(err)
+	}
+	merged := 0
+	for _, class := range report.DuplicateStates {
+		merged += len(class) - 1
+	}
+
+	q, err := m.Minimize()
+	if err != nil {
+		t.Fatalf("Minimize: %v", err)
+	}
+	want := report.ReachableCount - merged
+	if got := len(q.ReachableStates()); got != want || q.Stats().ReachableCount != want {
+		t.Errorf("minimized machine has %d reachable states (Stats %d), want %d", got, q.Stats().ReachableCount, want)
+	}
+	if q.NewState().ID() != 0 {
+		t.Errorf("minimized initial state = %d, want 0", q.NewState().ID())
+	}
+
+	// Replaying a path to any reachable state lands on its class, and each
+	// event then agrees with the original.
+	classOf := func(s gsm.State) gsm.State {
+		path, ok := m.ShortestPath(s)
+		if !ok {
+			t.Fatalf("%s unreachable", s)
+		}
+		c := q.NewState()
+		for _, ev := range path {
+			c = q.Apply(c, ev)
+		}
+		return c
+	}
+	for _, s := range m.ReachableStates() {
+		c := classOf(s)
+		for _, ev := range m.Events() {
+			if got, want := q.Apply(c, ev), classOf(m.Apply(s, ev)); got.ID() != want.ID() {
+				t.Fatalf("from %s (class %s), %s leads to class %s, want %s", s, c, ev, got, want)
+			}
+		}
+	}
+
+	// The minimized machine exports and loads like any other.
+	path := t.TempDir() + "/min.json"
+	if err := q.Export(path); err != nil {
+		t.Fatal(err)
+	}
+	loaded, err := gsm.Load(path)
+	if err != nil {
+		t.Fatalf("Load minimized export: %v", err)
+	}
+	if _, err := loaded.Minimize(); err == nil {
+		t.Error("Minimize of a loaded machine should fail")
+	}
+}
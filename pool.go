@@ -0,0 +1,53 @@
+package gsm
+
+import (
+	"fmt"
+	"sync"
+)
+
+// Pool tracks the current state of many entities running the same machine,
+// keyed by entity ID. It stores only packed state IDs, so each entity costs
+// one map entry. A Pool is safe for concurrent use; Apply on a single
+// entity is atomic.
+type Pool struct {
+	m      *Machine
+	mu     sync.RWMutex
+	states map[string]uint64
+}
+
+// NewPool returns an empty pool for m.
+func NewPool(m *Machine) *Pool {
+	return &Pool{m: m, states: make(map[string]uint64)}
+}
+
+// State returns the entity's current state, or NewState() if the entity
+// has never been seen.
+func (p *Pool) State(entityID string) State {
+	p.mu.RLock()
+	id, ok := p.states[entityID]
+	p.mu.RUnlock()
+	if !ok {
+		id = p.m.initial
+	}
+	return State{packed: id, vars: p.m.vars}
+}
+
+// Apply applies an event to the entity's current state, stores the
+// result, and returns it. New entities start from NewState(). Panics if
+// the event name is unknown.
+func (p *Pool) Apply(entityID, event string) State {
+	ei, ok := p.m.events[event]
+	if !ok {
+		panic(fmt.Sprintf("gsm: unknown event %q", event))
+	}
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	id, seen := p.states[entityID]
+	if !seen {
+		id = p.m.initial
+	}
+	id = p.m.step[ei][id]
+	p.states[entityID] = id
+	return State{packed: id, vars: p.m.vars}
+}
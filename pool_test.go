@@ -0,0 +1,56 @@
+package gsm_test
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+func TestPool(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	p := gsm.NewPool(m)
+
+	if got := p.State("order-1"); got.ID() != m.NewState().ID() {
+		t.Fatalf("new entity should start at NewState(), got %s", got)
+	}
+
+	s := p.Apply("order-1", "restock")
+	s2 := p.Apply("order-1", "process_payment")
+	if want := m.Apply(s, "process_payment"); s2.ID() != want.ID() {
+		t.Fatalf("pooled Apply = %s, want %s", s2, want)
+	}
+	if got := p.State("order-1"); got.ID() != s2.ID() {
+		t.Fatalf("State = %s, want %s", got, s2)
+	}
+	if got := p.State("order-2"); got.ID() != m.NewState().ID() {
+		t.Fatalf("entities must be independent, got %s", got)
+	}
+}
+
+func TestPoolConcurrent(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	p := gsm.NewPool(m)
+
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			id := fmt.Sprintf("order-%d", g%4)
+			for i := 0; i < 100; i++ {
+				p.Apply(id, "restock")
+				p.State(id)
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	inv, _ := m.Var("inventory")
+	for g := 0; g < 4; g++ {
+		if got := p.State(fmt.Sprintf("order-%d", g)).GetInt(inv); got != 5 {
+			t.Errorf("order-%d inventory = %d, want 5 (saturated)", g, got)
+		}
+	}
+}
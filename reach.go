@@ -0,0 +1,227 @@
+package gsm
+
+import "fmt"
+
+// reachableFrom returns every state ID reachable from root by applying
+// events through the step tables, in breadth-first order. The root itself
+// is always included. If limit is positive and more than limit states are
+// reachable, exploration stops with the first limit states and ok is false.
+//
+// The visited set is a bitset over all packedCount encodings, so memory for
+// bookkeeping is fixed at packedCount/8 bytes however many states are
+// found. If onEdge is non-nil it is called for each edge that discovers a
+// new state, which is how explore records its BFS tree.
+func reachableFrom(step stepSource, packedCount int, root uint64, limit int, onEdge func(from uint64, event int, to uint64)) (order []uint64, seen bitset, ok bool) {
+	seen = newBitset(packedCount)
+	seen.set(root)
+	order = []uint64{root}
+	events := step.events()
+	for i := 0; i < len(order); i++ {
+		s := order[i]
+		for ei := 0; ei < events; ei++ {
+			next := step.next(ei, s)
+			if seen.has(next) {
+				continue
+			}
+			if limit > 0 && len(order) == limit {
+				return order, seen, false
+			}
+			seen.set(next)
+			order = append(order, next)
+			if onEdge != nil {
+				onEdge(s, ei, next)
+			}
+		}
+	}
+	return order, seen, true
+}
+
+// reachability is the breadth-first exploration of a machine from its
+// initial state.
+type reachability struct {
+	order  []uint64          // reachable stateIDs in BFS order
+	seen   bitset            // membership over packed IDs
+	parent map[uint64]parent // BFS tree edge into each non-initial state
+}
+
+type parent struct {
+	from  uint64
+	event int
+}
+
+// explore returns the cached BFS exploration from the initial state.
+func (m *Machine) explore() *reachability {
+	m.reachOnce.Do(func() {
+		m.reach.parent = make(map[uint64]parent)
+		m.reach.order, m.reach.seen, _ = reachableFrom(stepTables(m.step), len(m.nf), m.initial, 0,
+			func(from uint64, event int, to uint64) {
+				m.reach.parent[to] = parent{from: from, event: event}
+			})
+	})
+	return &m.reach
+}
+
+// ReachableStates returns every state reachable from NewState() by applying
+// events, in breadth-first order starting with the initial state. The
+// result is computed once and cached; the returned slice is a fresh copy.
+func (m *Machine) ReachableStates() []State {
+	order := m.explore().order
+	states := make([]State, len(order))
+	for i, id := range order {
+		states[i] = State{packed: id, vars: m.vars}
+	}
+	return states
+}
+
+// ReachableStatesLimit is ReachableStates with bounded memory: it explores
+// from NewState() in breadth-first order and stops after max states,
+// returning complete == false if more states are reachable. It does not use
+// or populate the cache behind ReachableStates, so it is suitable for
+// probing machines whose full reachable set is too large to hold.
+func (m *Machine) ReachableStatesLimit(max int) (states []State, complete bool) {
+	if max <= 0 {
+		return nil, false
+	}
+	order, _, complete := reachableFrom(stepTables(m.step), len(m.nf), m.initial, max, nil)
+	states = make([]State, len(order))
+	for i, id := range order {
+		states[i] = State{packed: id, vars: m.vars}
+	}
+	return states, complete
+}
+
+// ShortestPath returns a shortest event sequence leading from NewState() to
+// the target state, and false if the target is unreachable. The path to
+// the initial state itself is empty.
+func (m *Machine) ShortestPath(to State) ([]string, bool) {
+	r := m.explore()
+	if to.packed == m.initial {
+		return []string{}, true
+	}
+	if !r.seen.has(to.packed) {
+		return nil, false
+	}
+	names := m.Events()
+	var path []string
+	for id := to.packed; id != m.initial; {
+		p := r.parent[id]
+		path = append(path, names[p.event])
+		id = p.from
+	}
+	for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+		path[i], path[j] = path[j], path[i]
+	}
+	return path, true
+}
+
+// Predecessors returns the reachable states p for which Apply(p, event) == s,
+// in breadth-first order. Panics if the event name is unknown.
+func (m *Machine) Predecessors(s State, event string) []State {
+	ei, ok := m.events[event]
+	if !ok {
+		panic(fmt.Sprintf("gsm: unknown event %q", event))
+	}
+	m.predOnce.Do(func() {
+		m.preds = make([]map[uint64][]uint64, len(m.step))
+		for e := range m.step {
+			m.preds[e] = make(map[uint64][]uint64)
+		}
+		for _, id := range m.explore().order {
+			for e := range m.step {
+				next := m.step[e][id]
+				m.preds[e][next] = append(m.preds[e][next], id)
+			}
+		}
+	})
+	ids := m.preds[ei][s.packed]
+	states := make([]State, len(ids))
+	for i, id := range ids {
+		states[i] = State{packed: id, vars: m.vars}
+	}
+	return states
+}
+
+// Rollback returns the unique reachable state p with Apply(p, event) == s,
+// undoing the event. It returns false when s has no such predecessor or
+// more than one, since then the inverse is not well defined; a state the
+// event leaves unchanged counts as one of its own predecessors. Panics if
+// the event name is unknown.
+func (m *Machine) Rollback(s State, event string) (State, bool) {
+	preds := m.Predecessors(s, event)
+	if len(preds) != 1 {
+		return State{}, false
+	}
+	return preds[0], true
+}
+
+// Filter returns the reachable states for which pred holds, in
+// breadth-first order.
+func (m *Machine) Filter(pred CheckFunc) []State {
+	var states []State
+	for _, id := range m.explore().order {
+		if s := (State{packed: id, vars: m.vars}); pred(s) {
+			states = append(states, s)
+		}
+	}
+	return states
+}
+
+// Count returns the number of reachable states for which pred holds.
+func (m *Machine) Count(pred CheckFunc) int {
+	n := 0
+	for _, id := range m.explore().order {
+		if pred(State{packed: id, vars: m.vars}) {
+			n++
+		}
+	}
+	return n
+}
+
+// CountViolating returns the number of reachable states that a proposed
+// invariant would reject: those for which pred, written as the
+// invariant's Holds function, is false. Use it to gauge the impact of a
+// constraint before declaring it and its repair.
+func (m *Machine) CountViolating(pred CheckFunc) int {
+	return m.Count(func(s State) bool { return !pred(s) })
+}
+
+// SampleViolating returns up to n reachable states for which pred is
+// false, in breadth-first order, so the first samples are those closest to
+// the initial state. Returns nil if n is not positive.
+func (m *Machine) SampleViolating(pred CheckFunc, n int) []State {
+	if n <= 0 {
+		return nil
+	}
+	var states []State
+	for _, id := range m.explore().order {
+		if s := (State{packed: id, vars: m.vars}); !pred(s) {
+			states = append(states, s)
+			if len(states) == n {
+				break
+			}
+		}
+	}
+	return states
+}
+
+// EnabledCountMap returns, for every reachable state ID, the number of
+// events whose guards pass there: the state's branching factor, for
+// visualizations that color states by how many options they offer.
+// Reachable states are normal forms, so the counts match
+// EnabledEventsNormalized. Machines from Load carry no guards and report
+// every event enabled.
+func (m *Machine) EnabledCountMap() map[uint64]int {
+	order := m.explore().order
+	counts := make(map[uint64]int, len(order))
+	for _, id := range order {
+		s := State{packed: id, vars: m.vars}
+		n := 0
+		for ei := range m.step {
+			if m.defs == nil || m.defs[ei].enabled(s) {
+				n++
+			}
+		}
+		counts[id] = n
+	}
+	return counts
+}
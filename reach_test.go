@@ -0,0 +1,249 @@
+package gsm_test
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+func TestReachableStates(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+
+	states := m.ReachableStates()
+	if len(states) == 0 || states[0].ID() != m.NewState().ID() {
+		t.Fatal("expected BFS order starting at the initial state")
+	}
+	seen := make(map[uint64]bool)
+	for _, s := range states {
+		if seen[s.ID()] {
+			t.Fatalf("duplicate reachable state %s", s)
+		}
+		seen[s.ID()] = true
+		if !m.IsValid(s) {
+			t.Errorf("reachable state %s is not valid", s)
+		}
+	}
+	t.Logf("%d reachable states", len(states))
+}
+
+func TestShortestPath(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+
+	target := m.Apply(m.Apply(m.Apply(m.NewState(), "restock"), "process_payment"), "ship_item")
+	path, ok := m.ShortestPath(target)
+	if !ok {
+		t.Fatalf("expected %s to be reachable", target)
+	}
+	if len(path) != 3 {
+		t.Fatalf("expected a 3-step path, got %v", path)
+	}
+	s := m.NewState()
+	for _, ev := range path {
+		s = m.Apply(s, ev)
+	}
+	if s.ID() != target.ID() {
+		t.Fatalf("path %v leads to %s, want %s", path, s, target)
+	}
+
+	path, ok = m.ShortestPath(m.NewState())
+	if !ok || len(path) != 0 {
+		t.Fatalf("expected empty path to initial state, got %v, %v", path, ok)
+	}
+
+	// status=paid with paid=false is valid but never reached.
+	for _, s := range m.ReachableStates() {
+		if s.String() == "{status=paid, paid=false, inventory=0}" {
+			t.Fatal("unexpected reachable state")
+		}
+	}
+	unreached, err := m.StateFrom(map[string]interface{}{"status": "paid"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := m.ShortestPath(unreached); ok {
+		t.Fatalf("expected %s to be unreachable", unreached)
+	}
+}
+
+func TestPredecessors(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+
+	paid := m.Apply(m.NewState(), "process_payment")
+	preds := m.Predecessors(paid, "process_payment")
+	if len(preds) == 0 {
+		t.Fatal("expected at least one predecessor")
+	}
+	for _, p := range preds {
+		if m.Apply(p, "process_payment").ID() != paid.ID() {
+			t.Errorf("predecessor %s does not lead to %s", p, paid)
+		}
+	}
+}
+
+func TestRollback(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+
+	one := m.Apply(m.NewState(), "restock")
+	prev, ok := m.Rollback(one, "restock")
+	if !ok || prev.ID() != m.NewState().ID() {
+		t.Errorf("Rollback(%s, restock) = %s, %v; want %s", one, prev, ok, m.NewState())
+	}
+
+	if _, ok := m.Rollback(m.NewState(), "restock"); ok {
+		t.Error("initial state has no restock predecessor")
+	}
+
+	// Restock saturates at the inventory maximum, so both 4 and 5 lead to 5.
+	full := m.NewState()
+	for i := 0; i < 6; i++ {
+		full = m.Apply(full, "restock")
+	}
+	if _, ok := m.Rollback(full, "restock"); ok {
+		t.Errorf("Rollback(%s, restock) should be ambiguous", full)
+	}
+}
+
+// TestMachineConcurrentAnalysis exercises the lazily-built caches from many
+// goroutines at once. Run with -race.
+func TestMachineConcurrentAnalysis(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	target := m.Apply(m.Apply(m.NewState(), "restock"), "process_payment")
+
+	var wg sync.WaitGroup
+	for g := 0; g < 32; g++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if len(m.ReachableStates()) == 0 {
+				t.Error("no reachable states")
+			}
+			if _, ok := m.ShortestPath(target); !ok {
+				t.Error("target unreachable")
+			}
+			if len(m.Predecessors(target, "process_payment")) == 0 {
+				t.Error("no predecessors")
+			}
+			m.Lint()
+		}()
+	}
+	wg.Wait()
+}
+
+func TestFilterAndCount(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	inventory, ok := m.Var("inventory")
+	if !ok {
+		t.Fatal("inventory variable not found")
+	}
+	status, _ := m.Var("status")
+
+	empty := func(s gsm.State) bool { return s.GetInt(inventory) == 0 }
+	states := m.Filter(empty)
+	if n := m.Count(empty); n != len(states) {
+		t.Fatalf("Count = %d, Filter returned %d states", n, len(states))
+	}
+	if len(states) == 0 || states[0].ID() != m.NewState().ID() {
+		t.Fatalf("expected the initial state first, got %v", states)
+	}
+	for _, s := range states {
+		if s.GetInt(inventory) != 0 {
+			t.Errorf("Filter returned %s", s)
+		}
+	}
+	t.Logf("%d reachable states with inventory == 0", len(states))
+
+	paidEmpty := func(s gsm.State) bool { return empty(s) && s.Get(status) == "paid" }
+	want := 0
+	for _, s := range m.ReachableStates() {
+		if paidEmpty(s) {
+			want++
+		}
+	}
+	if n := m.Count(paidEmpty); n != want {
+		t.Errorf("Count(paid, inventory == 0) = %d, want %d", n, want)
+	}
+	if n := m.Count(func(gsm.State) bool { return true }); n != 30 {
+		t.Errorf("Count(true) = %d, want 30", n)
+	}
+}
+
+func TestReachableStatesLimit(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	all := m.ReachableStates()
+
+	states, complete := m.ReachableStatesLimit(10)
+	if complete || len(states) != 10 {
+		t.Fatalf("expected 10 states and incomplete, got %d, %v", len(states), complete)
+	}
+	for i, s := range states {
+		if s.ID() != all[i].ID() {
+			t.Fatalf("state %d: got %s, want %s (BFS order)", i, s, all[i])
+		}
+	}
+
+	states, complete = m.ReachableStatesLimit(len(all))
+	if !complete || len(states) != len(all) {
+		t.Fatalf("limit equal to the reachable count: got %d, %v", len(states), complete)
+	}
+
+	if states, complete := m.ReachableStatesLimit(0); complete || states != nil {
+		t.Fatalf("expected nothing for max 0, got %d, %v", len(states), complete)
+	}
+}
+
+func TestCountAndSampleViolating(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	status, _ := m.Var("status")
+	inventory, _ := m.Var("inventory")
+
+	// Proposed invariant: nothing ships while the warehouse is empty.
+	stocked := func(s gsm.State) bool { return s.Get(status) != "shipped" || s.GetInt(inventory) > 0 }
+
+	want := 0
+	for _, s := range m.ReachableStates() {
+		if !stocked(s) {
+			want++
+		}
+	}
+	if want == 0 {
+		t.Fatal("fixture should reach shipped states with no inventory")
+	}
+	if got := m.CountViolating(stocked); got != want {
+		t.Errorf("CountViolating = %d, want %d", got, want)
+	}
+
+	samples := m.SampleViolating(stocked, 2)
+	if len(samples) != min(2, want) {
+		t.Fatalf("SampleViolating returned %d states, want %d", len(samples), min(2, want))
+	}
+	for _, s := range samples {
+		if stocked(s) {
+			t.Errorf("sample %s satisfies the predicate", s)
+		}
+	}
+	if all := m.SampleViolating(stocked, want+10); len(all) != want {
+		t.Errorf("SampleViolating with a large n returned %d states, want %d", len(all), want)
+	}
+	if got := m.SampleViolating(stocked, 0); got != nil {
+		t.Errorf("SampleViolating(0) = %v, want nil", got)
+	}
+}
+
+func TestEnabledCountMap(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	counts := m.EnabledCountMap()
+	reachable := m.ReachableStates()
+	if len(counts) != len(reachable) {
+		t.Fatalf("got %d entries, want one per reachable state (%d)", len(counts), len(reachable))
+	}
+	for _, s := range reachable {
+		if got, want := counts[s.ID()], len(m.EnabledEventsNormalized(s)); got != want {
+			t.Errorf("%s: count %d, want %d", s, got, want)
+		}
+	}
+	// Initially pending with no stock: all but ship_item.
+	if got := counts[m.NewState().ID()]; got != 4 {
+		t.Errorf("initial state count %d, want 4", got)
+	}
+}
@@ -2,6 +2,9 @@ package gsm
 
 import (
 	"fmt"
+	"math"
+	"slices"
+	"sort"
 )
 
 // Registry holds the rules that govern state machines: variables, invariants,
@@ -16,8 +19,52 @@ type Registry struct {
 	invariants     []invariantDef
 	events         []eventDef
 	totalBits      uint
-	independent    [][2]int // pairs of event indices declared independent
-	allIndependent bool     // if true, check all pairs
+	independent    [][2]int    // pairs of event indices declared independent
+	allIndependent bool        // if true, check all pairs
+	ccReachable    bool        // if true, brute-force CC only over reachable states
+	preciseFP      bool        // if true, compute event footprints by simulation
+	initial        EffectFunc  // builds the initial state from the zero state; nil means zero
+	exclusive      [][2]int    // pairs of event indices that must never both be enabled
+	selfPairs      bool        // if true, include (e, e) pairs in CC checking
+	tagPairs       [][2]string // pairs of tags declared independent
+	maxReachable   int         // if positive, fail Build beyond this many reachable states
+	enumDefaults   []enumDefault
+	strictSet      bool // if true, closures see strict states during Build
+	requireWritten bool // if true, fail Build on variables nothing writes or watches
+	enumGroups     []enumGroups
+	absorbing      []absorbingLabel
+	pairConds      map[[2]int]CheckFunc // IndependentWhen conditions, keyed like independent
+	invalidPolicy  InvalidPolicy        // step entries for malformed source encodings
+	maxBits        uint                 // packed encoding ceiling; 0 means maxStateBits
+	maxStates      int                  // state count ceiling; 0 means maxStateSpace
+	declErrs       []error              // misuse recorded during declaration, reported by Validate and Build
+	recordWorst    bool                 // if true, record Report.WorstRepairChain
+	ordered        []int                // OrderedEnum variables, whose repairs must not advance
+	dupStates      bool                 // if true, record Report.DuplicateStates
+	verifyAll      bool                 // if true, check all pairs whatever Independent declared
+	asymPairs      bool                 // if true, record Report.AsymmetricPairs
+	repairHist     bool                 // if true, record Report.RepairHistogram
+	checkDet       bool                 // if true, evaluate closures twice and fail Build if they disagree
+	repairConf     bool                 // if true, record Report.RepairConflicts
+}
+
+// absorbingLabel is an enum value declared with Absorbing.
+type absorbingLabel struct {
+	v   Var
+	raw uint64
+}
+
+// enumGroups is a named grouping of an enum's labels.
+type enumGroups struct {
+	v          Var
+	groups     map[string][]string // group name → labels
+	exhaustive bool                // labels must be partitioned
+}
+
+// enumDefault is an initial enum value declared with EnumDefault.
+type enumDefault struct {
+	v   Var
+	raw uint64
 }
 
 // CheckFunc is a predicate over State.
@@ -31,13 +78,62 @@ type invariantDef struct {
 	footprint []int // indices into vars
 	check     CheckFunc
 	repair    EffectFunc
+	when      CheckFunc // optional enforcement condition, folded into check
+	whenReads []int     // variables when depends on, probed at build time
+}
+
+// watched returns the invariant's full footprint: the declared variables
+// plus any its When condition reads.
+func (inv invariantDef) watched() []int {
+	if len(inv.whenReads) == 0 {
+		return inv.footprint
+	}
+	vs := slices.Clone(inv.footprint)
+	for _, vi := range inv.whenReads {
+		if !slices.Contains(vs, vi) {
+			vs = append(vs, vi)
+		}
+	}
+	return vs
 }
 
 type eventDef struct {
-	name   string
-	writes []int // indices into vars
-	guard  CheckFunc
-	effect EffectFunc
+	name      string
+	writes    []int // indices into vars
+	guard     CheckFunc
+	effect    EffectFunc
+	effectErr func(State) (State, error) // set by ApplyErr instead of effect
+	tags      []string
+	prev      []string // RequiresPrev: events that may immediately precede this one
+}
+
+// enabled reports whether the event's guard passes (events without a guard
+// are always enabled) and, for ApplyErr events, the effect succeeds.
+func (ev eventDef) enabled(s State) bool {
+	if ev.guard != nil && !ev.guard(s) {
+		return false
+	}
+	if ev.effectErr != nil {
+		_, err := ev.effectErr(s)
+		return err == nil
+	}
+	return true
+}
+
+// apply applies the event's effect, or returns s unchanged if the guard
+// fails or an ApplyErr effect returns an error.
+func (ev eventDef) apply(s State) State {
+	if ev.guard != nil && !ev.guard(s) {
+		return s
+	}
+	if ev.effectErr != nil {
+		next, err := ev.effectErr(s)
+		if err != nil {
+			return s
+		}
+		return next
+	}
+	return ev.effect(s)
 }
 
 // NewRegistry creates a Registry for a named state machine.
@@ -53,17 +149,155 @@ func NewRegistry(name string) *Registry {
 //
 // Calling Independent() automatically switches to declared-only mode:
 // only explicitly declared pairs will be verified. This avoids checking
-// all O(n²) event pairs when most are causally ordered.
+// all O(n²) event pairs when most are causally ordered, but every other
+// pair goes unchecked; Report.CCScope and PairsUnchecked say so. Call
+// VerifyAllPairs to keep checking every pair.
+//
+// Pairs are unordered: Independent(a, b) and Independent(b, a) declare the
+// same pair, and repeated declarations are ignored. Naming an event not
+// yet declared is reported by Validate and Build. Pairing an event with
+// itself panics unless CheckSelfPairs was called first.
 func (r *Registry) Independent(e1name, e2name string) *Registry {
+	if !r.knownPair("independent", e1name, e2name) {
+		return r
+	}
+	if err := r.TryIndependent(e1name, e2name); err != nil {
+		panic(err.Error())
+	}
+	return r
+}
+
+// knownPair reports whether both events of a pair are declared, recording
+// a declaration error naming the first unknown one if not.
+func (r *Registry) knownPair(kind, e1name, e2name string) bool {
+	for _, name := range []string{e1name, e2name} {
+		if _, err := r.lookupEvent(name); err != nil {
+			r.declErrs = append(r.declErrs, fmt.Errorf("gsm: %s pair (%q, %q) names unknown event %q", kind, e1name, e2name, name))
+			return false
+		}
+	}
+	return true
+}
+
+// TryIndependent is Independent returning an error instead of panicking
+// when either event is unknown or the pair is an event with itself. On
+// error the registry is left unchanged.
+func (r *Registry) TryIndependent(e1name, e2name string) error {
+	i, err := r.lookupEvent(e1name)
+	if err != nil {
+		return err
+	}
+	j, err := r.lookupEvent(e2name)
+	if err != nil {
+		return err
+	}
+	if i == j && !r.selfPairs {
+		return fmt.Errorf("gsm: event %q declared independent of itself (use CheckSelfPairs)", e1name)
+	}
 	// Auto-switch to declared-only mode when Independent is used
 	r.allIndependent = false
-	r.independent = append(r.independent, [2]int{
+	if i > j {
+		i, j = j, i
+	}
+	if !slices.Contains(r.independent, [2]int{i, j}) {
+		r.independent = append(r.independent, [2]int{i, j})
+	}
+	return nil
+}
+
+// IndependentWhen is Independent with CC required only in the states where
+// pred holds: brute-force checking skips the pair's states that fail pred.
+// This narrows the guarantee. The events may converge to different states
+// when they race in a state outside pred, so pred should cover every state
+// where they can actually arrive concurrently; a typical use excludes a
+// guarded region the pair never reaches together. Proved pairs are reported
+// with method "conditional" (see VerifiedPairs). Pairs proved disjoint
+// need no condition and ignore it. Calling IndependentWhen again for the
+// same pair replaces the condition.
+func (r *Registry) IndependentWhen(e1name, e2name string, pred CheckFunc) *Registry {
+	if !r.knownPair("independent", e1name, e2name) {
+		return r
+	}
+	r.Independent(e1name, e2name)
+	i, j := r.eventIndex(e1name), r.eventIndex(e2name)
+	if i > j {
+		i, j = j, i
+	}
+	if r.pairConds == nil {
+		r.pairConds = make(map[[2]int]CheckFunc)
+	}
+	r.pairConds[[2]int{i, j}] = pred
+	return r
+}
+
+// IndependentTags declares every event tagged tagA independent of every
+// event tagged tagB (see EventBuilder.Tag), as if Independent had been
+// called for each cross pair. Pairs are expanded at Build time, so events
+// may be declared before or after this call. An event carrying both tags is
+// not paired with itself. Like Independent, this switches to declared-only
+// mode.
+func (r *Registry) IndependentTags(tagA, tagB string) *Registry {
+	r.allIndependent = false
+	r.tagPairs = append(r.tagPairs, [2]string{tagA, tagB})
+	return r
+}
+
+// CheckSelfPairs adds every event paired with itself to the Compensation
+// Commutativity (CC) check, for events that may race with concurrent copies
+// of themselves (two restocks arriving out of order). Self-pairs are
+// counted in Report.SelfPairs, separately from PairsTotal.
+//
+// Events are deterministic and unparameterized, so both orderings of two
+// copies of an event are the same sequence and always converge. The pairs
+// are discharged without enumerating states; declaring them makes the
+// verified scope explicit in the report.
+func (r *Registry) CheckSelfPairs() *Registry {
+	r.selfPairs = true
+	return r
+}
+
+// MutuallyExclusive declares that two events must never be enabled in the
+// same reachable state: in every state reachable from the initial state, at
+// least one of their guards must fail. Build fails with a counterexample
+// state if both guards pass anywhere. An event without a guard is always
+// enabled. Naming an event not yet declared is reported by Validate and
+// Build.
+func (r *Registry) MutuallyExclusive(e1name, e2name string) *Registry {
+	if !r.knownPair("exclusive", e1name, e2name) {
+		return r
+	}
+	r.exclusive = append(r.exclusive, [2]int{
 		r.eventIndex(e1name),
 		r.eventIndex(e2name),
 	})
 	return r
 }
 
+// DetectAsymmetricPairs makes Build check every declared independent pair
+// (Independent, IndependentWhen, IndependentTags) for guard asymmetry and
+// record it in Report.AsymmetricPairs: reachable states where both events
+// fire in one order while a guard blocks one of them in the other. CC
+// alone passes such pairs when both orders still converge, although one
+// event enables or disables the other. Every declared pair is checked,
+// including pairs proved disjoint, at the cost of four guard evaluations
+// per reachable state and pair; IndependentWhen conditions restrict the
+// states as they do for CC. Findings are advisory; Build still succeeds.
+func (r *Registry) DetectAsymmetricPairs() *Registry {
+	r.asymPairs = true
+	return r
+}
+
+// VerifyAllPairs checks Compensation Commutativity (CC) for every pair of
+// distinct events, overriding the declared-only mode that Independent,
+// IndependentWhen, and IndependentTags switch to. Declarations then serve
+// only as documentation: conditions given to IndependentWhen are ignored
+// and every pair is checked in every state. Use it when a pair missing
+// from the declarations would be a bug rather than a known causal order.
+func (r *Registry) VerifyAllPairs() *Registry {
+	r.verifyAll = true
+	return r
+}
+
 // OnlyDeclaredPairs explicitly switches Compensation Commutativity (CC) checking
 // to only the event pairs declared via Independent(). This is now automatic when
 // you call Independent(), but this method remains for explicitness and backward
@@ -73,13 +307,396 @@ func (r *Registry) OnlyDeclaredPairs() *Registry {
 	return r
 }
 
+// InitialState sets the machine's starting configuration. The setup function
+// receives the zero state, with any EnumDefault values applied, and returns
+// the initial state, which Machine.NewState() then returns and reachability
+// analysis starts from. Build fails if the initial state violates any invariant.
+func (r *Registry) InitialState(setup func(State) State) *Registry {
+	r.initial = setup
+	return r
+}
+
+// StrictSet makes Build run every guard, effect, and repair on strict
+// states (see State.Strict), so an effect whose SetInt would be clamped
+// fails the build instead of silently saturating. Build returns the
+// out-of-range value as an error, with a nil Report.
+//
+// Strictness is enforced only at build time, which is when closures run;
+// Machine.Apply is a table lookup and never calls SetInt. For strict
+// setters on runtime states, call State.Strict.
+func (r *Registry) StrictSet() *Registry {
+	r.strictSet = true
+	return r
+}
+
+// RequireAllVarsWritten makes Build fail if a variable appears in no
+// event's Writes and no invariant's footprint. Such a variable is a
+// constant: it never changes from its initial value, yet multiplies the
+// state space by its domain.
+func (r *Registry) RequireAllVarsWritten() *Registry {
+	r.requireWritten = true
+	return r
+}
+
+// EnumGroups declares named groups of enum v's labels (for example
+// "open": pending, paid and "closed": shipped, cancelled), queried at
+// runtime with Machine.InGroup. Groups may overlap and need not cover every
+// label; Build fails if a group names a label v does not have. Declaring
+// groups for the same variable again replaces them.
+func (r *Registry) EnumGroups(v Var, groups map[string][]string) *Registry {
+	return r.addEnumGroups(v, groups, false)
+}
+
+// EnumGroupsExhaustive is EnumGroups for a partition: Build additionally
+// fails unless every label of v appears in exactly one group, listing the
+// uncovered and multiply-covered labels.
+func (r *Registry) EnumGroupsExhaustive(v Var, groups map[string][]string) *Registry {
+	return r.addEnumGroups(v, groups, true)
+}
+
+func (r *Registry) addEnumGroups(v Var, groups map[string][]string, exhaustive bool) *Registry {
+	if !r.owns(v) || v.kind != EnumKind {
+		panic(fmt.Sprintf("gsm: EnumGroups: %q is not an enum of this registry", v.name))
+	}
+	r.enumGroups = slices.DeleteFunc(r.enumGroups, func(g enumGroups) bool { return g.v.index == v.index })
+	r.enumGroups = append(r.enumGroups, enumGroups{v: v, groups: cloneGroups(groups), exhaustive: exhaustive})
+	return r
+}
+
+// cloneGroups deep-copies an enum grouping, so later changes by the caller
+// do not alter the declaration.
+func cloneGroups(groups map[string][]string) map[string][]string {
+	c := make(map[string][]string, len(groups))
+	for name, labels := range groups {
+		c[name] = slices.Clone(labels)
+	}
+	return c
+}
+
+// EnumDefault makes label the initial value of enum v, instead of its first
+// declared label. Defaults are applied to the zero state before any
+// InitialState setup function runs, so NewState() reflects them. Panics if
+// v is not an enum of this registry or label is not one of its values.
+func (r *Registry) EnumDefault(v Var, label string) *Registry {
+	if !r.owns(v) || v.kind != EnumKind {
+		panic(fmt.Sprintf("gsm: EnumDefault: %q is not an enum of this registry", v.name))
+	}
+	idx, err := v.enumIndex(label)
+	if err != nil {
+		panic(fmt.Sprintf("gsm: EnumDefault(%q, %q): %v", v.name, label, err))
+	}
+	r.enumDefaults = slices.DeleteFunc(r.enumDefaults, func(d enumDefault) bool { return d.v.index == v.index })
+	r.enumDefaults = append(r.enumDefaults, enumDefault{v: v, raw: uint64(idx)})
+	return r
+}
+
+// Absorbing declares that states where enum v equals label are terminal:
+// no event may leave them. Build fails if any event changes a reachable
+// state with v == label, naming the escaping event; guard such events
+// off, or have them leave the state unchanged. Panics if v is not an enum
+// of this registry or label is not one of its values.
+func (r *Registry) Absorbing(v Var, label string) *Registry {
+	if !r.owns(v) || v.kind != EnumKind {
+		panic(fmt.Sprintf("gsm: Absorbing: %q is not an enum of this registry", v.name))
+	}
+	idx, err := v.enumIndex(label)
+	if err != nil {
+		panic(fmt.Sprintf("gsm: Absorbing(%q, %q): %v", v.name, label, err))
+	}
+	r.absorbing = append(r.absorbing, absorbingLabel{v: v, raw: uint64(idx)})
+	return r
+}
+
+// OrderedEnum declares that enum v's label order is meaningful, with later
+// labels further along (pending < paid < shipped), and that compensation
+// must never advance it. Build fails if some invariant's repair raises v's
+// label index in any valid state where that repair would run, naming the
+// invariant and state; repairs may only roll v back or leave it. Panics if
+// v is not an enum of this registry.
+func (r *Registry) OrderedEnum(v Var) *Registry {
+	if !r.owns(v) || v.kind != EnumKind {
+		panic(fmt.Sprintf("gsm: OrderedEnum: %q is not an enum of this registry", v.name))
+	}
+	if !slices.Contains(r.ordered, v.index) {
+		r.ordered = append(r.ordered, v.index)
+	}
+	return r
+}
+
+// Limits raises or lowers the state-space ceilings Build enforces: at most
+// maxBits bits in the packed encoding and at most maxStates states. The
+// defaults, 20 bits and 1<<20 states, keep builds within about a second
+// and the tables within tens of megabytes; every extra bit roughly doubles
+// both, so raise them only with the memory and time to match (see
+// BuildAndStreamExport). A zero argument keeps that limit's default.
+// Panics if maxBits exceeds 32, the widest encoding Load accepts.
+func (r *Registry) Limits(maxBits uint, maxStates int) *Registry {
+	if maxBits > 32 {
+		panic(fmt.Sprintf("gsm: Limits: %d bits exceeds the 32-bit maximum", maxBits))
+	}
+	r.maxBits, r.maxStates = maxBits, maxStates
+	return r
+}
+
+// InvalidPolicy selects the step table entries for malformed source
+// encodings: IDs in which some variable's raw value is outside its domain
+// (see Machine.WellFormed). Events never run on such states, so the entry
+// is a convention, but Apply on a malformed state returns it.
+type InvalidPolicy int
+
+const (
+	// InvalidToZero maps malformed sources to state 0 for every event. This
+	// is the historical behavior and the default. It is a latent trap:
+	// Apply on a corrupt state silently yields state 0, which looks like a
+	// legitimate, often initial, state.
+	InvalidToZero InvalidPolicy = iota
+
+	// InvalidToSelf maps malformed sources to themselves, so a corrupt
+	// state stays corrupt and remains detectable with WellFormed.
+	InvalidToSelf
+
+	// InvalidToNormalForm applies the event to the source's normal form,
+	// matching Normalize, which clamps malformed encodings into range.
+	InvalidToNormalForm
+)
+
+// InvalidSourcePolicy sets how the step tables treat malformed source
+// encodings; see InvalidPolicy. The default is InvalidToZero. There is no
+// out-of-range error sentinel: exports must hold only encodings of the
+// machine, so InvalidToSelf is the way to keep corruption observable.
+func (r *Registry) InvalidSourcePolicy(policy InvalidPolicy) *Registry {
+	r.invalidPolicy = policy
+	return r
+}
+
+// Estimate reports the state space declared so far: the bits in the packed
+// encoding, the number of states (the product of the variable domains,
+// saturating at math.MaxInt), and whether Build would accept that size
+// under the current limits (see Limits). It can be called at any point
+// during declaration to check feasibility before adding more variables.
+func (r *Registry) Estimate() (bits uint, states int, willBuild bool) {
+	states = 1
+	for _, v := range r.vars {
+		if states > math.MaxInt/v.domain {
+			states = math.MaxInt
+			break
+		}
+		states *= v.domain
+	}
+	maxBits, maxStates := r.limits()
+	return r.totalBits, states, r.totalBits <= maxBits && states <= maxStates
+}
+
+// Validate reports every declaration problem it can find without building:
+// duplicate variable, invariant, or event names; Watches or Writes given a
+// variable of another registry; RequiresPrev, Independent,
+// IndependentWhen, or MutuallyExclusive naming an unknown event; a
+// state space over the limits (see Limits); and, when the space fits,
+// invariant checks that read outside their footprint, effects that change
+// variables outside their write set, and, under CheckDeterminism, impure
+// closures. Build fails on the first of these; Validate collects them
+// all, so config-driven callers can report every problem in one pass. It
+// runs the declared closures on every valid encoding, as Build does.
+//
+// Misuse that is detected at the offending call, such as an enum with
+// fewer than 2 values or an event declared independent of itself, still
+// panics there (see the Try methods for error-returning forms). Validate
+// returns nil if the declarations are sound.
+func (r *Registry) Validate() []error {
+	errs := r.declarationErrors()
+	if _, err := r.newReport(); err != nil {
+		return append(errs, err)
+	}
+	if len(r.declErrs) > 0 {
+		return errs // footprints are incomplete; tracing would misreport
+	}
+	packedCount := 1 << r.totalBits
+	valid := r.validMask(packedCount)
+	r.probeWhenReads(packedCount, valid)
+	errs = append(errs, r.checkReadErrors(packedCount, valid)...)
+	errs = append(errs, r.effectWriteErrors(packedCount, valid)...)
+	if r.checkDet {
+		errs = append(errs, r.determinismErrors(packedCount, valid)...)
+	}
+	return errs
+}
+
+// declarationErrors returns the recorded declaration misuse followed by
+// duplicate names, in declaration order.
+func (r *Registry) declarationErrors() []error {
+	errs := slices.Clone(r.declErrs)
+	dup := func(kind, name string, seen map[string]bool) {
+		if seen[name] {
+			errs = append(errs, fmt.Errorf("gsm: duplicate %s %q", kind, name))
+		}
+		seen[name] = true
+	}
+	seen := make(map[string]bool)
+	for _, v := range r.vars {
+		dup("variable", v.name, seen)
+	}
+	seen = make(map[string]bool)
+	for _, inv := range r.invariants {
+		dup("invariant", inv.name, seen)
+	}
+	seen = make(map[string]bool)
+	for _, ev := range r.events {
+		dup("event", ev.name, seen)
+	}
+	for _, ev := range r.events {
+		for _, p := range ev.prev {
+			if !seen[p] {
+				errs = append(errs, fmt.Errorf("gsm: event %q requires unknown previous event %q", ev.name, p))
+			}
+		}
+	}
+	return errs
+}
+
+// owns reports whether v is a variable handle of this registry.
+func (r *Registry) owns(v Var) bool {
+	return v.index >= 0 && v.index < len(r.vars) && r.vars[v.index].name == v.name && r.vars[v.index].offset == v.offset
+}
+
+// limits returns the effective state-space ceilings.
+func (r *Registry) limits() (maxBits uint, maxStates int) {
+	maxBits, maxStates = maxStateBits, maxStateSpace
+	if r.maxBits > 0 {
+		maxBits = r.maxBits
+	}
+	if r.maxStates > 0 {
+		maxStates = r.maxStates
+	}
+	return maxBits, maxStates
+}
+
+// MaxReachableStates makes Build fail if more than n states are reachable
+// from the initial state. Unlike the bit budget, which bounds the encoding
+// width, this bounds the complexity the model actually exhibits, catching
+// state explosion early. Exploration stops as soon as the limit is passed.
+func (r *Registry) MaxReachableStates(n int) *Registry {
+	r.maxReachable = n
+	return r
+}
+
+// RecordWorstRepair makes Build record the deepest compensation chain in
+// Report.WorstRepairChain, to show which states make repair expensive. It
+// costs one replay of that chain after the normal-form pass.
+func (r *Registry) RecordWorstRepair() *Registry {
+	r.recordWorst = true
+	return r
+}
+
+// DetectRepairConflicts makes Build record Report.RepairConflicts: states
+// that violate two invariants whose repairs change the same variable to
+// different values. Normalization applies the higher-priority repair
+// first, so the outcome in such states depends on declaration order, a
+// dependence nothing else reports. It costs one evaluation of every
+// invariant check per valid state, plus the repairs of the violated ones.
+// Findings are advisory; Build still succeeds.
+func (r *Registry) DetectRepairConflicts() *Registry {
+	r.repairConf = true
+	return r
+}
+
+// CheckDeterminism makes Build evaluate every guard, effect, invariant
+// When condition, check, and repair twice on each valid state and fail,
+// naming the closure and the state, if the two results differ. The tables record one
+// evaluation of each, so all of them must be pure functions of the state;
+// a guard or check reading a clock, a counter, or other hidden state makes
+// the tables inconsistent with the declared model. Repeating an
+// evaluation only catches impurity that shows between consecutive calls.
+// It roughly doubles the cost of evaluating the closures. Validate
+// reports the same failures when this is set.
+func (r *Registry) CheckDeterminism() *Registry {
+	r.checkDet = true
+	return r
+}
+
+// RecordRepairHistogram makes Build record Report.RepairHistogram, the
+// number of valid states at each compensation depth, to tell a few deep
+// repairs apart from deep repair across much of the space. It costs one
+// counter per state in the normal-form pass.
+func (r *Registry) RecordRepairHistogram() *Registry {
+	r.repairHist = true
+	return r
+}
+
+// DetectDuplicateStates makes Build partition the reachable states into
+// behavioral equivalence classes and report the classes with more than one
+// member in Report.DuplicateStates. Equivalent states enable the same
+// events and stay equivalent under every event, so whatever variables
+// distinguish them never influence a guard: a sign of a state-space
+// dimension that could be dropped to shrink the machine.
+func (r *Registry) DetectDuplicateStates() *Registry {
+	r.dupStates = true
+	return r
+}
+
+// CCOverReachable restricts brute-force Compensation Commutativity (CC)
+// checking to states reachable from the initial state, instead of every
+// valid encoding. Pairs proved this way are counted in
+// Report.PairsBruteReachable rather than Report.PairsBrute.
+//
+// This is a weaker guarantee: convergence is proved for every two-event
+// interleaving starting from a reachable state, but not for arbitrary
+// states a caller might construct by hand. Disjointness proofs are
+// unaffected and still hold over all states.
+func (r *Registry) CCOverReachable() *Registry {
+	r.ccReachable = true
+	return r
+}
+
+// PreciseFootprints replaces the static footprint over-approximation used
+// to prove pairs disjoint with one computed by simulation. For each event,
+// every compensation chain it can start from a valid state is replayed, and
+// the footprint becomes the variables the effect actually changes plus the
+// full footprint of every invariant whose repair actually fires.
+//
+// Invariants an event can only trigger in theory drop out, so more pairs may
+// be proved disjoint. Because the effect's real writes are included, a pair
+// the static analysis called disjoint may instead be brute-forced. The net
+// change is reported in Report.PreciseDisjointDelta. Costs one extra pass
+// over the state space per event.
+func (r *Registry) PreciseFootprints() *Registry {
+	r.preciseFP = true
+	return r
+}
+
+// taggedPairs expands IndependentTags declarations into event index pairs.
+func (r *Registry) taggedPairs() [][2]int {
+	var pairs [][2]int
+	for _, tp := range r.tagPairs {
+		for i, ei := range r.events {
+			if !slices.Contains(ei.tags, tp[0]) {
+				continue
+			}
+			for j, ej := range r.events {
+				if i != j && slices.Contains(ej.tags, tp[1]) {
+					pairs = append(pairs, [2]int{i, j})
+				}
+			}
+		}
+	}
+	return pairs
+}
+
 func (r *Registry) eventIndex(name string) int {
+	i, err := r.lookupEvent(name)
+	if err != nil {
+		panic(err.Error())
+	}
+	return i
+}
+
+// lookupEvent is eventIndex returning an error for unknown events.
+func (r *Registry) lookupEvent(name string) (int, error) {
 	for i, ev := range r.events {
 		if ev.name == name {
-			return i
+			return i, nil
 		}
 	}
-	panic(fmt.Sprintf("gsm: unknown event %q", name))
+	return 0, fmt.Errorf("gsm: unknown event %q", name)
 }
 
 // Bool declares a boolean state variable.
@@ -98,10 +715,21 @@ func (r *Registry) Bool(name string) Var {
 	return v
 }
 
-// Enum declares an enumerated state variable.
+// Enum declares an enumerated state variable. Panics if fewer than two
+// values are given.
 func (r *Registry) Enum(name string, values ...string) Var {
+	v, err := r.TryEnum(name, values...)
+	if err != nil {
+		panic(err.Error())
+	}
+	return v
+}
+
+// TryEnum is Enum returning an error instead of panicking. On error no
+// variable is declared.
+func (r *Registry) TryEnum(name string, values ...string) (Var, error) {
 	if len(values) < 2 {
-		panic(fmt.Sprintf("gsm: enum %q needs at least 2 values", name))
+		return Var{}, fmt.Errorf("gsm: enum %q needs at least 2 values", name)
 	}
 	bits := bitsNeeded(len(values))
 	v := Var{
@@ -116,13 +744,23 @@ func (r *Registry) Enum(name string, values ...string) Var {
 	}
 	r.totalBits += bits
 	r.vars = append(r.vars, v)
-	return v
+	return v, nil
 }
 
-// Int declares a bounded integer state variable.
+// Int declares a bounded integer state variable. Panics if max < min.
 func (r *Registry) Int(name string, min, max int) Var {
+	v, err := r.TryInt(name, min, max)
+	if err != nil {
+		panic(err.Error())
+	}
+	return v
+}
+
+// TryInt is Int returning an error instead of panicking. On error no
+// variable is declared.
+func (r *Registry) TryInt(name string, min, max int) (Var, error) {
 	if max < min {
-		panic(fmt.Sprintf("gsm: int %q has max < min", name))
+		return Var{}, fmt.Errorf("gsm: int %q has max < min", name)
 	}
 	domain := max - min + 1
 	bits := bitsNeeded(domain)
@@ -137,6 +775,47 @@ func (r *Registry) Int(name string, min, max int) Var {
 	}
 	r.totalBits += bits
 	r.vars = append(r.vars, v)
+	return v, nil
+}
+
+// IntWithUnit declares a bounded integer state variable, like Int, that
+// carries a display unit for generated UIs and documentation (see
+// Var.Unit).
+func (r *Registry) IntWithUnit(name string, min, max int, unit string) Var {
+	v := r.Int(name, min, max)
+	v.unit = unit
+	r.vars[v.index] = v
+	return v
+}
+
+// IntSet declares an integer state variable that takes only the listed
+// values (e.g. 200, 404, 500). Each value is stored as a compact index, so
+// the variable needs bits for len(values) states rather than the full
+// numeric range. SetInt clamps a non-member to the nearest member.
+func (r *Registry) IntSet(name string, values ...int) Var {
+	if len(values) == 0 {
+		panic(fmt.Sprintf("gsm: int set %q needs at least 1 value", name))
+	}
+	sorted := append([]int(nil), values...)
+	sort.Ints(sorted)
+	for i := 1; i < len(sorted); i++ {
+		if sorted[i] == sorted[i-1] {
+			panic(fmt.Sprintf("gsm: int set %q has duplicate value %d", name, sorted[i]))
+		}
+	}
+	bits := bitsNeeded(len(sorted))
+	v := Var{
+		name:   name,
+		kind:   IntKind,
+		index:  len(r.vars),
+		offset: r.totalBits,
+		bits:   bits,
+		domain: len(sorted),
+		min:    0,
+		values: sorted,
+	}
+	r.totalBits += bits
+	r.vars = append(r.vars, v)
 	return v
 }
 
@@ -158,6 +837,10 @@ func (r *Registry) Invariant(name string) *InvariantBuilder {
 // and which its repair may modify.
 func (ib *InvariantBuilder) Watches(vars ...Var) *InvariantBuilder {
 	for _, v := range vars {
+		if !ib.r.owns(v) {
+			ib.r.declErrs = append(ib.r.declErrs, fmt.Errorf("gsm: invariant %q watches %q, which is not a variable of this registry", ib.def.name, v.name))
+			continue
+		}
 		ib.def.footprint = append(ib.def.footprint, v.index)
 	}
 	return ib
@@ -169,6 +852,41 @@ func (ib *InvariantBuilder) Holds(fn CheckFunc) *InvariantBuilder {
 	return ib
 }
 
+// Couples declares an invariant tying an enum to an int: it watches both
+// variables, so CC analysis sees the coupling, and holds when rule accepts
+// the enum's label and the int's value. It replaces the predicate set by
+// Holds. Panics if enumVar is not an enum or intVar not an int of this
+// registry.
+func (ib *InvariantBuilder) Couples(enumVar Var, intVar Var, rule func(enumLabel string, intVal int) bool) *InvariantBuilder {
+	if err := ib.couples(enumVar, intVar, rule); err != nil {
+		panic(err.Error())
+	}
+	return ib
+}
+
+func (ib *InvariantBuilder) couples(enumVar Var, intVar Var, rule func(enumLabel string, intVal int) bool) error {
+	if !ib.r.owns(enumVar) || enumVar.kind != EnumKind {
+		return fmt.Errorf("gsm: Couples: %q is not an enum of this registry", enumVar.name)
+	}
+	if !ib.r.owns(intVar) || intVar.kind != IntKind {
+		return fmt.Errorf("gsm: Couples: %q is not an int of this registry", intVar.name)
+	}
+	ib.Watches(enumVar, intVar)
+	ib.def.check = func(s State) bool {
+		return rule(s.Get(enumVar), s.GetInt(intVar))
+	}
+	return nil
+}
+
+// When restricts the invariant to states where pred holds; elsewhere it is
+// treated as satisfied. Variables pred reads are detected at build time by
+// probing and added to the invariant's footprint, so they need not be
+// listed in Watches.
+func (ib *InvariantBuilder) When(pred CheckFunc) *InvariantBuilder {
+	ib.def.when = pred
+	return ib
+}
+
 // Repair sets the compensation function. Called when Check returns false.
 // Must only modify variables declared in Over().
 func (ib *InvariantBuilder) Repair(fn EffectFunc) *InvariantBuilder {
@@ -176,15 +894,101 @@ func (ib *InvariantBuilder) Repair(fn EffectFunc) *InvariantBuilder {
 	return ib
 }
 
-// Add registers the invariant with the registry.
+// Add registers the invariant with the registry. Panics if the check or
+// repair function is missing.
 func (ib *InvariantBuilder) Add() {
+	if err := ib.add(); err != nil {
+		panic(err.Error())
+	}
+}
+
+func (ib *InvariantBuilder) add() error {
 	if ib.def.check == nil {
-		panic(fmt.Sprintf("gsm: invariant %q has no check function", ib.def.name))
+		return fmt.Errorf("gsm: invariant %q has no check function", ib.def.name)
 	}
 	if ib.def.repair == nil {
-		panic(fmt.Sprintf("gsm: invariant %q has no repair function", ib.def.name))
+		return fmt.Errorf("gsm: invariant %q has no repair function", ib.def.name)
+	}
+	if when, holds := ib.def.when, ib.def.check; when != nil {
+		ib.def.check = func(s State) bool { return !when(s) || holds(s) }
 	}
 	ib.r.invariants = append(ib.r.invariants, ib.def)
+	return nil
+}
+
+// RemoveInvariant removes the named invariant. Returns false if no
+// invariant has that name. The remaining invariants keep their relative
+// priority order.
+func (r *Registry) RemoveInvariant(name string) bool {
+	for i, inv := range r.invariants {
+		if inv.name == name {
+			r.invariants = append(r.invariants[:i:i], r.invariants[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
+
+// RemoveEvent removes the named event. Returns false if no event has that
+// name. Independent and MutuallyExclusive pairs naming the event are
+// dropped, along with their IndependentWhen conditions, and pairs naming
+// later events are renumbered. The event is also dropped from every other
+// event's RequiresPrev list; an event left with no allowed predecessor is
+// no longer restricted. Removing an event's last Independent pair does not
+// switch back to all-pairs mode.
+func (r *Registry) RemoveEvent(name string) bool {
+	idx := -1
+	for i, ev := range r.events {
+		if ev.name == name {
+			idx = i
+			break
+		}
+	}
+	if idx < 0 {
+		return false
+	}
+	r.events = append(r.events[:idx:idx], r.events[idx+1:]...)
+	r.independent = removeEventFromPairs(r.independent, idx)
+	r.exclusive = removeEventFromPairs(r.exclusive, idx)
+	if r.pairConds != nil {
+		conds := make(map[[2]int]CheckFunc, len(r.pairConds))
+		for p, pred := range r.pairConds {
+			if p, ok := shiftPair(p, idx); ok {
+				conds[p] = pred
+			}
+		}
+		r.pairConds = conds
+	}
+	for i := range r.events {
+		r.events[i].prev = slices.DeleteFunc(r.events[i].prev, func(p string) bool { return p == name })
+	}
+	return true
+}
+
+// removeEventFromPairs drops pairs referencing event idx and shifts higher
+// indices down by one to match the spliced event list.
+func removeEventFromPairs(pairs [][2]int, idx int) [][2]int {
+	var kept [][2]int
+	for _, p := range pairs {
+		if p, ok := shiftPair(p, idx); ok {
+			kept = append(kept, p)
+		}
+	}
+	return kept
+}
+
+// shiftPair renumbers an event pair for the removal of event idx, and
+// reports false if the pair names the removed event.
+func shiftPair(p [2]int, idx int) ([2]int, bool) {
+	if p[0] == idx || p[1] == idx {
+		return p, false
+	}
+	for k := range p {
+		if p[k] > idx {
+			p[k]--
+		}
+	}
+	return p, true
 }
 
 // EventBuilder provides a fluent API for declaring an event.
@@ -204,11 +1008,36 @@ func (r *Registry) Event(name string) *EventBuilder {
 // Writes declares which variables this event modifies.
 func (eb *EventBuilder) Writes(vars ...Var) *EventBuilder {
 	for _, v := range vars {
+		if !eb.r.owns(v) {
+			eb.r.declErrs = append(eb.r.declErrs, fmt.Errorf("gsm: event %q writes %q, which is not a variable of this registry", eb.def.name, v.name))
+			continue
+		}
 		eb.def.writes = append(eb.def.writes, v.index)
 	}
 	return eb
 }
 
+// RequiresPrev restricts the event to fire only directly after prevEvent,
+// within runtimes that track history: Stream and Explorer (see
+// Machine.AllowedAfter). Calling it again adds another allowed
+// predecessor. Elsewhere, the event is rejected as a no-op.
+//
+// This is a runtime-only constraint outside the verified model. The step
+// tables are functions of the state alone, so Build neither enforces nor
+// verifies precedence: Apply ignores it, CC is proved for every order, and
+// exports do not carry it. Build fails if prevEvent is not declared.
+func (eb *EventBuilder) RequiresPrev(prevEvent string) *EventBuilder {
+	eb.def.prev = append(eb.def.prev, prevEvent)
+	return eb
+}
+
+// Tag attaches domain labels (e.g. "payment", "shipping") to the event,
+// used by Registry.IndependentTags to declare independence in bulk.
+func (eb *EventBuilder) Tag(tags ...string) *EventBuilder {
+	eb.def.tags = append(eb.def.tags, tags...)
+	return eb
+}
+
 // Guard sets an optional precondition. If the guard returns false,
 // the event is a no-op in that state.
 func (eb *EventBuilder) Guard(fn CheckFunc) *EventBuilder {
@@ -219,13 +1048,37 @@ func (eb *EventBuilder) Guard(fn CheckFunc) *EventBuilder {
 // Apply sets the event's effect function.
 func (eb *EventBuilder) Apply(fn EffectFunc) *EventBuilder {
 	eb.def.effect = fn
+	eb.def.effectErr = nil
 	return eb
 }
 
-// Add registers the event with the registry.
+// ApplyErr sets an effect function that may reject the event. Where fn
+// returns an error the event is a no-op, exactly as if a guard had failed:
+// the transition is a self-transition and the event counts as disabled for
+// guard-based analyses such as MutuallyExclusive. The guard, if any, is
+// evaluated first and fn is only called where it passes.
+//
+// Like every effect, fn runs at build time to fill the step tables, so its
+// error must depend only on the state. ApplyErr replaces any effect set by
+// Apply, and vice versa.
+func (eb *EventBuilder) ApplyErr(fn func(State) (State, error)) *EventBuilder {
+	eb.def.effectErr = fn
+	eb.def.effect = nil
+	return eb
+}
+
+// Add registers the event with the registry. Panics if no effect function
+// was set.
 func (eb *EventBuilder) Add() {
-	if eb.def.effect == nil {
-		panic(fmt.Sprintf("gsm: event %q has no effect function", eb.def.name))
+	if err := eb.add(); err != nil {
+		panic(err.Error())
+	}
+}
+
+func (eb *EventBuilder) add() error {
+	if eb.def.effect == nil && eb.def.effectErr == nil {
+		return fmt.Errorf("gsm: event %q has no effect function", eb.def.name)
 	}
 	eb.r.events = append(eb.r.events, eb.def)
+	return nil
 }
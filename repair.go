@@ -0,0 +1,54 @@
+package gsm
+
+// MinimalRepairPath returns a shortest sequence of invariant repairs that
+// takes s to a state where every invariant holds, as invariant names in
+// the order they fire. Each step may repair any currently violated
+// invariant, not just the first by priority as Normalize does, so the path
+// can be shorter than the one Normalize takes and may end in a different
+// valid state. It is an explanation aid; Normalize is unaffected.
+//
+// Malformed encodings are clamped into range first, as Normalize does. The
+// result is empty for a valid state, and nil if no ordering reaches a
+// valid state. Loaded machines have no invariants and always return an
+// empty path.
+func (m *Machine) MinimalRepairPath(s State) []string {
+	start := clampState(m.vars, State{packed: s.packed, vars: m.vars})
+
+	type node struct {
+		from      uint64
+		invariant int
+	}
+	parents := map[uint64]node{start.packed: {from: start.packed, invariant: -1}}
+	queue := []uint64{start.packed}
+	for len(queue) > 0 {
+		id := queue[0]
+		queue = queue[1:]
+		cur := State{packed: id, vars: m.vars}
+
+		valid := true
+		for ii, inv := range m.invariants {
+			if inv.check(cur) {
+				continue
+			}
+			valid = false
+			next := inv.repair(cur).packed
+			if _, seen := parents[next]; !seen {
+				parents[next] = node{from: id, invariant: ii}
+				queue = append(queue, next)
+			}
+		}
+		if !valid {
+			continue
+		}
+
+		path := []string{}
+		for p := parents[id]; p.invariant >= 0; p = parents[p.from] {
+			path = append(path, m.invariants[p.invariant].name)
+		}
+		for i, j := 0, len(path)-1; i < j; i, j = i+1, j-1 {
+			path[i], path[j] = path[j], path[i]
+		}
+		return path
+	}
+	return nil
+}
@@ -0,0 +1,89 @@
+package gsm
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+)
+
+// Divergence applies two event sequences in lockstep from NewState() and
+// reports the first step at which their states differ. index is the
+// position (0-based) of the step after which the states diverged, and
+// stateA/stateB are the states at that point. A sequence that runs out of
+// events holds its final state while the other continues.
+//
+// If the sequences never diverge, diverged is false, index is -1, and
+// stateA/stateB are the final states. Panics if an event name is unknown.
+//
+// This is a debugging aid: even when CC holds, guards can make two
+// orderings of the same events reach different states.
+func (m *Machine) Divergence(seqA, seqB []string) (index int, stateA, stateB State, diverged bool) {
+	stateA, stateB = m.NewState(), m.NewState()
+
+	n := len(seqA)
+	if len(seqB) > n {
+		n = len(seqB)
+	}
+	for i := 0; i < n; i++ {
+		if i < len(seqA) {
+			stateA = m.Apply(stateA, seqA[i])
+		}
+		if i < len(seqB) {
+			stateB = m.Apply(stateB, seqB[i])
+		}
+		if stateA.packed != stateB.packed {
+			return i, stateA, stateB, true
+		}
+	}
+	return -1, stateA, stateB, false
+}
+
+// replayEntry is one line of the audit log read by VerifyReplay.
+type replayEntry struct {
+	Event        string  `json:"event"`
+	ExpectedToID *uint64 `json:"expected_to_id"`
+}
+
+// VerifyReplay replays an append-only audit log through the machine to
+// detect drift between the current model and recorded history. r holds
+// newline-delimited JSON entries of the form
+//
+//	{"event": "ship_item", "expected_to_id": 41}
+//
+// Starting from NewState, each event is applied to the running state and
+// the result compared with the recorded state ID. It returns the 1-based
+// line number of the first entry whose result differs, or -1 if every
+// entry matches. Blank lines are skipped but counted. A line that is not
+// a valid entry, or names an unknown event, stops the replay with its
+// line number and an error.
+func (m *Machine) VerifyReplay(r io.Reader) (int, error) {
+	sc := bufio.NewScanner(r)
+	s := m.NewState()
+	for line := 1; sc.Scan(); line++ {
+		text := bytes.TrimSpace(sc.Bytes())
+		if len(text) == 0 {
+			continue
+		}
+		var e replayEntry
+		if err := json.Unmarshal(text, &e); err != nil {
+			return line, fmt.Errorf("gsm: audit line %d: %w", line, err)
+		}
+		if e.ExpectedToID == nil {
+			return line, fmt.Errorf("gsm: audit line %d: missing expected_to_id", line)
+		}
+		ei, ok := m.events[e.Event]
+		if !ok {
+			return line, fmt.Errorf("gsm: audit line %d: unknown event %q", line, e.Event)
+		}
+		s = m.ApplyByIndex(s, ei)
+		if s.packed != *e.ExpectedToID {
+			return line, nil
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return -1, fmt.Errorf("gsm: reading audit log: %w", err)
+	}
+	return -1, nil
+}
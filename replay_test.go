@@ -0,0 +1,94 @@
+package gsm_test
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDivergence(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+
+	// Identical sequences never diverge.
+	seq := []string{"place_order", "restock", "process_payment", "ship_item"}
+	idx, a, b, diverged := m.Divergence(seq, seq)
+	if diverged || idx != -1 || a.ID() != b.ID() {
+		t.Fatalf("identical sequences diverged at %d: %s vs %s", idx, a, b)
+	}
+
+	// Different first events diverge immediately, even though the prefixes
+	// would converge after step 1.
+	seqA := []string{"restock", "place_order", "process_payment"}
+	seqB := []string{"place_order", "restock", "cancel_order"}
+	idx, a, b, diverged = m.Divergence(seqA, seqB)
+	if !diverged {
+		t.Fatal("expected divergence")
+	}
+	if idx != 0 {
+		t.Errorf("expected divergence at step 0, got %d", idx)
+	}
+	t.Logf("diverged at %d: %s vs %s", idx, a, b)
+
+	// Order-dependent because of guards: paying then cancelling ends with
+	// paid=true, but cancelling first blocks payment and leaves paid=false.
+	idx, a, b, diverged = m.Divergence(
+		[]string{"process_payment", "cancel_order"},
+		[]string{"cancel_order", "process_payment"},
+	)
+	if !diverged || idx != 0 {
+		t.Fatalf("expected divergence at step 0, got idx=%d diverged=%v", idx, diverged)
+	}
+	if a.ID() == b.ID() {
+		t.Fatalf("expected distinct states at divergence, got %s", a)
+	}
+}
+
+func TestDivergenceUnequalLengths(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+
+	idx, _, b, diverged := m.Divergence([]string{"restock"}, []string{"restock", "restock"})
+	if !diverged || idx != 1 {
+		t.Fatalf("expected divergence at step 1, got idx=%d diverged=%v", idx, diverged)
+	}
+	if b.String() == "" {
+		t.Fatal("expected a state for the longer sequence")
+	}
+}
+
+func TestVerifyReplay(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+
+	// Record a log from the machine itself, then tamper with it.
+	var lines []string
+	s := m.NewState()
+	for _, ev := range []string{"place_order", "restock", "process_payment", "ship_item"} {
+		s = m.Apply(s, ev)
+		lines = append(lines, fmt.Sprintf(`{"event":%q,"expected_to_id":%d}`, ev, s.ID()))
+	}
+	log := strings.Join(lines, "\n") + "\n"
+
+	if line, err := m.VerifyReplay(strings.NewReader(log)); err != nil || line != -1 {
+		t.Fatalf("faithful log: got line %d, err %v; want -1, nil", line, err)
+	}
+	if line, err := m.VerifyReplay(strings.NewReader("")); err != nil || line != -1 {
+		t.Fatalf("empty log: got line %d, err %v; want -1, nil", line, err)
+	}
+
+	// Blank lines are skipped but still counted.
+	drifted := lines[0] + "\n\n" + lines[1] + "\n" +
+		fmt.Sprintf(`{"event":"process_payment","expected_to_id":%d}`, m.NewState().ID()) + "\n" + lines[3]
+	if line, err := m.VerifyReplay(strings.NewReader(drifted)); err != nil || line != 4 {
+		t.Fatalf("drifted log: got line %d, err %v; want 4, nil", line, err)
+	}
+
+	for name, bad := range map[string]string{
+		"malformed":     lines[0] + "\n{not json\n",
+		"missing id":    lines[0] + "\n" + `{"event":"restock"}` + "\n",
+		"unknown event": lines[0] + "\n" + `{"event":"refund","expected_to_id":0}` + "\n",
+	} {
+		line, err := m.VerifyReplay(strings.NewReader(bad))
+		if err == nil || line != 2 {
+			t.Errorf("%s: got line %d, err %v; want line 2 and an error", name, line, err)
+		}
+	}
+}
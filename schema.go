@@ -0,0 +1,125 @@
+package gsm
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// Schema is the table-free description of an exported machine returned by
+// LoadSchema: its variables, events, and verification metadata. It is for
+// documentation and code generation and cannot apply events; use Load for
+// a runnable machine.
+type Schema struct {
+	Name       string
+	LibVersion string              // library version that wrote the file; empty if not recorded
+	Vars       []VarSpec           // in declaration order, which fixes the bit layout
+	Events     []string            // in index order
+	EventTags  map[string][]string // event name → tags, for tagged events
+
+	WFC        bool // well-formedness verified at build time
+	CC         bool // compensation commutativity verified at build time
+	StateCount int  // number of packed encodings
+}
+
+// schemaFormat is the on-disk form written by ExportSchema: the export
+// format with the nf and step tables left out.
+type schemaFormat struct {
+	Name         string              `json:"name"`
+	Version      int                 `json:"version"`
+	LibVersion   string              `json:"lib_version,omitempty"`
+	Schema       bool                `json:"schema"`
+	Vars         []varExport         `json:"vars"`
+	Events       []string            `json:"events"`
+	EventTags    map[string][]string `json:"event_tags,omitempty"`
+	Verification verifyInfo          `json:"verification"`
+	ExportedAt   string              `json:"exported_at"`
+}
+
+// ExportSchema writes the machine's metadata in the export format but
+// without the nf and step tables, which dominate the size of a full
+// export. The result is marked "schema": true; Load rejects it, and
+// LoadSchema reads it back.
+func (m *Machine) ExportSchema(path string) error {
+	ex := newExport(m.name, m.vars, m.Events(), m.tags, m.initial, m.nf)
+	data, err := json.MarshalIndent(schemaFormat{
+		Name:         ex.Name,
+		Version:      ex.Version,
+		LibVersion:   ex.LibVersion,
+		Schema:       true,
+		Vars:         ex.Vars,
+		Events:       ex.Events,
+		EventTags:    ex.EventTags,
+		Verification: ex.Verification,
+		ExportedAt:   ex.ExportedAt,
+	}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("gsm: marshal failed: %w", err)
+	}
+	if err := writeFileAtomic(path, data); err != nil {
+		return fmt.Errorf("gsm: write failed: %w", err)
+	}
+	return nil
+}
+
+// LoadSchema reads the metadata of a file written by ExportSchema or
+// Export; the tables of a full export are ignored. The variable layout is
+// validated as in Load, including enum fingerprints, and the options apply
+// as they do to Load: newer format or algorithm versions warn, or fail
+// under StrictVersion, and ExpectFingerprint is enforced.
+func LoadSchema(path string, opts ...LoadOption) (*Schema, error) {
+	var cfg loadConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("gsm: read failed: %w", err)
+	}
+
+	var sf schemaFormat
+	if err := json.Unmarshal(data, &sf); err != nil {
+		return nil, fmt.Errorf("gsm: unmarshal failed: %w", err)
+	}
+	if err := cfg.checkVersions(sf.Version, sf.Verification.Algorithm, sf.LibVersion); err != nil {
+		return nil, err
+	}
+	vars, _, err := importVars(sf.Vars)
+	if err != nil {
+		return nil, err
+	}
+	if err := cfg.checkFingerprints(vars); err != nil {
+		return nil, err
+	}
+	seen := make(map[string]bool, len(sf.Events))
+	for _, name := range sf.Events {
+		if seen[name] {
+			return nil, fmt.Errorf("gsm: duplicate event %q", name)
+		}
+		seen[name] = true
+	}
+
+	schema := &Schema{
+		Name:       sf.Name,
+		LibVersion: sf.LibVersion,
+		Vars:       make([]VarSpec, len(sf.Vars)),
+		Events:     sf.Events,
+		EventTags:  sf.EventTags,
+		WFC:        sf.Verification.WFC,
+		CC:         sf.Verification.CC,
+		StateCount: sf.Verification.StateCount,
+	}
+	for i, vd := range sf.Vars {
+		schema.Vars[i] = VarSpec{
+			Name:   vd.Name,
+			Kind:   vd.Kind,
+			Labels: vd.Labels,
+			Min:    vd.Min,
+			Max:    vd.Max,
+			Values: vd.Values,
+			Unit:   vd.Unit,
+		}
+	}
+	return schema, nil
+}
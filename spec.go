@@ -0,0 +1,177 @@
+package gsm
+
+import "fmt"
+
+// Spec is a declarative description of a machine's shape: its variables,
+// invariants, events, and independent pairs. Logic (guards, effects,
+// invariant checks, and repairs) cannot be serialized, so the spec refers
+// to it by name and BuildFromSpec resolves the names through SpecHooks.
+// The JSON field names match the export format where they overlap.
+type Spec struct {
+	Name        string          `json:"name"`
+	Vars        []VarSpec       `json:"vars"`
+	Invariants  []InvariantSpec `json:"invariants,omitempty"`
+	Events      []EventSpec     `json:"events"`
+	Independent [][2]string     `json:"independent,omitempty"`
+}
+
+// VarSpec declares a variable. Kind is "bool", "enum" (with Labels), or
+// "int" (with Min and Max, or with Values for an IntSet). Unit optionally
+// sets a range int's display unit, as IntWithUnit does.
+type VarSpec struct {
+	Name   string   `json:"name"`
+	Kind   string   `json:"kind"`
+	Labels []string `json:"labels,omitempty"`
+	Min    int      `json:"min,omitempty"`
+	Max    int      `json:"max,omitempty"`
+	Values []int    `json:"values,omitempty"`
+	Unit   string   `json:"unit,omitempty"`
+}
+
+// InvariantSpec declares an invariant. Check and Repair name entries in
+// SpecHooks.Checks and SpecHooks.Repairs.
+type InvariantSpec struct {
+	Name    string   `json:"name"`
+	Watches []string `json:"watches"`
+	Check   string   `json:"check"`
+	Repair  string   `json:"repair"`
+}
+
+// EventSpec declares an event. Effect names an entry in SpecHooks.Effects;
+// Guard, if set, names an entry in SpecHooks.Guards.
+type EventSpec struct {
+	Name   string   `json:"name"`
+	Writes []string `json:"writes"`
+	Guard  string   `json:"guard,omitempty"`
+	Effect string   `json:"effect"`
+	Tags   []string `json:"tags,omitempty"`
+}
+
+// SpecHooks supplies the closures a Spec refers to by name. Closures need
+// variable handles; get them from Spec.VarHandles before building.
+type SpecHooks struct {
+	Guards  map[string]CheckFunc
+	Effects map[string]EffectFunc
+	Checks  map[string]CheckFunc
+	Repairs map[string]EffectFunc
+}
+
+// VarHandles returns handles for the spec's variables, keyed by name. The handles
+// are valid for states of the machine BuildFromSpec builds from this spec,
+// since variables are laid out in declaration order.
+func (spec Spec) VarHandles() (map[string]Var, error) {
+	r := NewRegistry(spec.Name)
+	return declareSpecVars(r, spec.Vars)
+}
+
+// BuildFromSpec declares the machine described by spec, resolving closures
+// through hooks, and builds it as Registry.Build does. Malformed specs
+// (unknown kinds, variables, or hooks, and anything the builder methods
+// would panic on) are returned as errors rather than panics.
+func BuildFromSpec(spec Spec, hooks SpecHooks) (*Machine, *Report, error) {
+	r, err := registryFromSpec(spec, hooks)
+	if err != nil {
+		return nil, nil, err
+	}
+	return r.Build()
+}
+
+// registryFromSpec declares everything in spec on a new registry.
+func registryFromSpec(spec Spec, hooks SpecHooks) (r *Registry, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			r, err = nil, fmt.Errorf("%v", p)
+		}
+	}()
+
+	r = NewRegistry(spec.Name)
+	vars, err := declareSpecVars(r, spec.Vars)
+	if err != nil {
+		return nil, err
+	}
+	resolve := func(owner string, names []string) ([]Var, error) {
+		vs := make([]Var, len(names))
+		for i, name := range names {
+			v, ok := vars[name]
+			if !ok {
+				return nil, fmt.Errorf("gsm: %s refers to unknown variable %q", owner, name)
+			}
+			vs[i] = v
+		}
+		return vs, nil
+	}
+
+	for _, is := range spec.Invariants {
+		owner := fmt.Sprintf("invariant %q", is.Name)
+		watches, err := resolve(owner, is.Watches)
+		if err != nil {
+			return nil, err
+		}
+		check, ok := hooks.Checks[is.Check]
+		if !ok {
+			return nil, fmt.Errorf("gsm: %s: no check hook %q", owner, is.Check)
+		}
+		repair, ok := hooks.Repairs[is.Repair]
+		if !ok {
+			return nil, fmt.Errorf("gsm: %s: no repair hook %q", owner, is.Repair)
+		}
+		r.Invariant(is.Name).Watches(watches...).Holds(check).Repair(repair).Add()
+	}
+
+	for _, es := range spec.Events {
+		owner := fmt.Sprintf("event %q", es.Name)
+		writes, err := resolve(owner, es.Writes)
+		if err != nil {
+			return nil, err
+		}
+		effect, ok := hooks.Effects[es.Effect]
+		if !ok {
+			return nil, fmt.Errorf("gsm: %s: no effect hook %q", owner, es.Effect)
+		}
+		eb := r.Event(es.Name).Writes(writes...).Tag(es.Tags...).Apply(effect)
+		if es.Guard != "" {
+			guard, ok := hooks.Guards[es.Guard]
+			if !ok {
+				return nil, fmt.Errorf("gsm: %s: no guard hook %q", owner, es.Guard)
+			}
+			eb.Guard(guard)
+		}
+		eb.Add()
+	}
+
+	for _, p := range spec.Independent {
+		if err := r.TryIndependent(p[0], p[1]); err != nil {
+			return nil, err
+		}
+	}
+	return r, nil
+}
+
+// declareSpecVars declares spec variables on r in order.
+func declareSpecVars(r *Registry, specs []VarSpec) (vars map[string]Var, err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			vars, err = nil, fmt.Errorf("%v", p)
+		}
+	}()
+
+	vars = make(map[string]Var, len(specs))
+	for _, vs := range specs {
+		if _, dup := vars[vs.Name]; dup {
+			return nil, fmt.Errorf("gsm: duplicate variable %q", vs.Name)
+		}
+		switch {
+		case vs.Kind == "bool":
+			vars[vs.Name] = r.Bool(vs.Name)
+		case vs.Kind == "enum":
+			vars[vs.Name] = r.Enum(vs.Name, vs.Labels...)
+		case vs.Kind == "int" && vs.Values != nil:
+			vars[vs.Name] = r.IntSet(vs.Name, vs.Values...)
+		case vs.Kind == "int":
+			vars[vs.Name] = r.IntWithUnit(vs.Name, vs.Min, vs.Max, vs.Unit)
+		default:
+			return nil, fmt.Errorf("gsm: variable %q has unknown kind %q", vs.Name, vs.Kind)
+		}
+	}
+	return vars, nil
+}
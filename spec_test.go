@@ -0,0 +1,116 @@
+package gsm_test
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+const orderSpecJSON = `{
+	"name": "order_fulfillment",
+	"vars": [
+		{"name": "status", "kind": "enum", "labels": ["pending", "paid", "shipped", "cancelled"]},
+		{"name": "paid", "kind": "bool"},
+		{"name": "inventory", "kind": "int", "min": 0, "max": 5}
+	],
+	"invariants": [
+		{"name": "no_ship_unpaid", "watches": ["status", "paid"], "check": "shipped_implies_paid", "repair": "back_to_pending"},
+		{"name": "stock_non_negative", "watches": ["inventory"], "check": "stock_non_negative", "repair": "zero_stock"}
+	],
+	"events": [
+		{"name": "place_order", "writes": ["status", "paid"], "effect": "place"},
+		{"name": "process_payment", "writes": ["status", "paid"], "guard": "is_pending", "effect": "pay"},
+		{"name": "ship_item", "writes": ["status", "inventory"], "guard": "can_ship", "effect": "ship"},
+		{"name": "cancel_order", "writes": ["status"], "guard": "not_shipped", "effect": "cancel"},
+		{"name": "restock", "writes": ["inventory"], "effect": "restock"}
+	],
+	"independent": [
+		["place_order", "restock"],
+		["process_payment", "restock"],
+		["cancel_order", "restock"]
+	]
+}`
+
+func orderSpecHooks(t *testing.T, spec gsm.Spec) gsm.SpecHooks {
+	t.Helper()
+	vars, err := spec.VarHandles()
+	if err != nil {
+		t.Fatal(err)
+	}
+	status, paid, inventory := vars["status"], vars["paid"], vars["inventory"]
+
+	return gsm.SpecHooks{
+		Checks: map[string]gsm.CheckFunc{
+			"shipped_implies_paid": func(s gsm.State) bool { return s.Get(status) != "shipped" || s.GetBool(paid) },
+			"stock_non_negative":   func(s gsm.State) bool { return s.GetInt(inventory) >= 0 },
+		},
+		Repairs: map[string]gsm.EffectFunc{
+			"back_to_pending": func(s gsm.State) gsm.State { return s.Set(status, "pending") },
+			"zero_stock":      func(s gsm.State) gsm.State { return s.SetInt(inventory, 0) },
+		},
+		Guards: map[string]gsm.CheckFunc{
+			"is_pending":  func(s gsm.State) bool { return s.Get(status) == "pending" },
+			"can_ship":    func(s gsm.State) bool { return s.Get(status) == "paid" && s.GetInt(inventory) > 0 },
+			"not_shipped": func(s gsm.State) bool { return s.Get(status) != "shipped" },
+		},
+		Effects: map[string]gsm.EffectFunc{
+			"place":   func(s gsm.State) gsm.State { return s.Set(status, "pending").SetBool(paid, false) },
+			"pay":     func(s gsm.State) gsm.State { return s.Set(status, "paid").SetBool(paid, true) },
+			"ship":    func(s gsm.State) gsm.State { return s.Set(status, "shipped").SetInt(inventory, s.GetInt(inventory)-1) },
+			"cancel":  func(s gsm.State) gsm.State { return s.Set(status, "cancelled") },
+			"restock": func(s gsm.State) gsm.State { return s.SetInt(inventory, s.GetInt(inventory)+1) },
+		},
+	}
+}
+
+func TestBuildFromSpec(t *testing.T) {
+	var spec gsm.Spec
+	if err := json.Unmarshal([]byte(orderSpecJSON), &spec); err != nil {
+		t.Fatal(err)
+	}
+
+	m, report, err := gsm.BuildFromSpec(spec, orderSpecHooks(t, spec))
+	if err != nil {
+		t.Fatalf("BuildFromSpec failed: %v\n%s", err, report)
+	}
+
+	want, wantReport := buildOrderMachine(t)
+	if ok, diff := m.Equivalent(want, nil, nil); !ok {
+		t.Fatalf("spec-built machine differs from builder-built machine: %s", diff)
+	}
+	if report.PairsTotal != wantReport.PairsTotal {
+		t.Errorf("PairsTotal = %d, want %d", report.PairsTotal, wantReport.PairsTotal)
+	}
+}
+
+func TestBuildFromSpecErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		mutate  func(*gsm.Spec)
+		wantErr string
+	}{
+		{"unknown kind", func(s *gsm.Spec) { s.Vars[1].Kind = "float" }, `unknown kind "float"`},
+		{"too few labels", func(s *gsm.Spec) { s.Vars[0].Labels = []string{"only"} }, "at least 2 values"},
+		{"unknown var", func(s *gsm.Spec) { s.Events[4].Writes = []string{"stock"} }, `unknown variable "stock"`},
+		{"missing effect", func(s *gsm.Spec) { s.Events[0].Effect = "nope" }, `no effect hook "nope"`},
+		{"missing guard", func(s *gsm.Spec) { s.Events[1].Guard = "nope" }, `no guard hook "nope"`},
+		{"missing check", func(s *gsm.Spec) { s.Invariants[0].Check = "nope" }, `no check hook "nope"`},
+		{"unknown pair", func(s *gsm.Spec) { s.Independent[0][1] = "refund" }, `unknown event "refund"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var spec gsm.Spec
+			if err := json.Unmarshal([]byte(orderSpecJSON), &spec); err != nil {
+				t.Fatal(err)
+			}
+			hooks := orderSpecHooks(t, spec)
+			tt.mutate(&spec)
+			_, _, err := gsm.BuildFromSpec(spec, hooks)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
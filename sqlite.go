@@ -0,0 +1,406 @@
+package gsm
+
+import (
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+)
+
+// ExportSQLite writes the machine to a SQLite 3 database at path, for
+// querying the transition relation with SQL. The database has four tables:
+//
+//	variables(id INTEGER PRIMARY KEY, name, kind, bit_offset, bits, min, max, labels, int_values)
+//	events(id INTEGER PRIMARY KEY, name)
+//	transitions(from_id, event_id, to_id)
+//	normal_forms(id INTEGER PRIMARY KEY, nf_id, reachable)
+//
+// State and event IDs are the same as in Export. transitions holds one row
+// per well-formed encoding and event, exactly the populated entries of the
+// step table; normal_forms holds every encoding, with reachable set to 1
+// for states reachable from NewState(). labels and int_values are JSON
+// arrays for enum and int set variables and NULL otherwise.
+//
+// The file is written directly in the SQLite file format, without a
+// driver, and is replaced atomically like Export's. It has no indexes;
+// create them after opening if queries need them.
+func (m *Machine) ExportSQLite(path string) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return fmt.Errorf("gsm: write failed: %w", err)
+	}
+	tmpName := tmp.Name()
+
+	if err := m.writeSQLite(tmp); err != nil {
+		return errors.Join(err, tmp.Close(), os.Remove(tmpName))
+	}
+	if err := tmp.Close(); err != nil {
+		return errors.Join(fmt.Errorf("gsm: write failed: %w", err), os.Remove(tmpName))
+	}
+	if err := os.Chmod(tmpName, 0600); err != nil {
+		return errors.Join(fmt.Errorf("gsm: write failed: %w", err), os.Remove(tmpName))
+	}
+	if err := os.Rename(tmpName, path); err != nil {
+		return errors.Join(fmt.Errorf("gsm: write failed: %w", err), os.Remove(tmpName))
+	}
+	return nil
+}
+
+// sqliteSchema is the CREATE TABLE statement of each exported table, in
+// the order they are written.
+var sqliteSchema = []struct{ name, sql string }{
+	{"variables", "CREATE TABLE variables(id INTEGER PRIMARY KEY, name TEXT NOT NULL, kind TEXT NOT NULL, bit_offset INTEGER NOT NULL, bits INTEGER NOT NULL, min INTEGER NOT NULL, max INTEGER NOT NULL, labels TEXT, int_values TEXT)"},
+	{"events", "CREATE TABLE events(id INTEGER PRIMARY KEY, name TEXT NOT NULL)"},
+	{"transitions", "CREATE TABLE transitions(from_id INTEGER NOT NULL, event_id INTEGER NOT NULL, to_id INTEGER NOT NULL)"},
+	{"normal_forms", "CREATE TABLE normal_forms(id INTEGER PRIMARY KEY, nf_id INTEGER NOT NULL, reachable INTEGER NOT NULL)"},
+}
+
+// writeSQLite writes the database to f, which must be empty.
+func (m *Machine) writeSQLite(f *os.File) error {
+	w := &sqliteWriter{f: f, pages: 1} // page 1 is written last
+	reachable := m.explore().seen
+
+	fills := []func(add func(rowid int64, values ...any) error) error{
+		func(add func(int64, ...any) error) error {
+			for _, v := range m.vars {
+				lo, hi := int64(v.min), int64(v.min+v.domain-1)
+				var labels, values any
+				switch {
+				case v.kind == EnumKind:
+					data, _ := json.Marshal(v.labels)
+					labels = string(data)
+				case v.values != nil:
+					data, _ := json.Marshal(v.values)
+					values, lo, hi = string(data), int64(v.values[0]), int64(v.values[len(v.values)-1])
+				}
+				if err := add(int64(v.index), nil, v.name, v.kind.String(), int64(v.offset), int64(v.bits), lo, hi, labels, values); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		func(add func(int64, ...any) error) error {
+			for i, name := range m.Events() {
+				if err := add(int64(i), nil, name); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+		func(add func(int64, ...any) error) error {
+			rowid := int64(1)
+			for id := range m.nf {
+				if !validEncoding(m.vars, uint64(id)) {
+					continue
+				}
+				for ei, row := range m.step {
+					if err := add(rowid, int64(id), int64(ei), int64(row[id])); err != nil {
+						return err
+					}
+					rowid++
+				}
+			}
+			return nil
+		},
+		func(add func(int64, ...any) error) error {
+			for id, nf := range m.nf {
+				var r int64
+				if reachable.has(uint64(id)) {
+					r = 1
+				}
+				if err := add(int64(id), nil, int64(nf), r); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	}
+
+	var schema [][]byte
+	for i, t := range sqliteSchema {
+		root, err := w.writeTable(fills[i])
+		if err != nil {
+			return err
+		}
+		schema = append(schema, sqliteRecord("table", t.name, t.name, int64(root), t.sql))
+	}
+	return w.writeFirstPage(schema)
+}
+
+const (
+	sqlitePageSize    = 4096
+	sqliteLeafTable   = 0x0d
+	sqliteInterior    = 0x05
+	sqliteMaxLocal    = sqlitePageSize - 35             // largest payload kept on a leaf page
+	sqliteMinLocal    = (sqlitePageSize-12)*32/255 - 23 // spill point for overflowing payloads
+	sqliteLeafHeader  = 8                               // b-tree page header, leaf
+	sqliteInnerHeader = 12                              // b-tree page header, interior
+
+	// sqliteFanout is the number of children per interior page, sized
+	// for the largest possible cell (4-byte child, 9-byte key, 2-byte
+	// pointer) plus the right-most pointer.
+	sqliteFanout = (sqlitePageSize-sqliteInnerHeader)/15 + 1
+)
+
+// sqliteWriter writes a SQLite database page by page. Tables are written as
+// rowid b-trees built bottom-up: leaves are filled in rowid order, then
+// interior levels are added over them until a single root remains.
+type sqliteWriter struct {
+	f     *os.File
+	pages uint32 // pages allocated so far
+}
+
+// childRef is a b-tree page and the largest rowid stored under it.
+type childRef struct {
+	page   uint32
+	maxKey int64
+}
+
+func (w *sqliteWriter) alloc() uint32 {
+	w.pages++
+	return w.pages
+}
+
+func (w *sqliteWriter) writePage(pgno uint32, page []byte) error {
+	if _, err := w.f.WriteAt(page, int64(pgno-1)*sqlitePageSize); err != nil {
+		return fmt.Errorf("gsm: write failed: %w", err)
+	}
+	return nil
+}
+
+// writeTable writes a table whose rows fill supplies in ascending rowid
+// order, and returns its root page.
+func (w *sqliteWriter) writeTable(fill func(add func(rowid int64, values ...any) error) error) (uint32, error) {
+	var leaves []childRef
+	var cells [][]byte
+	used := sqliteLeafHeader
+	var lastKey int64
+
+	flush := func() error {
+		pgno := w.alloc()
+		leaves = append(leaves, childRef{page: pgno, maxKey: lastKey})
+		err := w.writePage(pgno, sqliteBTreePage(sqliteLeafTable, 0, cells, 0))
+		cells, used = cells[:0], sqliteLeafHeader
+		return err
+	}
+
+	add := func(rowid int64, values ...any) error {
+		cell, err := w.leafCell(rowid, sqliteRecord(values...))
+		if err != nil {
+			return err
+		}
+		if used+len(cell)+2 > sqlitePageSize {
+			if err := flush(); err != nil {
+				return err
+			}
+		}
+		cells = append(cells, cell)
+		used += len(cell) + 2
+		lastKey = rowid
+		return nil
+	}
+	if err := fill(add); err != nil {
+		return 0, err
+	}
+	if len(cells) > 0 || len(leaves) == 0 {
+		if err := flush(); err != nil {
+			return 0, err
+		}
+	}
+
+	level := leaves
+	for len(level) > 1 {
+		// Spread the children evenly so every interior page has at
+		// least one cell besides its right-most pointer.
+		n := (len(level) + sqliteFanout - 1) / sqliteFanout
+		var parents []childRef
+		for p := 0; p < n; p++ {
+			children := level[p*len(level)/n : (p+1)*len(level)/n]
+			var cells [][]byte
+			for _, c := range children[:len(children)-1] {
+				cell := binary.BigEndian.AppendUint32(nil, c.page)
+				cells = append(cells, appendVarint(cell, uint64(c.maxKey)))
+			}
+			right := children[len(children)-1]
+			pgno := w.alloc()
+			if err := w.writePage(pgno, sqliteBTreePage(sqliteInterior, 0, cells, right.page)); err != nil {
+				return 0, err
+			}
+			parents = append(parents, childRef{page: pgno, maxKey: right.maxKey})
+		}
+		level = parents
+	}
+	return level[0].page, nil
+}
+
+// leafCell encodes a table leaf cell, spilling the payload to overflow
+// pages if it does not fit on the leaf.
+func (w *sqliteWriter) leafCell(rowid int64, payload []byte) ([]byte, error) {
+	cell := appendVarint(nil, uint64(len(payload)))
+	cell = appendVarint(cell, uint64(rowid))
+	if len(payload) <= sqliteMaxLocal {
+		return append(cell, payload...), nil
+	}
+
+	local := sqliteMinLocal + (len(payload)-sqliteMinLocal)%(sqlitePageSize-4)
+	if local > sqliteMaxLocal {
+		local = sqliteMinLocal
+	}
+	cell = append(cell, payload[:local]...)
+	rest := payload[local:]
+
+	first := w.alloc()
+	cell = binary.BigEndian.AppendUint32(cell, first)
+	for pgno := first; len(rest) > 0; {
+		n := min(len(rest), sqlitePageSize-4)
+		var next uint32
+		if n < len(rest) {
+			next = w.alloc()
+		}
+		page := make([]byte, sqlitePageSize)
+		binary.BigEndian.PutUint32(page, next)
+		copy(page[4:], rest[:n])
+		if err := w.writePage(pgno, page); err != nil {
+			return nil, err
+		}
+		rest, pgno = rest[n:], next
+	}
+	return cell, nil
+}
+
+// writeFirstPage writes page 1: the database header followed by the
+// sqlite_schema table as a single leaf.
+func (w *sqliteWriter) writeFirstPage(schema [][]byte) error {
+	var cells [][]byte
+	used := 100 + sqliteLeafHeader
+	for i, rec := range schema {
+		cell := appendVarint(nil, uint64(len(rec)))
+		cell = appendVarint(cell, uint64(i+1))
+		cell = append(cell, rec...)
+		cells = append(cells, cell)
+		used += len(cell) + 2
+	}
+	if used > sqlitePageSize {
+		return fmt.Errorf("gsm: ExportSQLite: schema does not fit the first page")
+	}
+
+	page := sqliteBTreePage(sqliteLeafTable, 100, cells, 0)
+	copy(page, "SQLite format 3\x00")
+	binary.BigEndian.PutUint16(page[16:], sqlitePageSize)
+	page[18], page[19] = 1, 1 // legacy journal mode
+	page[21], page[22], page[23] = 64, 32, 32
+	binary.BigEndian.PutUint32(page[24:], 1)       // file change counter
+	binary.BigEndian.PutUint32(page[28:], w.pages) // database size in pages
+	binary.BigEndian.PutUint32(page[40:], 1)       // schema cookie
+	binary.BigEndian.PutUint32(page[44:], 4)       // schema format
+	binary.BigEndian.PutUint32(page[56:], 1)       // UTF-8
+	binary.BigEndian.PutUint32(page[92:], 1)       // version-valid-for
+	binary.BigEndian.PutUint32(page[96:], 3040001) // SQLite version number
+	return w.writePage(1, page)
+}
+
+// sqliteBTreePage lays out a b-tree page whose header starts at offset
+// (100 on page 1, 0 elsewhere). Cell pointers follow the header and the
+// cells are packed at the end of the page. right is the right-most child
+// of an interior page.
+func sqliteBTreePage(kind byte, offset int, cells [][]byte, right uint32) []byte {
+	page := make([]byte, sqlitePageSize)
+	header := sqliteLeafHeader
+	if kind == sqliteInterior {
+		header = sqliteInnerHeader
+		binary.BigEndian.PutUint32(page[offset+8:], right)
+	}
+	page[offset] = kind
+	binary.BigEndian.PutUint16(page[offset+3:], uint16(len(cells)))
+
+	content := sqlitePageSize
+	for i, cell := range cells {
+		content -= len(cell)
+		copy(page[content:], cell)
+		binary.BigEndian.PutUint16(page[offset+header+2*i:], uint16(content))
+	}
+	if content == sqlitePageSize {
+		content = 0 // an empty content area is recorded as 65536, i.e. 0
+	}
+	binary.BigEndian.PutUint16(page[offset+5:], uint16(content))
+	return page
+}
+
+// sqliteRecord encodes values (nil, int64, or string) in the SQLite record
+// format.
+func sqliteRecord(values ...any) []byte {
+	var types, body []byte
+	for _, v := range values {
+		switch v := v.(type) {
+		case nil:
+			types = appendVarint(types, 0)
+		case int64:
+			switch {
+			case v == 0:
+				types = appendVarint(types, 8)
+			case v == 1:
+				types = appendVarint(types, 9)
+			case v >= -1<<7 && v < 1<<7:
+				types = appendVarint(types, 1)
+				body = append(body, byte(v))
+			case v >= -1<<15 && v < 1<<15:
+				types = appendVarint(types, 2)
+				body = binary.BigEndian.AppendUint16(body, uint16(v))
+			case v >= -1<<23 && v < 1<<23:
+				types = appendVarint(types, 3)
+				body = append(body, byte(v>>16), byte(v>>8), byte(v))
+			case v >= -1<<31 && v < 1<<31:
+				types = appendVarint(types, 4)
+				body = binary.BigEndian.AppendUint32(body, uint32(v))
+			default:
+				types = appendVarint(types, 6)
+				body = binary.BigEndian.AppendUint64(body, uint64(v))
+			}
+		case string:
+			types = appendVarint(types, uint64(13+2*len(v)))
+			body = append(body, v...)
+		default:
+			panic(fmt.Sprintf("gsm: sqliteRecord: unsupported value %T", v))
+		}
+	}
+	// The header size counts itself; one byte suffices below 128.
+	size := len(types) + 1
+	if size >= 128 {
+		size = len(types) + len(appendVarint(nil, uint64(len(types)+2)))
+	}
+	rec := appendVarint(nil, uint64(size))
+	rec = append(rec, types...)
+	return append(rec, body...)
+}
+
+// appendVarint appends v in SQLite's big-endian variable-length integer
+// encoding: 7 bits per byte with the high bit set on all but the last,
+// except that a ninth byte carries a full 8 bits.
+func appendVarint(b []byte, v uint64) []byte {
+	if v > 1<<56-1 {
+		var buf [9]byte
+		buf[8] = byte(v)
+		v >>= 8
+		for i := 7; i >= 0; i-- {
+			buf[i] = byte(v&0x7f) | 0x80
+			v >>= 7
+		}
+		return append(b, buf[:]...)
+	}
+	var buf [8]byte
+	i := len(buf)
+	for {
+		i--
+		buf[i] = byte(v & 0x7f)
+		if i < len(buf)-1 {
+			buf[i] |= 0x80
+		}
+		v >>= 7
+		if v == 0 {
+			break
+		}
+	}
+	return append(b, buf[i:]...)
+}
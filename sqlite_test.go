@@ -0,0 +1,163 @@
+package gsm_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"os"
+	"testing"
+)
+
+// sqliteRows reads every row of the table with the given name from a
+// SQLite database written by ExportSQLite. It understands just enough of
+// the file format for that: table b-trees and records without overflow.
+func sqliteRows(t *testing.T, db []byte, table string) map[int64][]any {
+	t.Helper()
+	const pageSize = 4096
+	page := func(pgno uint32) []byte { return db[int(pgno-1)*pageSize : int(pgno)*pageSize] }
+	varint := func(b []byte) (uint64, int) {
+		var v uint64
+		for i := 0; i < 8; i++ {
+			v = v<<7 | uint64(b[i]&0x7f)
+			if b[i]&0x80 == 0 {
+				return v, i + 1
+			}
+		}
+		return v<<8 | uint64(b[8]), 9
+	}
+	record := func(b []byte) []any {
+		hdr, n := varint(b)
+		body := b[hdr:]
+		var values []any
+		for off := n; off < int(hdr); {
+			st, k := varint(b[off:])
+			off += k
+			switch {
+			case st == 0:
+				values = append(values, nil)
+			case st == 8, st == 9:
+				values = append(values, int64(st-8))
+			case st >= 1 && st <= 6:
+				size := []int{0, 1, 2, 3, 4, 6, 8}[st]
+				var v int64
+				for _, c := range body[:size] {
+					v = v<<8 | int64(c)
+				}
+				if shift := 64 - 8*size; shift > 0 {
+					v = v << shift >> shift // sign-extend
+				}
+				values = append(values, v)
+				body = body[size:]
+			case st >= 13 && st%2 == 1:
+				size := int(st-13) / 2
+				values = append(values, string(body[:size]))
+				body = body[size:]
+			default:
+				t.Fatalf("unsupported serial type %d", st)
+			}
+		}
+		return values
+	}
+
+	rows := make(map[int64][]any)
+	var walk func(pgno uint32, offset int)
+	walk = func(pgno uint32, offset int) {
+		p := page(pgno)
+		h := p[offset:]
+		ncells := int(binary.BigEndian.Uint16(h[3:]))
+		switch h[0] {
+		case 0x0d:
+			for i := 0; i < ncells; i++ {
+				cell := p[binary.BigEndian.Uint16(h[8+2*i:]):]
+				size, n := varint(cell)
+				rowid, k := varint(cell[n:])
+				rows[int64(rowid)] = record(cell[n+k : n+k+int(size)])
+			}
+		case 0x05:
+			for i := 0; i < ncells; i++ {
+				cell := p[binary.BigEndian.Uint16(h[12+2*i:]):]
+				walk(binary.BigEndian.Uint32(cell), 0)
+			}
+			walk(binary.BigEndian.Uint32(h[8:]), 0)
+		default:
+			t.Fatalf("page %d has unexpected type %#x", pgno, h[0])
+		}
+	}
+
+	if table == "sqlite_schema" {
+		walk(1, 100)
+		return rows
+	}
+	for _, row := range sqliteRows(t, db, "sqlite_schema") {
+		if row[1] == table {
+			walk(uint32(row[3].(int64)), 0)
+			return rows
+		}
+	}
+	t.Fatalf("no table %q", table)
+	return nil
+}
+
+func TestExportSQLite(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	path := t.TempDir() + "/order.db"
+	if err := m.ExportSQLite(path); err != nil {
+		t.Fatalf("ExportSQLite: %v", err)
+	}
+	db, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(db, []byte("SQLite format 3\x00")) || len(db)%4096 != 0 {
+		t.Fatalf("not a SQLite database (%d bytes)", len(db))
+	}
+	if pages := binary.BigEndian.Uint32(db[28:]); int(pages)*4096 != len(db) {
+		t.Errorf("header claims %d pages, file has %d", pages, len(db)/4096)
+	}
+
+	vars := sqliteRows(t, db, "variables")
+	if got := vars[0]; got[1] != "status" || got[2] != "enum" || got[7] != `["pending","paid","shipped","cancelled"]` {
+		t.Errorf("unexpected status row %v", got)
+	}
+	if got := vars[2]; got[1] != "inventory" || got[5] != int64(0) || got[6] != int64(5) || got[7] != nil {
+		t.Errorf("unexpected inventory row %v", got)
+	}
+
+	events := sqliteRows(t, db, "events")
+	names := m.Events()
+	if len(events) != len(names) {
+		t.Fatalf("got %d events, want %d", len(events), len(names))
+	}
+	for i, name := range names {
+		if events[int64(i)][1] != name {
+			t.Errorf("event %d is %v, want %s", i, events[int64(i)][1], name)
+		}
+	}
+
+	// Every reachable transition must match Apply.
+	transitions := sqliteRows(t, db, "transitions")
+	to := make(map[[2]int64]int64)
+	for _, row := range transitions {
+		to[[2]int64{row[0].(int64), row[1].(int64)}] = row[2].(int64)
+	}
+	reachable := m.ReachableStates()
+	for _, s := range reachable {
+		for ei, name := range names {
+			want := int64(m.Apply(s, name).ID())
+			if got, ok := to[[2]int64{int64(s.ID()), int64(ei)}]; !ok || got != want {
+				t.Errorf("transition (%s, %s) = %d, %v; want %d", s, name, got, ok, want)
+			}
+		}
+	}
+
+	nf := sqliteRows(t, db, "normal_forms")
+	count := 0
+	for id, row := range nf {
+		if got, _ := m.NormalizeID(uint64(id)); row[1] != int64(got) {
+			t.Errorf("normal form of %d = %v, want %d", id, row[1], got)
+		}
+		count += int(row[2].(int64))
+	}
+	if count != len(reachable) {
+		t.Errorf("%d states marked reachable, want %d", count, len(reachable))
+	}
+}
@@ -0,0 +1,227 @@
+package gsm
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+)
+
+// stepSource provides step table rows to the analyses that follow Phase 2,
+// either from tables held in memory or computed on demand.
+type stepSource interface {
+	events() int
+	// next returns Step[ei][s].
+	next(ei int, s uint64) uint64
+	// row returns event ei's full row. The slice may be reused by later
+	// calls; see lazyStepRows.
+	row(ei int) []uint64
+}
+
+// stepTables is a stepSource over fully materialized step tables.
+type stepTables [][]uint64
+
+func (t stepTables) events() int                  { return len(t) }
+func (t stepTables) next(ei int, s uint64) uint64 { return t[ei][s] }
+func (t stepTables) row(ei int) []uint64          { return t[ei] }
+
+// lazyStepRows is a stepSource that holds at most two rows at a time,
+// recomputing rows as needed. A row is valid until two other rows have
+// been requested, so callers may hold two rows at once, which is what
+// brute-force CC checking needs. Single transitions are computed directly
+// without materializing a row.
+type lazyStepRows struct {
+	r       *Registry
+	c       *buildContext
+	ids     [2]int // event index held in each slot, -1 if empty
+	rows    [2][]uint64
+	recent  int           // slot used most recently
+	elapsed time.Duration // time spent computing rows
+}
+
+func newLazyStepRows(r *Registry, c *buildContext) *lazyStepRows {
+	return &lazyStepRows{r: r, c: c, ids: [2]int{-1, -1}}
+}
+
+func (l *lazyStepRows) events() int { return len(l.r.events) }
+
+func (l *lazyStepRows) next(ei int, s uint64) uint64 {
+	if !l.c.valid.has(s) {
+		switch l.r.invalidPolicy {
+		case InvalidToSelf:
+			return s
+		case InvalidToNormalForm:
+			s = l.c.nf[s]
+		default:
+			return 0
+		}
+	}
+	return l.c.nf[l.r.clampState(l.r.applyEvent(l.r.events[ei], l.c.mkState(s))).packed]
+}
+
+func (l *lazyStepRows) row(ei int) []uint64 {
+	for k, id := range l.ids {
+		if id == ei {
+			l.recent = k
+			return l.rows[k]
+		}
+	}
+	k := 1 - l.recent // evict the least recently used slot
+	if l.rows[k] == nil {
+		l.rows[k] = make([]uint64, l.c.packedCount)
+	}
+	start := time.Now()
+	l.r.computeStepRow(l.c, ei, l.rows[k], nil)
+	l.elapsed += time.Since(start)
+	l.ids[k], l.recent = ei, k
+	return l.rows[k]
+}
+
+// BuildAndStreamExport is BuildAndExport for machines whose full step
+// tables would be too large to hold: it runs the same verification as
+// Build and, only if it passes, writes the export to w, but never holds
+// more than two step rows in memory. Peak memory is the validity bitset,
+// the normal-form table, two rows, and the reachable set, instead of one
+// row per event. No Machine is returned; Load the export to get one.
+//
+// The trade is time: rows are recomputed for each brute-force pair and
+// again for the export, so expect the build to take several times longer
+// than Build. The output is compact JSON that Load reads exactly like the
+// output of Export, including with CompressExport. Nothing is written if
+// verification fails; a write error may leave w holding a partial export.
+func (r *Registry) BuildAndStreamExport(w io.Writer, opts ...ExportOption) (report *Report, err error) {
+	if r.strictSet {
+		defer func() {
+			if p := recover(); p != nil {
+				se, ok := p.(strictSetError)
+				if !ok {
+					panic(p)
+				}
+				report, err = nil, se.error
+			}
+		}()
+	}
+	return r.streamExport(w, opts)
+}
+
+// Verify runs the same verification as Build and returns its report, but
+// builds no Machine and never materializes the step tables: like
+// BuildAndStreamExport, it holds at most two step rows at a time,
+// computing single transitions directly during reachability and rows only
+// for no-op detection and brute-force CC pairs. Use it in CI, where only
+// the verdict matters. Machines whose pairs are all proved disjoint verify
+// in about the time Build takes; brute-force pairs recompute their rows,
+// so those cost more time in exchange for the memory.
+func (r *Registry) Verify() (report *Report, err error) {
+	if r.strictSet {
+		defer func() {
+			if p := recover(); p != nil {
+				se, ok := p.(strictSetError)
+				if !ok {
+					panic(p)
+				}
+				report, err = nil, se.error
+			}
+		}()
+	}
+	return r.verify()
+}
+
+// verify is Verify without the StrictSet panic recovery.
+func (r *Registry) verify() (*Report, error) {
+	report, err := r.begin()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	defer func() { report.Timings.Total = time.Since(start) }()
+
+	c, err := r.prepare(report)
+	if err != nil {
+		return report, err
+	}
+	rows := newLazyStepRows(r, c)
+	defer func() { report.Timings.StepTables = rows.elapsed }()
+	if _, err := r.analyze(c, rows); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// streamExport is BuildAndStreamExport without the StrictSet panic
+// recovery.
+func (r *Registry) streamExport(w io.Writer, opts []ExportOption) (*Report, error) {
+	var cfg exportConfig
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+
+	report, err := r.begin()
+	if err != nil {
+		return nil, err
+	}
+	start := time.Now()
+	defer func() { report.Timings.Total = time.Since(start) }()
+
+	c, err := r.prepare(report)
+	if err != nil {
+		return report, err
+	}
+	rows := newLazyStepRows(r, c)
+	defer func() { report.Timings.StepTables = rows.elapsed }()
+	if _, err := r.analyze(c, rows); err != nil {
+		return report, err
+	}
+
+	events := make([]string, len(r.events))
+	tags := make([][]string, len(r.events))
+	for i, ev := range r.events {
+		events[i] = ev.name
+		tags[i] = ev.tags
+	}
+	export := newExport(r.name, r.vars, events, tags, c.initial, c.nf)
+	export.Verification.MaxRepairLen = report.MaxRepairLen
+	key := "step"
+	if cfg.compress {
+		export.StepEncoding = "rle"
+		key = "step_rle"
+	}
+	if err := writeStreamedExport(w, export, key, len(r.events), func(ei int) any {
+		row := rows.row(ei)
+		if cfg.compress {
+			return encodeRLE(row)
+		}
+		return row
+	}); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// writeStreamedExport writes export, which has no step table, followed by
+// the step rows under key, marshalling one row at a time.
+func writeStreamedExport(w io.Writer, export exportFormat, key string, n int, row func(ei int) any) error {
+	head, err := json.Marshal(export)
+	if err != nil {
+		return fmt.Errorf("gsm: marshal failed: %w", err)
+	}
+	bw := bufio.NewWriter(w)
+	bw.Write(head[:len(head)-1]) // drop the closing brace
+	fmt.Fprintf(bw, ",%q:[", key)
+	for ei := 0; ei < n; ei++ {
+		if ei > 0 {
+			bw.WriteByte(',')
+		}
+		data, err := json.Marshal(row(ei))
+		if err != nil {
+			return fmt.Errorf("gsm: marshal failed: %w", err)
+		}
+		bw.Write(data)
+	}
+	bw.WriteString("]}\n")
+	if err := bw.Flush(); err != nil {
+		return fmt.Errorf("gsm: write failed: %w", err)
+	}
+	return nil
+}
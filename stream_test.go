@@ -0,0 +1,134 @@
+package gsm_test
+
+import (
+	"bytes"
+	"os"
+	"slices"
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+// loadBytes writes an export to a temporary file and loads it.
+func loadBytes(t *testing.T, data []byte) *gsm.Machine {
+	t.Helper()
+	path := t.TempDir() + "/m.gsm.json"
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	m, err := gsm.Load(path)
+	if err != nil {
+		t.Fatalf("Load failed: %v", err)
+	}
+	return m
+}
+
+func TestBuildAndStreamExport(t *testing.T) {
+	built, want, err := newOrderRegistry().Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+
+	for _, tc := range []struct {
+		name string
+		opts []gsm.ExportOption
+	}{
+		{"plain", nil},
+		{"compressed", []gsm.ExportOption{gsm.CompressExport()}},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			report, err := newOrderRegistry().BuildAndStreamExport(&buf, tc.opts...)
+			if err != nil {
+				t.Fatalf("BuildAndStreamExport failed: %v\n%s", err, report)
+			}
+			if report.ReachableCount != want.ReachableCount || report.PairsTotal != want.PairsTotal ||
+				report.PairsDisjoint != want.PairsDisjoint || report.PairsBrute != want.PairsBrute {
+				t.Errorf("streamed report differs from Build:\n%s\nvs\n%s", report, want)
+			}
+
+			m := loadBytes(t, buf.Bytes())
+			if ok, diff := m.Equivalent(built, nil, nil); !ok {
+				t.Errorf("streamed export differs from built machine: %s", diff)
+			}
+			for id := uint64(0); ; id++ {
+				got, err := m.NormalizeID(id)
+				if err != nil {
+					break // past the last encoding
+				}
+				if want, _ := built.NormalizeID(id); got != want {
+					t.Fatalf("normal form of %d: streamed %d, built %d", id, got, want)
+				}
+			}
+		})
+	}
+}
+
+func TestBuildAndStreamExportFailureWritesNothing(t *testing.T) {
+	b := gsm.NewRegistry("bad_machine")
+	x := b.Int("x", 0, 4)
+	b.Invariant("x_bounded").
+		Watches(x).
+		Holds(func(s gsm.State) bool { return s.GetInt(x) <= 3 }).
+		Repair(func(s gsm.State) gsm.State { return s.SetInt(x, 0) }).
+		Add()
+	b.Event("inc_one").
+		Writes(x).
+		Apply(func(s gsm.State) gsm.State { return s.SetInt(x, s.GetInt(x)+1) }).
+		Add()
+	b.Event("inc_two").
+		Writes(x).
+		Apply(func(s gsm.State) gsm.State { return s.SetInt(x, s.GetInt(x)+2) }).
+		Add()
+
+	var buf bytes.Buffer
+	report, err := b.BuildAndStreamExport(&buf)
+	if err == nil {
+		t.Fatal("expected CC failure")
+	}
+	if report == nil || report.CCFailure == nil {
+		t.Errorf("expected a report with the CC failure, got %v", report)
+	}
+	if buf.Len() != 0 {
+		t.Errorf("failed build wrote %d bytes", buf.Len())
+	}
+}
+
+func TestVerify(t *testing.T) {
+	_, want, err := newOrderRegistry().Build()
+	if err != nil {
+		t.Fatalf("Build failed: %v", err)
+	}
+	report, err := newOrderRegistry().Verify()
+	if err != nil {
+		t.Fatalf("Verify failed: %v\n%s", err, report)
+	}
+	if report.Summary() != want.Summary() || report.ReachableCount != want.ReachableCount ||
+		report.PairsBrute != want.PairsBrute || !slices.Equal(report.NoOpEvents, want.NoOpEvents) {
+		t.Errorf("Verify report differs from Build:\n%s\nvs\n%s", report, want)
+	}
+
+	// Brute-force pairs are checked over lazily computed rows.
+	for _, reachable := range []bool{false, true} {
+		b := buildGatedIncrements()
+		if reachable {
+			b.CCOverReachable()
+		}
+		_, builtReport, buildErr := b.Build()
+		b = buildGatedIncrements()
+		if reachable {
+			b.CCOverReachable()
+		}
+		report, err := b.Verify()
+		if (err == nil) != (buildErr == nil) {
+			t.Fatalf("CCOverReachable=%v: Verify error %v, Build error %v", reachable, err, buildErr)
+		}
+		if err != nil && (report.CCFailure == nil || report.CCFailure.State.ID() != builtReport.CCFailure.State.ID() ||
+			report.CCFailure.Event1 != builtReport.CCFailure.Event1) {
+			t.Errorf("CCOverReachable=%v: Verify failure %v, Build failure %v", reachable, report.CCFailure, builtReport.CCFailure)
+		}
+		if err == nil && report.PairsBruteReachable != builtReport.PairsBruteReachable {
+			t.Errorf("CCOverReachable=%v: Verify report differs from Build:\n%s\nvs\n%s", reachable, report, builtReport)
+		}
+	}
+}
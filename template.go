@@ -0,0 +1,66 @@
+package gsm
+
+import (
+	"maps"
+	"slices"
+)
+
+// Template is an immutable snapshot of a Registry's declarations, taken
+// with Registry.Template. Each call to NewRegistry returns an independent
+// Registry with those declarations, which can be extended and built without
+// affecting the template or other registries spawned from it. A Template is
+// safe for concurrent use.
+//
+// Var handles returned by the original Registry remain valid in every
+// spawned Registry and on the machines they build, so closures declared
+// before the snapshot keep working.
+type Template struct {
+	r *Registry
+}
+
+// Template returns a snapshot of the declarations made so far. Later
+// changes to r do not affect the template.
+func (r *Registry) Template() *Template {
+	return &Template{r: r.clone()}
+}
+
+// NewRegistry returns a fresh Registry holding the template's declarations.
+func (t *Template) NewRegistry() *Registry {
+	return t.r.clone()
+}
+
+// clone returns a deep copy of r's declarations. Closures and Var handles
+// are immutable and shared; every slice and map is copied.
+func (r *Registry) clone() *Registry {
+	c := *r
+	c.vars = slices.Clone(r.vars)
+	c.invariants = make([]invariantDef, len(r.invariants))
+	for i, inv := range r.invariants {
+		inv.footprint = slices.Clone(inv.footprint)
+		inv.whenReads = slices.Clone(inv.whenReads)
+		c.invariants[i] = inv
+	}
+	c.events = make([]eventDef, len(r.events))
+	for i, ev := range r.events {
+		ev.writes = slices.Clone(ev.writes)
+		ev.tags = slices.Clone(ev.tags)
+		ev.prev = slices.Clone(ev.prev)
+		c.events[i] = ev
+	}
+	c.independent = slices.Clone(r.independent)
+	c.exclusive = slices.Clone(r.exclusive)
+	c.pairConds = maps.Clone(r.pairConds)
+	c.tagPairs = slices.Clone(r.tagPairs)
+	c.enumDefaults = slices.Clone(r.enumDefaults)
+	c.absorbing = slices.Clone(r.absorbing)
+	c.declErrs = slices.Clone(r.declErrs)
+	c.ordered = slices.Clone(r.ordered)
+	if r.enumGroups != nil {
+		c.enumGroups = make([]enumGroups, len(r.enumGroups))
+		for i, eg := range r.enumGroups {
+			eg.groups = cloneGroups(eg.groups)
+			c.enumGroups[i] = eg
+		}
+	}
+	return &c
+}
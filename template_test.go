@@ -0,0 +1,69 @@
+package gsm_test
+
+import (
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+func TestTemplate(t *testing.T) {
+	b := gsm.NewRegistry("base")
+	n := b.Int("n", 0, 3)
+	b.Event("inc").
+		Writes(n).
+		Apply(func(s gsm.State) gsm.State { return s.SetInt(n, s.GetInt(n)+1) }).
+		Add()
+	tmpl := b.Template()
+
+	// Declarations made after the snapshot do not leak into it.
+	b.Bool("late")
+
+	r1 := tmpl.NewRegistry()
+	r1.Event("reset").
+		Writes(n).
+		Apply(func(s gsm.State) gsm.State { return s.SetInt(n, 0) }).
+		Add()
+
+	r2 := tmpl.NewRegistry()
+	flag := r2.Bool("flag")
+	r2.Event("raise").
+		Writes(flag).
+		Apply(func(s gsm.State) gsm.State { return s.SetBool(flag, true) }).
+		Add()
+
+	m1, report, err := r1.Build()
+	if err != nil {
+		t.Fatalf("r1 Build failed: %v\n%s", err, report)
+	}
+	m2, report, err := r2.Build()
+	if err != nil {
+		t.Fatalf("r2 Build failed: %v\n%s", err, report)
+	}
+
+	if got := m1.Events(); len(got) != 2 || got[1] != "reset" {
+		t.Errorf("m1 events = %v, want [inc reset]", got)
+	}
+	if got := m2.Events(); len(got) != 2 || got[1] != "raise" {
+		t.Errorf("m2 events = %v, want [inc raise]", got)
+	}
+	if _, ok := m1.Var("flag"); ok {
+		t.Error("r2's variable leaked into r1")
+	}
+	if _, ok := m1.Var("late"); ok {
+		t.Error("declaration after Template leaked into the template")
+	}
+
+	// Handles from the original registry work on spawned machines.
+	if got := m1.Apply(m1.NewState(), "inc").GetInt(n); got != 1 {
+		t.Errorf("inc on m1 gave n=%d, want 1", got)
+	}
+
+	// The template itself is unchanged and can spawn more registries.
+	m3, _, err := tmpl.NewRegistry().Build()
+	if err != nil {
+		t.Fatalf("fresh Build failed: %v", err)
+	}
+	if got := m3.Events(); len(got) != 1 {
+		t.Errorf("template events = %v, want [inc]", got)
+	}
+}
@@ -0,0 +1,59 @@
+package gsm
+
+import "fmt"
+
+// Validate checks the internal consistency of the machine's tables and
+// returns the first inconsistency found. A machine produced by Build always
+// passes; Validate exists to catch tables that were corrupted or tampered
+// with after verification, such as a hand-edited export.
+//
+// The checks are: every table has one entry per packed encoding; every
+// normal form is a well-formed, valid state that normalizes to itself;
+// every transition from a valid state lands on a valid state; and the
+// initial state is valid.
+func (m *Machine) Validate() error {
+	var totalBits uint
+	for _, v := range m.vars {
+		totalBits += v.bits
+	}
+	packedCount := 1 << totalBits
+
+	if len(m.nf) != packedCount {
+		return fmt.Errorf("gsm: nf table has %d entries, want %d", len(m.nf), packedCount)
+	}
+	for ei, row := range m.step {
+		if len(row) != packedCount {
+			return fmt.Errorf("gsm: step row %d has %d entries, want %d", ei, len(row), packedCount)
+		}
+	}
+
+	mkState := func(id uint64) State { return State{packed: id, vars: m.vars} }
+	isNF := func(id uint64) bool {
+		return id < uint64(packedCount) && validEncoding(m.vars, id) && m.nf[id] == id
+	}
+
+	for i, id := range m.nf {
+		if !isNF(id) {
+			return fmt.Errorf("gsm: nf maps %s to %d, which is not a normal form", mkState(uint64(i)), id)
+		}
+	}
+	if !isNF(m.initial) {
+		return fmt.Errorf("gsm: initial state %d is not a normal form", m.initial)
+	}
+
+	names := make([]string, len(m.step))
+	for name, ei := range m.events {
+		names[ei] = name
+	}
+	for ei, row := range m.step {
+		for i := 0; i < packedCount; i++ {
+			if !isNF(uint64(i)) {
+				continue
+			}
+			if !isNF(row[i]) {
+				return fmt.Errorf("gsm: event %q maps %s to %d, which is not a normal form", names[ei], mkState(uint64(i)), row[i])
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,317 @@
+package gsm_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/blackwell-systems/gsm"
+)
+
+// newLightRegistry declares a 2-bit machine with one malformed encoding
+// (raw value 3) for hand-built tables.
+func newLightRegistry() *gsm.Registry {
+	b := gsm.NewRegistry("light")
+	light := b.Enum("light", "off", "dim", "on")
+	b.Event("cycle").
+		Writes(light).
+		Apply(func(s gsm.State) gsm.State { return s }).
+		Add()
+	return b
+}
+
+func TestValidate(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	if err := m.Validate(); err != nil {
+		t.Fatalf("built machine failed Validate: %v", err)
+	}
+
+	tests := []struct {
+		name    string
+		initial uint64
+		nf      []uint64
+		step    [][]uint64
+		wantErr string // empty means valid
+	}{
+		{"consistent", 0, []uint64{0, 1, 2, 0}, [][]uint64{{1, 2, 0, 0}}, ""},
+		{"short nf", 0, []uint64{0, 1, 2}, [][]uint64{{1, 2, 0, 0}}, "nf table has 3 entries"},
+		{"short step", 0, []uint64{0, 1, 2, 0}, [][]uint64{{1, 2, 0}}, "step row 0 has 3 entries"},
+		{"nf to malformed", 0, []uint64{0, 1, 2, 3}, [][]uint64{{1, 2, 0, 0}}, "not a normal form"},
+		{"nf not idempotent", 0, []uint64{1, 2, 2, 0}, [][]uint64{{2, 2, 2, 2}}, "not a normal form"},
+		{"step out of range", 0, []uint64{0, 1, 2, 0}, [][]uint64{{1, 9, 0, 0}}, `event "cycle"`},
+		{"step to invalid", 0, []uint64{0, 0, 2, 0}, [][]uint64{{1, 1, 0, 0}}, `event "cycle"`},
+		{"initial invalid", 1, []uint64{0, 0, 2, 0}, [][]uint64{{2, 2, 0, 0}}, "initial state"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			m := gsm.NewMachineFromTables(newLightRegistry(), tt.initial, tt.nf, tt.step)
+			err := m.Validate()
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("expected error containing %q, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsTamperedTables(t *testing.T) {
+	m, _ := buildOrderMachine(t)
+	path := t.TempDir() + "/order.gsm.json"
+	if err := m.Export(path); err != nil {
+		t.Fatalf("Export failed: %v", err)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var export map[string]json.RawMessage
+	if err := json.Unmarshal(data, &export); err != nil {
+		t.Fatal(err)
+	}
+	var step [][]uint64
+	if err := json.Unmarshal(export["step"], &step); err != nil {
+		t.Fatal(err)
+	}
+
+	// Route a transition from the initial state to a well-formed state
+	// that violates an invariant.
+	var bad gsm.State
+	for id := range step[0] {
+		if s := m.StateFromID(uint64(id)); m.WellFormed(s) && !m.IsValid(s) {
+			bad = s
+			break
+		}
+	}
+	step[0][m.NewState().ID()] = bad.ID()
+	if export["step"], err = json.Marshal(step); err != nil {
+		t.Fatal(err)
+	}
+	if data, err = json.Marshal(export); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := gsm.Load(path); err == nil || !strings.Contains(err.Error(), "not a normal form") {
+		t.Fatalf("expected Load to reject tampered step table, got %v", err)
+	}
+}
+
+func TestRegistryValidate(t *testing.T) {
+	if errs := newOrderRegistry().Validate(); errs != nil {
+		t.Fatalf("order registry: unexpected errors %v", errs)
+	}
+
+	other := gsm.NewRegistry("other")
+	foreign := other.Bool("foreign")
+
+	b := gsm.NewRegistry("broken")
+	a := b.Bool("a")
+	c := b.Bool("c")
+	b.Bool("a")
+	b.Invariant("peek").
+		Watches(a).
+		Holds(func(s gsm.State) bool { return !s.GetBool(a) || s.GetBool(c) }).
+		Repair(func(s gsm.State) gsm.State { return s.SetBool(a, false) }).
+		Add()
+	b.Event("set").
+		Writes(a).
+		Apply(func(s gsm.State) gsm.State { return s.SetBool(c, true) }).
+		Add()
+	b.Event("set").
+		Writes(foreign).
+		Apply(func(s gsm.State) gsm.State { return s }).
+		Add()
+
+	errs := b.Validate()
+	want := []string{
+		`event "set" writes "foreign", which is not a variable of this registry`,
+		`duplicate variable "a"`,
+		`duplicate event "set"`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors %v, want %d", len(errs), errs, len(want))
+	}
+	for i, w := range want {
+		if !strings.Contains(errs[i].Error(), w) {
+			t.Errorf("error %d = %v, want it to contain %q", i, errs[i], w)
+		}
+	}
+	if _, _, err := b.Build(); err == nil || err.Error() != errs[0].Error() {
+		t.Errorf("Build error = %v, want the first Validate error", err)
+	}
+
+	// With the names fixed, the tracing checks report every stray access.
+	b = gsm.NewRegistry("traced")
+	a = b.Bool("a")
+	c = b.Bool("c")
+	b.Invariant("peek").
+		Watches(a).
+		Holds(func(s gsm.State) bool { return !s.GetBool(a) || s.GetBool(c) }).
+		Repair(func(s gsm.State) gsm.State { return s.SetBool(a, false) }).
+		Add()
+	b.Event("set").
+		Writes(a).
+		Apply(func(s gsm.State) gsm.State { return s.SetBool(c, true) }).
+		Add()
+	errs = b.Validate()
+	if len(errs) != 2 ||
+		!strings.Contains(errs[0].Error(), `check reads variable "c" outside its footprint`) ||
+		!strings.Contains(errs[1].Error(), `changes variable "c" outside its write set`) {
+		t.Errorf("got %v, want the footprint and write-set errors", errs)
+	}
+
+	// Pairs naming unknown events are collected rather than panicking.
+	b = newOrderRegistry()
+	b.Independent("place_order", "refund")
+	b.IndependentWhen("audit", "restock", func(gsm.State) bool { return true })
+	b.MutuallyExclusive("ship_item", "refund")
+	errs = b.Validate()
+	want = []string{
+		`independent pair ("place_order", "refund") names unknown event "refund"`,
+		`independent pair ("audit", "restock") names unknown event "audit"`,
+		`exclusive pair ("ship_item", "refund") names unknown event "refund"`,
+	}
+	if len(errs) != len(want) {
+		t.Fatalf("got %d errors %v, want %d", len(errs), errs, len(want))
+	}
+	for i, w := range want {
+		if !strings.Contains(errs[i].Error(), w) {
+			t.Errorf("error %d = %v, want it to contain %q", i, errs[i], w)
+		}
+	}
+	if _, _, err := b.Build(); err == nil || err.Error() != errs[0].Error() {
+		t.Errorf("Build error = %v, want the first Validate error", err)
+	}
+
+	// An oversized space is reported without enumerating it.
+	b = gsm.NewRegistry("big").Limits(4, 0)
+	b.Int("n", 0, 31)
+	if errs := b.Validate(); len(errs) != 1 || !strings.Contains(errs[0].Error(), "too large") {
+		t.Errorf("got %v, want the size error", errs)
+	}
+}
+
+func TestCheckDeterminism(t *testing.T) {
+	// Each flip alternates its result on every call, as a closure over a
+	// counter would.
+	flip := func() func(gsm.State) bool {
+		calls := 0
+		return func(gsm.State) bool { calls++; return calls%2 == 0 }
+	}
+
+	newRegistry := func(impure string) *gsm.Registry {
+		b := gsm.NewRegistry("purity")
+		x := b.Int("x", 0, 3)
+		holds := func(s gsm.State) bool { return s.GetInt(x) < 3 }
+		if impure == "check" {
+			holds = flip()
+		}
+		ib := b.Invariant("x_small").
+			Watches(x).
+			Holds(holds).
+			Repair(func(s gsm.State) gsm.State { return s.SetInt(x, 0) })
+		if impure == "when" {
+			ib.When(flip())
+		}
+		ib.Add()
+		guard := func(s gsm.State) bool { return s.GetInt(x) < 3 }
+		if impure == "guard" {
+			guard = flip()
+		}
+		bumps := 0
+		b.Event("bump").
+			Writes(x).
+			Guard(guard).
+			Apply(func(s gsm.State) gsm.State {
+				if impure == "effect" {
+					bumps++
+					return s.SetInt(x, bumps%2)
+				}
+				return s.SetInt(x, s.GetInt(x)+1)
+			}).
+			Add()
+		return b
+	}
+
+	if _, _, err := newRegistry("").CheckDeterminism().Build(); err != nil {
+		t.Errorf("pure closures: %v", err)
+	}
+	if _, _, err := newRegistry("guard").Build(); err != nil {
+		t.Errorf("impure guard without CheckDeterminism should build: %v", err)
+	}
+	for impure, want := range map[string]string{
+		"guard":  `guard of event "bump" is not deterministic`,
+		"effect": `effect of event "bump" is not deterministic`,
+		"check":  `check of invariant "x_small" is not deterministic`,
+		"when":   `When condition of invariant "x_small" is not deterministic`,
+	} {
+		_, _, err := newRegistry(impure).CheckDeterminism().Build()
+		if err == nil || !strings.Contains(err.Error(), want) || !strings.Contains(err.Error(), "{x=") {
+			t.Errorf("impure %s: Build err = %v, want %q with the state", impure, err, want)
+		}
+		errs := newRegistry(impure).CheckDeterminism().Validate()
+		if len(errs) == 0 || !strings.Contains(fmt.Sprint(errs), want) {
+			t.Errorf("impure %s: Validate = %v, want %q", impure, errs, want)
+		}
+		if impure == "when" && strings.Contains(fmt.Sprint(errs), "check of invariant") {
+			t.Errorf("impure When also blamed on the check: %v", errs)
+		}
+	}
+}
+
+func TestReportDeclarationErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		declare func(b *gsm.Registry)
+		want    string
+	}{
+		{"footprint read", func(b *gsm.Registry) {
+			a, c := b.Bool("a"), b.Bool("c")
+			b.Invariant("peek").Watches(a).
+				Holds(func(s gsm.State) bool { return !s.GetBool(a) || s.GetBool(c) }).
+				Repair(func(s gsm.State) gsm.State { return s.SetBool(a, false) }).
+				Add()
+		}, `reads variable "c" outside its footprint`},
+		{"write set", func(b *gsm.Registry) {
+			a, c := b.Bool("a"), b.Bool("c")
+			b.Event("set").Writes(a).Apply(func(s gsm.State) gsm.State { return s.SetBool(c, true) }).Add()
+		}, `changes variable "c" outside its write set`},
+		{"unused variable", func(b *gsm.Registry) {
+			b.RequireAllVarsWritten()
+			b.Bool("idle")
+		}, `"idle"`},
+		{"enum groups", func(b *gsm.Registry) {
+			status := b.Enum("status", "open", "closed")
+			b.EnumGroups(status, map[string][]string{"live": {"opened"}})
+		}, `"opened"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b := gsm.NewRegistry("decl")
+			tt.declare(b)
+			_, report, err := b.Build()
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Build error = %v, want it to contain %s", err, tt.want)
+			}
+			if len(report.DeclarationErrors) == 0 || report.DeclarationErrors[0].Error() != err.Error() {
+				t.Fatalf("DeclarationErrors = %v, want the Build error first", report.DeclarationErrors)
+			}
+			if got := report.Summary(); !strings.Contains(got, "DECLARATION FAIL") || !strings.Contains(got, tt.want) {
+				t.Errorf("Summary = %q", got)
+			}
+			got := report.String()
+			if !strings.Contains(got, "Declarations: FAIL") || strings.Contains(got, "does not terminate") {
+				t.Errorf("String should report the declaration error, not a WFC failure:\n%s", got)
+			}
+		})
+	}
+}
@@ -4,7 +4,11 @@
 // the same valid state regardless of ordering.
 package gsm
 
-import "fmt"
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+)
 
 // VarKind distinguishes variable types.
 type VarKind int
@@ -15,6 +19,19 @@ const (
 	IntKind
 )
 
+// String names the kind as in exports: "bool", "enum", or "int".
+func (k VarKind) String() string {
+	switch k {
+	case BoolKind:
+		return "bool"
+	case EnumKind:
+		return "enum"
+	case IntKind:
+		return "int"
+	}
+	return fmt.Sprintf("VarKind(%d)", int(k))
+}
+
 // Var is a handle to a declared state variable. Users receive Vars from
 // the Builder and pass them to State accessors.
 type Var struct {
@@ -26,11 +43,83 @@ type Var struct {
 	domain int      // number of distinct values
 	labels []string // enum: value names; nil otherwise
 	min    int      // int: minimum value (bool/enum: 0)
+	values []int    // int set: ascending member values; nil otherwise
+	unit   string   // int: display unit from IntWithUnit; "" otherwise
 }
 
 // Name returns the variable's declared name.
 func (v Var) Name() string { return v.name }
 
+// Unit returns the display unit of an int variable declared with
+// IntWithUnit (e.g. "USD cents"), or "" if it has none. The unit is
+// carried through Export and Load but does not affect the encoding.
+func (v Var) Unit() string { return v.unit }
+
+// Fingerprint returns a stable hash of an enum variable's ordered labels.
+// Reordering, renaming, adding, or removing labels changes the fingerprint,
+// which is how Load detects exports whose enum indices no longer mean what
+// the caller expects. Returns "" for non-enum variables.
+func (v Var) Fingerprint() string {
+	if v.kind != EnumKind {
+		return ""
+	}
+	return labelFingerprint(v.labels)
+}
+
+// labelFingerprint hashes an ordered label list.
+func labelFingerprint(labels []string) string {
+	h := sha256.New()
+	for _, l := range labels {
+		h.Write([]byte(l))
+		h.Write([]byte{0})
+	}
+	return hex.EncodeToString(h.Sum(nil)[:8])
+}
+
+// intIndex returns the raw index for an int value and whether the value is
+// a member of the domain. Non-members map to the nearest member (clamping),
+// preferring the lower one on ties.
+func (v *Var) intIndex(val int) (uint64, bool) {
+	if v.values == nil {
+		max := v.min + v.domain - 1
+		switch {
+		case val < v.min:
+			return 0, false
+		case val > max:
+			return uint64(v.domain - 1), false
+		}
+		return uint64(val - v.min), true
+	}
+	best := 0
+	for i, m := range v.values {
+		if m == val {
+			return uint64(i), true
+		}
+		if abs(m-val) < abs(v.values[best]-val) {
+			best = i
+		}
+	}
+	return uint64(best), false
+}
+
+// intValue returns the int value for a raw index.
+func (v *Var) intValue(raw uint64) int {
+	if v.values == nil {
+		return int(raw) + v.min
+	}
+	if raw >= uint64(len(v.values)) {
+		return v.values[len(v.values)-1]
+	}
+	return v.values[raw]
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
+
 // bitsNeeded returns the minimum bits to represent n distinct values.
 func bitsNeeded(n int) uint {
 	if n <= 1 {
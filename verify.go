@@ -1,9 +1,20 @@
 package gsm
 
-import "fmt"
+import (
+	"encoding/binary"
+	"fmt"
+	"maps"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+)
 
-// maxStateSpace is the default ceiling on enumerable states.
-const maxStateSpace = 1 << 20 // ~1M states
+// Default ceilings on the state space; see Registry.Limits.
+const (
+	maxStateBits  = 20      // bits in the packed encoding
+	maxStateSpace = 1 << 20 // ~1M states
+)
 
 // Report contains the results of build-time verification.
 type Report struct {
@@ -12,16 +23,182 @@ type Report struct {
 	VarCount   int
 	EventCount int
 
+	// ReachableCount is the number of states reachable from the initial
+	// state (0 if the build failed before reachability analysis).
+	ReachableCount int
+
+	// ReachableLimit is the MaxReachableStates limit when Build stopped
+	// because more states than that were reachable, and 0 otherwise. CC
+	// and the later checks did not run.
+	ReachableLimit int
+
+	// DeclarationErrors holds the problems that stopped Build before WFC
+	// was checked: invariant checks reading outside their footprint,
+	// effects writing outside their write set, impure closures under
+	// CheckDeterminism, unused variables under RequireAllVarsWritten,
+	// advancing OrderedEnum repairs, bad enum groups, and an invalid
+	// initial state. Build returns the first. WFC is false but was not
+	// evaluated when any are present.
+	DeclarationErrors []error
+
 	// WFC results
 	WFC          bool
 	MaxRepairLen int // longest compensation chain
 
+	// WorstRepairChain is the deepest compensation chain, from the
+	// violating state through each repair to its normal form, so it holds
+	// MaxRepairLen+1 states. Among equally deep chains it is the one from
+	// the lowest state ID. Nil unless Registry.RecordWorstRepair was used
+	// or when no state needs repair.
+	WorstRepairChain []State
+
+	// RepairConflicts lists pairs of invariants whose repairs compete:
+	// a state violates both, and each repair changes the same variable to
+	// a different value, so which one wins depends on invariant priority
+	// and reordering the declarations changes the model. Each pair and
+	// variable is reported once, at the first such state. Nil unless
+	// Registry.DetectRepairConflicts was used.
+	RepairConflicts []RepairConflict
+
+	// RepairHistogram counts valid states by compensation depth: index d
+	// holds the number of valid states whose normal form took exactly d
+	// repair steps, so index 0 counts states that satisfy every invariant
+	// and the last index is MaxRepairLen. Nil unless
+	// Registry.RecordRepairHistogram was used.
+	RepairHistogram []int
+
 	// CC results
 	CC            bool
 	PairsTotal    int
 	PairsDisjoint int        // proved by footprint disjointness
 	PairsBrute    int        // proved by exhaustive check
 	CCFailure     *CCFailure // non-nil if CC failed
+
+	// CCScope is "all" when CC covered every pair of distinct events
+	// (the default, or Registry.VerifyAllPairs) and "declared" when only
+	// pairs declared with Independent, IndependentWhen, or IndependentTags
+	// were checked. PairsUnchecked counts the pairs outside the scope, for
+	// which the report proves nothing. CCScope is empty if the build
+	// failed before CC.
+	CCScope        string
+	PairsUnchecked int
+
+	// SelfPairs counts events checked against themselves
+	// (see Registry.CheckSelfPairs). Not included in PairsTotal.
+	SelfPairs int
+
+	// PairsBruteReachable counts pairs proved by exhaustive check over
+	// reachable states only (see Registry.CCOverReachable).
+	PairsBruteReachable int
+
+	// PreciseDisjointDelta is the number of pairs proved disjoint under
+	// Registry.PreciseFootprints minus the number the static analysis would
+	// have proved. Zero unless PreciseFootprints is enabled.
+	PreciseDisjointDelta int
+
+	// ExclusionFailure is non-nil if a MutuallyExclusive pair was found
+	// enabled together in a reachable state.
+	ExclusionFailure *ExclusionFailure
+
+	// AbsorbingFailure is non-nil if an event was found leaving a
+	// reachable state declared Absorbing.
+	AbsorbingFailure *AbsorbingFailure
+
+	// Advisory findings (non-fatal)
+	NoOpEvents []string // events that leave every valid state unchanged
+
+	// GuardMaskedPairs lists brute-force-checked pairs, as "(e1, e2)",
+	// that commute in every checked state but never with both events
+	// firing in both orders: in each state a guard blocks one of them.
+	// Such commutativity is vacuous and breaks as soon as a guard is
+	// relaxed. A pair whose IndependentWhen condition holds in no checked
+	// state is not listed.
+	GuardMaskedPairs []string
+
+	// AsymmetricPairs lists declared independent pairs whose guards
+	// depend on each other: in the recorded reachable state both events
+	// fire in one order, but in the other a guard blocks one of them. CC
+	// can pass such a pair, by convergence or disjoint footprints, yet one
+	// event enables or disables the other, a causal dependency the
+	// declaration denies. Nil unless Registry.DetectAsymmetricPairs was
+	// used.
+	AsymmetricPairs []AsymmetricPair
+
+	// ContradictoryGuards lists events with a guard that is false in every
+	// reachable state. Reachable states satisfy every invariant, so such a
+	// guard can only hold where some invariant is violated and the event
+	// never fires; it is almost always a modeling error.
+	ContradictoryGuards []string
+
+	// DuplicateStates lists classes of reachable states that no sequence of
+	// events can tell apart: from every member, each event sequence enables
+	// the same events at every step. Only classes with more than one member
+	// are listed, each in breadth-first order. Members differ only in
+	// variables that never influence a guard, which can usually be removed.
+	// Nil unless Registry.DetectDuplicateStates was used.
+	DuplicateStates [][]State
+
+	// VarCoupling maps each variable name to the number of invariants
+	// whose footprint includes it. Variables shared by several invariants
+	// widen every event footprint that touches them and are what push
+	// event pairs into brute-force checking.
+	VarCoupling map[string]int
+
+	// Timings records wall-clock time spent in Build. Phases the build
+	// did not reach are zero.
+	Timings Timings
+
+	vars   []Var    // variable layout, for UpdateExportMetadata
+	events []string // event names in declaration order
+}
+
+// Timings breaks down Build's wall-clock time by phase. Total covers the
+// whole build, including phases not listed separately.
+type Timings struct {
+	NormalForms time.Duration // Phase 1: WFC and normal forms
+	StepTables  time.Duration // Phase 2: step tables
+	CC          time.Duration // Phase 3: compensation commutativity
+	Total       time.Duration
+}
+
+// ExclusionFailure describes a reachable state in which two events declared
+// mutually exclusive are both enabled.
+type ExclusionFailure struct {
+	Event1 string
+	Event2 string
+	State  State
+}
+
+// AbsorbingFailure describes an event that leaves a reachable state whose
+// enum Var holds the Absorbing Label.
+type AbsorbingFailure struct {
+	Event string
+	Var   string
+	Label string
+	State State
+	Next  State // the event's result from State
+}
+
+// RepairConflict describes a state in which two violated invariants'
+// repairs write a variable to different values. Invariant1 has the higher
+// priority, so its repair is the one normalization applies first.
+type RepairConflict struct {
+	State      State
+	Invariant1 string
+	Invariant2 string
+	Var        string
+	Repair1    State // Invariant1's repair applied to State
+	Repair2    State // Invariant2's repair applied to State
+}
+
+// AsymmetricPair describes a state in which a declared independent pair
+// fires completely in only one order.
+type AsymmetricPair struct {
+	Event1 string
+	Event2 string
+	State  State
+	Fired1 bool // both events fired in order Event1 then Event2
+	Fired2 bool // both events fired in order Event2 then Event1
 }
 
 // CCFailure describes a specific CC violation.
@@ -31,22 +208,53 @@ type CCFailure struct {
 	State   State
 	Result1 State // apply e1 then e2
 	Result2 State // apply e2 then e1
+	Fired1  bool  // both events fired (no guard blocked) in order e1 then e2
+	Fired2  bool  // both events fired in order e2 then e1
 }
 
 func (r *Report) String() string {
 	s := fmt.Sprintf("Machine: %s\n", r.Name)
 	s += fmt.Sprintf("  Variables: %d\n", r.VarCount)
 	s += fmt.Sprintf("  States: %d\n", r.StateCount)
+	if r.ReachableCount > 0 {
+		s += fmt.Sprintf("  Reachable: %d\n", r.ReachableCount)
+	}
+	if r.ReachableLimit > 0 {
+		s += fmt.Sprintf("  Reachable: FAIL (more than %d states; see MaxReachableStates)\n", r.ReachableLimit)
+	}
 	s += fmt.Sprintf("  Events: %d\n", r.EventCount)
 	s += "\n"
 
-	if r.WFC {
+	if len(r.DeclarationErrors) > 0 {
+		s += "  Declarations: FAIL\n"
+		for _, err := range r.DeclarationErrors {
+			s += fmt.Sprintf("    %s\n", strings.TrimPrefix(err.Error(), "gsm: "))
+		}
+		s += "  WFC: not checked\n"
+	} else if r.WFC {
 		s += fmt.Sprintf("  WFC: PASS (max repair depth: %d)\n", r.MaxRepairLen)
+		if len(r.WorstRepairChain) > 0 {
+			chain := make([]string, len(r.WorstRepairChain))
+			for i, st := range r.WorstRepairChain {
+				chain[i] = st.String()
+			}
+			s += fmt.Sprintf("    Worst repair: %s\n", strings.Join(chain, " → "))
+		}
 	} else {
 		s += "  WFC: FAIL (compensation does not terminate)\n"
 	}
+	if len(r.RepairHistogram) > 1 {
+		depths := make([]string, len(r.RepairHistogram))
+		for d, n := range r.RepairHistogram {
+			depths[d] = fmt.Sprintf("%d:%d", d, n)
+		}
+		s += fmt.Sprintf("    Repair depths: %s\n", strings.Join(depths, " "))
+	}
 
-	if r.CC {
+	if r.CC && r.PairsBruteReachable > 0 {
+		s += fmt.Sprintf("  CC (Compensation Commutativity): PASS (%d pairs: %d disjoint, %d brute-force, %d brute-force over reachable states)\n",
+			r.PairsTotal, r.PairsDisjoint, r.PairsBrute, r.PairsBruteReachable)
+	} else if r.CC {
 		s += fmt.Sprintf("  CC (Compensation Commutativity): PASS (%d pairs: %d disjoint, %d brute-force)\n",
 			r.PairsTotal, r.PairsDisjoint, r.PairsBrute)
 	} else if r.CCFailure != nil {
@@ -55,90 +263,443 @@ func (r *Report) String() string {
 		s += fmt.Sprintf("    State:  %s\n", r.CCFailure.State)
 		s += fmt.Sprintf("    %s→%s: %s\n", r.CCFailure.Event1, r.CCFailure.Event2, r.CCFailure.Result1)
 		s += fmt.Sprintf("    %s→%s: %s\n", r.CCFailure.Event2, r.CCFailure.Event1, r.CCFailure.Result2)
+		if !r.CCFailure.Fired1 || !r.CCFailure.Fired2 {
+			s += "    (a guard blocked one event in at least one order)\n"
+		}
+	}
+
+	switch r.CCScope {
+	case "all":
+		s += "    Scope: all event pairs\n"
+	case "declared":
+		s += fmt.Sprintf("    Scope: declared pairs only (%d unchecked; see VerifyAllPairs)\n", r.PairsUnchecked)
+	}
+
+	if r.SelfPairs > 0 {
+		s += fmt.Sprintf("  Self-pairs: %d (each event commutes with itself)\n", r.SelfPairs)
 	}
 
-	if r.WFC && r.CC {
+	if f := r.ExclusionFailure; f != nil {
+		s += fmt.Sprintf("  Mutual exclusion: FAIL (%s, %s both enabled in %s)\n", f.Event1, f.Event2, f.State)
+	}
+	if f := r.AbsorbingFailure; f != nil {
+		s += fmt.Sprintf("  Absorbing: FAIL (%s leaves %s=%s: %s → %s)\n", f.Event, f.Var, f.Label, f.State, f.Next)
+	}
+
+	if len(r.NoOpEvents) > 0 {
+		s += fmt.Sprintf("  Warning: no-op events: %s\n", strings.Join(r.NoOpEvents, ", "))
+	}
+
+	if len(r.ContradictoryGuards) > 0 {
+		s += fmt.Sprintf("  Warning: guards never true in a reachable state: %s\n", strings.Join(r.ContradictoryGuards, ", "))
+	}
+
+	if n := len(r.DuplicateStates); n > 0 {
+		members := 0
+		for _, class := range r.DuplicateStates {
+			members += len(class)
+		}
+		s += fmt.Sprintf("  Warning: behaviorally equivalent states: %d classes covering %d states\n", n, members)
+	}
+
+	if t := r.Timings; t.Total > 0 {
+		s += fmt.Sprintf("  Timings: %s total (normal forms %s, step tables %s, CC %s)\n",
+			t.Total, t.NormalForms, t.StepTables, t.CC)
+	}
+
+	for _, c := range r.RepairConflicts {
+		s += fmt.Sprintf("  Warning: repair conflict on %s: %s and %s both violated in %s (%s vs %s)\n",
+			c.Var, c.Invariant1, c.Invariant2, c.State, c.Repair1, c.Repair2)
+	}
+
+	for _, a := range r.AsymmetricPairs {
+		first, second := a.Event1, a.Event2
+		if a.Fired2 {
+			first, second = second, first
+		}
+		s += fmt.Sprintf("  Warning: asymmetric pair (%s, %s): in %s only %s→%s fires both\n",
+			a.Event1, a.Event2, a.State, first, second)
+	}
+
+	if len(r.GuardMaskedPairs) > 0 {
+		s += fmt.Sprintf("  Warning: guard-masked pairs: %s\n", strings.Join(r.GuardMaskedPairs, ", "))
+	}
+
+	if hot := r.hotVars(); len(hot) > 0 {
+		s += fmt.Sprintf("  Shared variables: %s\n", strings.Join(hot, ", "))
+	}
+
+	if r.WFC && r.CC && r.ExclusionFailure == nil && r.AbsorbingFailure == nil {
 		s += "\n  Convergence: GUARANTEED\n"
 	}
 
 	return s
 }
 
+// hotVars formats the variables watched by more than one invariant as
+// "name (n)", most shared first, ties by name.
+func (r *Report) hotVars() []string {
+	var names []string
+	for name, n := range r.VarCoupling {
+		if n > 1 {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		ni, nj := r.VarCoupling[names[i]], r.VarCoupling[names[j]]
+		if ni != nj {
+			return ni > nj
+		}
+		return names[i] < names[j]
+	})
+	hot := make([]string, len(names))
+	for i, name := range names {
+		hot[i] = fmt.Sprintf("%s (%d)", name, r.VarCoupling[name])
+	}
+	return hot
+}
+
+// Summary returns a single-line verdict suitable for CI logs, e.g.
+//
+//	order_fulfillment: OK (48 states, WFC depth 1, CC 3/3 disjoint)
+//	order_fulfillment: CC FAIL (place_order,ship_item)
+func (r *Report) Summary() string {
+	switch {
+	case len(r.DeclarationErrors) > 0:
+		return fmt.Sprintf("%s: DECLARATION FAIL (%s)", r.Name, strings.TrimPrefix(r.DeclarationErrors[0].Error(), "gsm: "))
+	case !r.WFC:
+		return fmt.Sprintf("%s: WFC FAIL", r.Name)
+	case r.CCFailure != nil:
+		return fmt.Sprintf("%s: CC FAIL (%s,%s)", r.Name, r.CCFailure.Event1, r.CCFailure.Event2)
+	case r.ReachableLimit > 0:
+		return fmt.Sprintf("%s: FAIL (more than %d reachable states, MaxReachableStates limit)", r.Name, r.ReachableLimit)
+	case !r.CC:
+		return fmt.Sprintf("%s: FAIL (verification incomplete)", r.Name)
+	case r.ExclusionFailure != nil:
+		return fmt.Sprintf("%s: EXCLUSION FAIL (%s,%s)", r.Name, r.ExclusionFailure.Event1, r.ExclusionFailure.Event2)
+	case r.AbsorbingFailure != nil:
+		f := r.AbsorbingFailure
+		return fmt.Sprintf("%s: ABSORBING FAIL (%s leaves %s=%s)", r.Name, f.Event, f.Var, f.Label)
+	}
+	return fmt.Sprintf("%s: OK (%d states, WFC depth %d, CC %d/%d disjoint)",
+		r.Name, r.StateCount, r.MaxRepairLen, r.PairsTotal, r.PairsDisjoint)
+}
+
 // Build verifies WFC and CC, then returns an immutable Machine.
-func (r *Registry) Build() (*Machine, *Report, error) {
-	if r.totalBits > 20 {
-		return nil, nil, fmt.Errorf("gsm: state space too large (%d bits, max 20)", r.totalBits)
+func (r *Registry) Build() (m *Machine, report *Report, err error) {
+	if r.strictSet {
+		defer func() {
+			if p := recover(); p != nil {
+				se, ok := p.(strictSetError)
+				if !ok {
+					panic(p)
+				}
+				m, report, err = nil, nil, se.error
+			}
+		}()
+	}
+	return r.build()
+}
+
+// build is Build without the StrictSet panic recovery.
+func (r *Registry) build() (*Machine, *Report, error) {
+	report, err := r.begin()
+	if err != nil {
+		return nil, nil, err
+	}
+	start := time.Now()
+	defer func() { report.Timings.Total = time.Since(start) }()
+
+	c, err := r.prepare(report)
+	if err != nil {
+		return nil, report, err
+	}
+
+	// Phase 2: Compute step tables
+	phase := time.Now()
+	step, compensated := r.computeStepTables(c)
+	report.Timings.StepTables = time.Since(phase)
+
+	verified, err := r.analyze(c, stepTables(step))
+	if err != nil {
+		return nil, report, err
+	}
+
+	// Build immutable machine
+	m := &Machine{
+		name:        r.name,
+		vars:        r.vars,
+		events:      make(map[string]int),
+		step:        step,
+		nf:          c.nf,
+		invariants:  r.invariants,
+		defs:        r.events,
+		compensated: compensated,
+		initial:     c.initial,
+		verified:    verified,
+		groups:      c.groups,
+		maxRepair:   report.MaxRepairLen,
+		reachCount:  report.ReachableCount,
+		libVersion:  LibVersion,
+		ccReachable: r.ccReachable,
+	}
+	if !r.verifyAll {
+		m.pairConds = maps.Clone(r.pairConds)
+	}
+	m.tags = make([][]string, len(r.events))
+	for i, ev := range r.events {
+		m.events[ev.name] = i
+		m.tags[i] = ev.tags
+	}
+	for i, ev := range r.events {
+		for _, p := range ev.prev {
+			if m.prev == nil {
+				m.prev = make([][]int, len(r.events))
+			}
+			m.prev[i] = append(m.prev[i], m.events[p])
+		}
+	}
+
+	return m, report, nil
+}
+
+// buildContext is what the phases after normal-form computation share.
+type buildContext struct {
+	packedCount int
+	valid       bitset // valid encodings
+	mkState     func(uint64) State
+	groups      map[int]map[string]uint64
+	initial     uint64
+	nf          []uint64
+	report      *Report
+}
+
+// begin runs the declaration checks Build fails on first, then returns the
+// empty report from newReport.
+func (r *Registry) begin() (*Report, error) {
+	if errs := r.declarationErrors(); len(errs) > 0 {
+		return nil, errs[0]
+	}
+	return r.newReport()
+}
+
+// newReport checks the state space against the size limits and returns an
+// empty report for it.
+func (r *Registry) newReport() (*Report, error) {
+	maxBits, maxStates := r.limits()
+	if r.totalBits > maxBits {
+		return nil, fmt.Errorf("gsm: state space too large (%d bits, max %d)", r.totalBits, maxBits)
 	}
 
 	stateCount := 1
 	for _, v := range r.vars {
-		if v.domain > 0 && stateCount > maxStateSpace/v.domain {
-			return nil, nil, fmt.Errorf("gsm: state space overflow (exceeds limit %d)", maxStateSpace)
+		if v.domain > 0 && stateCount > maxStates/v.domain {
+			return nil, fmt.Errorf("gsm: state space overflow (exceeds limit %d)", maxStates)
 		}
 		stateCount *= v.domain
 	}
-	if stateCount > maxStateSpace {
-		return nil, nil, fmt.Errorf("gsm: state space %d exceeds limit %d", stateCount, maxStateSpace)
+	if stateCount > maxStates {
+		return nil, fmt.Errorf("gsm: state space %d exceeds limit %d", stateCount, maxStates)
 	}
 
-	packedCount := 1 << r.totalBits
-
-	report := &Report{
+	events := make([]string, len(r.events))
+	for i, ev := range r.events {
+		events[i] = ev.name
+	}
+	return &Report{
 		Name:       r.name,
 		StateCount: stateCount,
 		VarCount:   len(r.vars),
 		EventCount: len(r.events),
-	}
+		vars:       slices.Clone(r.vars),
+		events:     events,
+	}, nil
+}
 
-	// Build validity mask
-	valid := make([]bool, packedCount)
+// validMask returns the set of valid encodings: those in which every
+// variable's raw value is inside its domain.
+func (r *Registry) validMask(packedCount int) bitset {
+	valid := newBitset(packedCount)
 	for i := 0; i < packedCount; i++ {
-		valid[i] = r.isValidEncoding(uint64(i))
+		if r.isValidEncoding(uint64(i)) {
+			valid.set(uint64(i))
+		}
+	}
+	return valid
+}
+
+// probeWhenReads records the variables each invariant's When condition
+// reads, which extend its footprint.
+func (r *Registry) probeWhenReads(packedCount int, valid bitset) {
+	mkState := func(id uint64) State {
+		return State{packed: id, vars: r.vars, strict: r.strictSet}
+	}
+	for i := range r.invariants {
+		if inv := &r.invariants[i]; inv.when != nil {
+			inv.whenReads = predicateReads(inv.when, r.vars, packedCount, valid, mkState)
+		}
 	}
+}
+
+// prepare runs the declaration checks and Phase 1, up to and including the
+// normal-form table. Declaration check failures are recorded in
+// report.DeclarationErrors.
+func (r *Registry) prepare(report *Report) (*buildContext, error) {
+	packedCount := 1 << r.totalBits
 
+	valid := r.validMask(packedCount)
 	mkState := func(id uint64) State {
-		return State{packed: id, vars: r.vars}
+		return State{packed: id, vars: r.vars, strict: r.strictSet}
+	}
+	r.probeWhenReads(packedCount, valid)
+
+	report.VarCoupling = r.varCoupling()
+
+	fail := func(errs ...error) (*buildContext, error) {
+		report.DeclarationErrors = errs
+		return nil, errs[0]
+	}
+	if errs := r.checkReadErrors(packedCount, valid); len(errs) > 0 {
+		return fail(errs...)
+	}
+	if errs := r.effectWriteErrors(packedCount, valid); len(errs) > 0 {
+		return fail(errs...)
+	}
+	if r.checkDet {
+		if errs := r.determinismErrors(packedCount, valid); len(errs) > 0 {
+			return fail(errs...)
+		}
+	}
+	if r.requireWritten {
+		if err := r.verifyVarsUsed(); err != nil {
+			return fail(err)
+		}
+	}
+	if err := r.verifyOrderedRepairs(packedCount, valid, mkState); err != nil {
+		return fail(err)
+	}
+	groups, err := r.resolveEnumGroups()
+	if err != nil {
+		return fail(err)
+	}
+
+	initial, err := r.initialState(mkState)
+	if err != nil {
+		return fail(err)
 	}
 
 	// Phase 1: Verify WFC and compute normal forms
-	nf, err := r.computeNormalForms(packedCount, stateCount, valid, mkState, report)
+	phase := time.Now()
+	nf, err := r.computeNormalForms(packedCount, report.StateCount, valid, mkState, report)
+	report.Timings.NormalForms = time.Since(phase)
 	if err != nil {
-		return nil, report, err
+		return nil, err
+	}
+	if r.repairConf {
+		report.RepairConflicts = r.detectRepairConflicts(packedCount, valid, mkState)
 	}
 
-	// Phase 2: Compute step tables
-	step := r.computeStepTables(packedCount, valid, nf, mkState)
+	return &buildContext{
+		packedCount: packedCount,
+		valid:       valid,
+		mkState:     mkState,
+		groups:      groups,
+		initial:     initial,
+		nf:          nf,
+		report:      report,
+	}, nil
+}
+
+// analyze runs the phases that need step rows: no-op detection,
+// reachability, Phase 3 (CC), and the structural checks over reachable
+// states. It returns the pairs CC proved.
+func (r *Registry) analyze(c *buildContext, step stepSource) ([]VerifiedPair, error) {
+	report := c.report
+	report.NoOpEvents = r.detectNoOpEvents(c.packedCount, c.valid, c.nf, step)
+
+	var precise []map[int]bool
+	if r.preciseFP {
+		precise = r.simulateFootprints(c.packedCount, c.valid, c.nf, c.mkState)
+	}
+
+	// Reachable states from the initial state, shared by the analyses
+	// that need them.
+	reachable, _, ok := reachableFrom(step, c.packedCount, c.initial, r.maxReachable, nil)
+	if !ok {
+		report.ReachableLimit = r.maxReachable
+		return nil, fmt.Errorf("gsm: more than %d reachable states", r.maxReachable)
+	}
+	report.ReachableCount = len(reachable)
+	report.ContradictoryGuards = r.detectContradictoryGuards(reachable, c.mkState)
+	if r.dupStates {
+		report.DuplicateStates = r.duplicateStates(reachable, step, c.mkState)
+	}
 
 	// Phase 3: Verify CC
-	err = r.verifyCC(packedCount, valid, step, mkState, report)
+	phase := time.Now()
+	verified, err := r.verifyCC(c.packedCount, c.valid, step, precise, reachable, c.mkState, report)
+	report.Timings.CC = time.Since(phase)
 	if err != nil {
-		return nil, report, err
+		return nil, err
 	}
 
-	// Build immutable machine
-	m := &Machine{
-		name:   r.name,
-		vars:   r.vars,
-		events: make(map[string]int),
-		step:   step,
-		nf:     nf,
+	// Phase 4: Structural checks over reachable states
+	if err := r.verifyExclusive(reachable, c.mkState, report); err != nil {
+		return nil, err
 	}
-	for i, ev := range r.events {
-		m.events[ev.name] = i
+	if err := r.verifyAbsorbing(reachable, step, c.mkState, report); err != nil {
+		return nil, err
 	}
+	return verified, nil
+}
 
-	return m, report, nil
+// BuildAndExport builds the machine and, only if verification passes,
+// exports it to path. The report is returned in either case. On failure
+// nothing is written; an existing file at path is left untouched.
+func (r *Registry) BuildAndExport(path string) (*Report, error) {
+	m, report, err := r.Build()
+	if err != nil {
+		return report, err
+	}
+	if err := m.Export(path); err != nil {
+		return report, err
+	}
+	return report, nil
+}
+
+// initialState computes the packed initial state and checks that it is a
+// valid encoding satisfying every invariant.
+func (r *Registry) initialState(mkState func(uint64) State) (uint64, error) {
+	s := mkState(0)
+	if r.initial == nil && len(r.enumDefaults) == 0 {
+		return 0, nil
+	}
+	for _, d := range r.enumDefaults {
+		s = s.setRaw(d.v, d.raw)
+	}
+	if r.initial != nil {
+		s = r.initial(s)
+	}
+	if !r.isValidEncoding(s.packed) {
+		return 0, fmt.Errorf("gsm: initial state %s is not a valid encoding", s)
+	}
+	for _, inv := range r.invariants {
+		if !inv.check(s) {
+			return 0, fmt.Errorf("gsm: initial state %s violates invariant %q", s, inv.name)
+		}
+	}
+	return s.packed, nil
 }
 
 // computeNormalForms verifies WFC and computes the normal form table.
-func (r *Registry) computeNormalForms(packedCount, stateCount int, valid []bool, mkState func(uint64) State, report *Report) ([]uint64, error) {
+func (r *Registry) computeNormalForms(packedCount, stateCount int, valid bitset, mkState func(uint64) State, report *Report) ([]uint64, error) {
 	nf := make([]uint64, packedCount)
 	maxRepair := 0
+	worst := uint64(0) // source of the first chain of depth maxRepair
 
 	for i := 0; i < packedCount; i++ {
-		if !valid[i] {
-			nf[i] = uint64(i)
-			continue
+		if !valid.has(uint64(i)) {
+			continue // filled in below, once all valid entries are known
 		}
 
 		s := mkState(uint64(i))
@@ -160,17 +721,44 @@ func (r *Registry) computeNormalForms(packedCount, stateCount int, valid []bool,
 		}
 
 		nf[i] = s.packed
+		if r.repairHist {
+			for len(report.RepairHistogram) <= depth {
+				report.RepairHistogram = append(report.RepairHistogram, 0)
+			}
+			report.RepairHistogram[depth]++
+		}
 		if depth > maxRepair {
 			maxRepair = depth
+			worst = uint64(i)
 		}
 	}
 
 	report.WFC = true
 	report.MaxRepairLen = maxRepair
+	if r.recordWorst && maxRepair > 0 {
+		// Repairs are deterministic, so replaying the worst source
+		// reproduces its chain without recording every chain.
+		s := mkState(worst)
+		report.WorstRepairChain = []State{s}
+		for k := 0; k < maxRepair; k++ {
+			s = r.applyFirstRepair(s)
+			report.WorstRepairChain = append(report.WorstRepairChain, s)
+		}
+	}
+
+	// Complete the table for malformed encodings (raw values outside a
+	// variable's domain): clamp into the domain, then take that state's
+	// normal form. Every entry of nf is therefore a valid state, so runtimes
+	// can normalize any encoding from nf alone.
+	for i := 0; i < packedCount; i++ {
+		if !valid.has(uint64(i)) {
+			nf[i] = nf[r.clampState(mkState(uint64(i))).packed]
+		}
+	}
 
 	// Verify idempotence on valid states
 	for i := 0; i < packedCount; i++ {
-		if valid[i] {
+		if valid.has(uint64(i)) {
 			s := mkState(uint64(i))
 			if r.allInvariantsHold(s) && nf[i] != uint64(i) {
 				return nil, fmt.Errorf("gsm: compensation moves valid state %s — repair must be identity on valid states", s)
@@ -181,88 +769,475 @@ func (r *Registry) computeNormalForms(packedCount, stateCount int, valid []bool,
 	return nf, nil
 }
 
-// computeStepTables builds the Step[e][s] = NF(apply(e, s)) tables.
-func (r *Registry) computeStepTables(packedCount int, valid []bool, nf []uint64, mkState func(uint64) State) [][]uint64 {
+// computeStepTables builds the Step[e][s] = NF(apply(e, s)) tables. It also
+// returns, per event, the set of source states whose transition needed
+// compensation (the clamped post-event state violated an invariant).
+func (r *Registry) computeStepTables(c *buildContext) ([][]uint64, []bitset) {
 	step := make([][]uint64, len(r.events))
+	compensated := make([]bitset, len(r.events))
+	for ei := range r.events {
+		step[ei] = make([]uint64, c.packedCount)
+		compensated[ei] = newBitset(c.packedCount)
+		r.computeStepRow(c, ei, step[ei], compensated[ei])
+	}
+	return step, compensated
+}
+
+// computeStepRow fills row with event ei's step table row and, if
+// compensated is non-nil, marks the source states whose transition needed
+// compensation. Entries for malformed encodings follow the registry's
+// InvalidPolicy.
+func (r *Registry) computeStepRow(c *buildContext, ei int, row []uint64, compensated bitset) {
+	ev := r.events[ei]
+	for i := 0; i < c.packedCount; i++ {
+		if !c.valid.has(uint64(i)) {
+			continue
+		}
+		after := r.clampState(r.applyEvent(ev, c.mkState(uint64(i))))
+		row[i] = c.nf[after.packed]
+		if compensated != nil && c.nf[after.packed] != after.packed {
+			compensated.set(uint64(i))
+		}
+	}
+	// Normal forms are valid encodings, so their entries are filled above.
+	for i := 0; i < c.packedCount; i++ {
+		if c.valid.has(uint64(i)) {
+			continue
+		}
+		switch r.invalidPolicy {
+		case InvalidToSelf:
+			row[i] = uint64(i)
+		case InvalidToNormalForm:
+			row[i] = row[c.nf[i]]
+		default:
+			row[i] = 0
+		}
+	}
+}
+
+// detectNoOpEvents returns the names of events that map every valid state
+// to itself. Unlike a guard-blocked event, which is a no-op only in some
+// states, such an event is globally inert and usually a modeling mistake.
+func (r *Registry) detectNoOpEvents(packedCount int, valid bitset, nf []uint64, step stepSource) []string {
+	var noops []string
 	for ei, ev := range r.events {
-		step[ei] = make([]uint64, packedCount)
+		inert := true
+		row := step.row(ei)
 		for i := 0; i < packedCount; i++ {
-			if valid[i] {
-				s := mkState(uint64(i))
-				after := r.applyEvent(ev, s)
-				after = r.clampState(after)
-				step[ei][i] = nf[after.packed]
+			if valid.has(uint64(i)) && nf[i] == uint64(i) && row[i] != uint64(i) {
+				inert = false
+				break
 			}
 		}
+		if inert {
+			noops = append(noops, ev.name)
+		}
 	}
-	return step
+	return noops
 }
 
-// verifyCC checks compensation commutativity for independent event pairs.
-func (r *Registry) verifyCC(packedCount int, valid []bool, step [][]uint64, mkState func(uint64) State, report *Report) error {
+// detectContradictoryGuards returns the names of guarded events whose
+// guard is false in every reachable state.
+func (r *Registry) detectContradictoryGuards(reachable []uint64, mkState func(uint64) State) []string {
+	var names []string
+	for _, ev := range r.events {
+		if ev.guard == nil {
+			continue
+		}
+		fires := false
+		for _, id := range reachable {
+			if ev.guard(mkState(id)) {
+				fires = true
+				break
+			}
+		}
+		if !fires {
+			names = append(names, ev.name)
+		}
+	}
+	return names
+}
+
+// VerifiedPair records one event pair proved to satisfy CC and how.
+// Method is "disjoint" (footprint disjointness), "brute" (exhaustive check
+// over all valid states), "brute-reachable" (exhaustive check over
+// reachable states, see Registry.CCOverReachable), "conditional" (an
+// exhaustive check restricted to the states satisfying the pair's
+// condition, see Registry.IndependentWhen), or "self" (an event paired
+// with itself, see Registry.CheckSelfPairs).
+type VerifiedPair struct {
+	Event1 string
+	Event2 string
+	Method string
+}
+
+// verifyCC checks compensation commutativity for independent event pairs
+// and returns the pairs it proved. Each brute-force pair is checked in both
+// orders, step[j][step[i][s]] against step[i][step[j][s]], so a pass does
+// not depend on which event of the pair was declared first.
+// If precise is non-nil, it holds simulated per-event footprints that
+// replace the static analysis for proving pairs disjoint. reachable is used
+// in place of all valid states under CCOverReachable, and is where
+// DetectAsymmetricPairs looks for guard asymmetry.
+func (r *Registry) verifyCC(packedCount int, valid bitset, step stepSource, precise []map[int]bool, reachable []uint64, mkState func(uint64) State, report *Report) ([]VerifiedPair, error) {
+	var verified []VerifiedPair
+	prove := func(i, j int, method string) {
+		verified = append(verified, VerifiedPair{Event1: r.events[i].name, Event2: r.events[j].name, Method: method})
+	}
+	bruteMethod := "brute"
+	if r.ccReachable {
+		bruteMethod = "brute-reachable"
+	}
+
 	pairsDisjoint := 0
 	pairsBrute := 0
+	staticDisjoint := 0
+
+	// States to check for brute-force pairs: every valid encoding, or only
+	// those reachable from the initial state under CCOverReachable.
+	var states []uint64
+	if r.ccReachable {
+		states = reachable
+	} else {
+		for s := 0; s < packedCount; s++ {
+			if valid.has(uint64(s)) {
+				states = append(states, uint64(s))
+			}
+		}
+	}
 
 	type pair struct{ i, j int }
 	var pairsToCheck []pair
 
-	if r.allIndependent {
+	// Tag expansions can overlap each other and explicit declarations;
+	// each resulting pair is declared once.
+	declared := make(map[pair]bool)
+	var declaredPairs []pair
+	declare := func(i, j int) {
+		if i > j {
+			i, j = j, i
+		}
+		if i == j && r.selfPairs {
+			return // added for every event below
+		}
+		if !declared[pair{i, j}] {
+			declared[pair{i, j}] = true
+			declaredPairs = append(declaredPairs, pair{i, j})
+		}
+	}
+	for _, p := range r.independent {
+		declare(p[0], p[1])
+	}
+	for _, p := range r.taggedPairs() {
+		declare(p[0], p[1])
+	}
+
+	all := r.allIndependent || r.verifyAll
+	if all {
 		for i := 0; i < len(r.events); i++ {
 			for j := i + 1; j < len(r.events); j++ {
 				pairsToCheck = append(pairsToCheck, pair{i, j})
 			}
 		}
 	} else {
-		for _, p := range r.independent {
-			i, j := p[0], p[1]
-			if i > j {
-				i, j = j, i
-			}
-			pairsToCheck = append(pairsToCheck, pair{i, j})
+		pairsToCheck = declaredPairs
+	}
+	n := len(r.events)
+	if all {
+		report.CCScope = "all"
+	} else {
+		report.CCScope = "declared"
+		report.PairsUnchecked = n*(n-1)/2 - len(pairsToCheck)
+	}
+	if r.selfPairs {
+		for i := range r.events {
+			pairsToCheck = append(pairsToCheck, pair{i, i})
 		}
 	}
 
 	for _, p := range pairsToCheck {
 		i, j := p.i, p.j
 
-		if r.eventsDisjoint(i, j) {
+		// An event commutes with itself: both orderings of two copies are
+		// the same sequence of deterministic table lookups.
+		if i == j {
+			report.SelfPairs++
+			prove(i, j, "self")
+			continue
+		}
+
+		disjoint := r.eventsDisjoint(i, j)
+		if disjoint {
+			staticDisjoint++
+		}
+		if precise != nil {
+			disjoint = footprintsDisjoint(precise[i], precise[j])
+		}
+		var cond CheckFunc
+		if !r.verifyAll {
+			cond = r.pairConds[[2]int{i, j}]
+		}
+		asymmetry := func() {
+			if r.asymPairs && declared[p] {
+				if a := r.guardAsymmetry(i, j, reachable, step, cond, mkState); a != nil {
+					report.AsymmetricPairs = append(report.AsymmetricPairs, *a)
+				}
+			}
+		}
+		if disjoint {
 			pairsDisjoint++
+			prove(i, j, "disjoint")
+			asymmetry()
 			continue
 		}
 
 		pairsBrute++
-		for s := 0; s < packedCount; s++ {
-			if !valid[s] {
+		interleaved := false // both events fire in both orders somewhere
+		checked := 0         // states passing the IndependentWhen condition
+		rowI, rowJ := step.row(i), step.row(j)
+		for _, s := range states {
+			if cond != nil && !cond(mkState(s)) {
 				continue
 			}
-
-			after_ij := step[j][step[i][s]]
-			after_ji := step[i][step[j][s]]
+			checked++
+			after_ij := rowJ[rowI[s]]
+			after_ji := rowI[rowJ[s]]
 
 			if after_ij != after_ji {
 				report.CC = false
-				report.PairsTotal = pairsDisjoint + pairsBrute
-				report.PairsDisjoint = pairsDisjoint
-				report.PairsBrute = pairsBrute
+				r.recordPairCounts(report, pairsDisjoint, pairsBrute, staticDisjoint)
 				report.CCFailure = &CCFailure{
 					Event1:  r.events[i].name,
 					Event2:  r.events[j].name,
-					State:   mkState(uint64(s)),
+					State:   mkState(s),
 					Result1: mkState(after_ij),
 					Result2: mkState(after_ji),
+					Fired1:  r.bothFire(i, j, s, rowI, mkState),
+					Fired2:  r.bothFire(j, i, s, rowJ, mkState),
 				}
-				return fmt.Errorf("gsm: Compensation Commutativity (CC) check failed")
+				return nil, fmt.Errorf("gsm: Compensation Commutativity (CC) check failed")
 			}
+			if !interleaved {
+				interleaved = r.bothFire(i, j, s, rowI, mkState) && r.bothFire(j, i, s, rowJ, mkState)
+			}
+		}
+		if cond != nil {
+			prove(i, j, "conditional")
+		} else {
+			prove(i, j, bruteMethod)
 		}
+		if !interleaved && checked > 0 {
+			report.GuardMaskedPairs = append(report.GuardMaskedPairs,
+				fmt.Sprintf("(%s, %s)", r.events[i].name, r.events[j].name))
+		}
+		asymmetry()
 	}
 
 	report.CC = true
-	report.PairsTotal = pairsDisjoint + pairsBrute
-	report.PairsDisjoint = pairsDisjoint
-	report.PairsBrute = pairsBrute
+	r.recordPairCounts(report, pairsDisjoint, pairsBrute, staticDisjoint)
+	return verified, nil
+}
+
+// guardAsymmetry returns the first of the given reachable states, skipping
+// those failing cond, in which events i and j both fire in one order but not in
+// the other, or nil if there is none.
+func (r *Registry) guardAsymmetry(i, j int, states []uint64, step stepSource, cond CheckFunc, mkState func(uint64) State) *AsymmetricPair {
+	rowI, rowJ := step.row(i), step.row(j)
+	for _, s := range states {
+		if cond != nil && !cond(mkState(s)) {
+			continue
+		}
+		fired1 := r.bothFire(i, j, s, rowI, mkState)
+		fired2 := r.bothFire(j, i, s, rowJ, mkState)
+		if fired1 != fired2 {
+			return &AsymmetricPair{
+				Event1: r.events[i].name,
+				Event2: r.events[j].name,
+				State:  mkState(s),
+				Fired1: fired1,
+				Fired2: fired2,
+			}
+		}
+	}
+	return nil
+}
+
+// bothFire reports whether, applying event i then event j from state s,
+// neither is blocked by its guard. rowI is event i's step row.
+func (r *Registry) bothFire(i, j int, s uint64, rowI []uint64, mkState func(uint64) State) bool {
+	return r.enabled(r.events[i], mkState(s)) && r.enabled(r.events[j], mkState(rowI[s]))
+}
+
+// verifyExclusive checks that no reachable state enables both events of a
+// MutuallyExclusive pair.
+func (r *Registry) verifyExclusive(reachable []uint64, mkState func(uint64) State, report *Report) error {
+	for _, p := range r.exclusive {
+		e1, e2 := r.events[p[0]], r.events[p[1]]
+		for _, id := range reachable {
+			s := mkState(id)
+			if r.enabled(e1, s) && r.enabled(e2, s) {
+				report.ExclusionFailure = &ExclusionFailure{
+					Event1: e1.name,
+					Event2: e2.name,
+					State:  s,
+				}
+				return fmt.Errorf("gsm: mutually exclusive events %q and %q both enabled in %s", e1.name, e2.name, s)
+			}
+		}
+	}
 	return nil
 }
 
+// verifyAbsorbing checks that every event leaves every reachable state
+// declared Absorbing unchanged.
+func (r *Registry) verifyAbsorbing(reachable []uint64, step stepSource, mkState func(uint64) State, report *Report) error {
+	if len(r.absorbing) == 0 {
+		return nil
+	}
+	for ei, ev := range r.events {
+		row := step.row(ei)
+		for _, a := range r.absorbing {
+			for _, id := range reachable {
+				s := mkState(id)
+				if s.getRaw(a.v) != a.raw {
+					continue
+				}
+				if next := row[id]; next != id {
+					report.AbsorbingFailure = &AbsorbingFailure{
+						Event: ev.name,
+						Var:   a.v.name,
+						Label: a.v.labels[a.raw],
+						State: s,
+						Next:  mkState(next),
+					}
+					return fmt.Errorf("gsm: event %q leaves absorbing state %s=%s: %s → %s",
+						ev.name, a.v.name, a.v.labels[a.raw], s, mkState(next))
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// duplicateStates partitions the reachable states by bisimulation and
+// returns the blocks with more than one member.
+func (r *Registry) duplicateStates(reachable []uint64, step stepSource, mkState func(uint64) State) [][]State {
+	block, blocks := bisimulation(reachable, step, func(ei int, id uint64) bool {
+		return r.events[ei].enabled(mkState(id))
+	})
+	members := make([][]State, blocks)
+	for i, id := range reachable {
+		members[block[i]] = append(members[block[i]], State{packed: id, vars: r.vars})
+	}
+	var classes [][]State
+	for _, class := range members {
+		if len(class) > 1 {
+			classes = append(classes, class)
+		}
+	}
+	return classes
+}
+
+// bisimulation partitions a set of states closed under step: states start
+// in one block per set of enabled events, and blocks are split until every
+// member's successor under each event lies in the same block. It returns
+// the block of each state, indexed like reachable, and the block count.
+// Blocks are numbered in order of their first member.
+func bisimulation(reachable []uint64, step stepSource, enabled func(ei int, id uint64) bool) ([]int, int) {
+	pos := make(map[uint64]int, len(reachable))
+	for i, id := range reachable {
+		pos[id] = i
+	}
+	events := step.events()
+
+	block := make([]int, len(reachable))
+	var key []byte
+	split := func(sig func(i int)) int {
+		ids := make(map[string]int)
+		next := make([]int, len(reachable))
+		for i := range reachable {
+			key = key[:0]
+			sig(i)
+			b, ok := ids[string(key)]
+			if !ok {
+				b = len(ids)
+				ids[string(key)] = b
+			}
+			next[i] = b
+		}
+		block = next
+		return len(ids)
+	}
+	appendInt := func(n int) { key = binary.AppendUvarint(key, uint64(n)) }
+
+	blocks := split(func(i int) {
+		for ei := 0; ei < events; ei++ {
+			if enabled(ei, reachable[i]) {
+				key = append(key, 1)
+			} else {
+				key = append(key, 0)
+			}
+		}
+	})
+	for {
+		refined := split(func(i int) {
+			appendInt(block[i])
+			for ei := 0; ei < events; ei++ {
+				appendInt(block[pos[step.next(ei, reachable[i])]])
+			}
+		})
+		if refined == blocks {
+			break
+		}
+		blocks = refined
+	}
+	return block, blocks
+}
+
+// verifyOrderedRepairs applies the repair normalization would run, that of
+// the first violated invariant, to every valid encoding that needs one, and
+// fails if it raises the label index of an OrderedEnum variable.
+func (r *Registry) verifyOrderedRepairs(packedCount int, valid bitset, mkState func(uint64) State) error {
+	if len(r.ordered) == 0 {
+		return nil
+	}
+	for i := 0; i < packedCount; i++ {
+		if !valid.has(uint64(i)) {
+			continue
+		}
+		s := mkState(uint64(i))
+		ii := firstViolated(r.invariants, s)
+		if ii < 0 {
+			continue
+		}
+		repaired := r.clampState(r.invariants[ii].repair(s))
+		for _, vi := range r.ordered {
+			v := r.vars[vi]
+			if from, to := s.getRaw(v), repaired.getRaw(v); to > from {
+				return fmt.Errorf("gsm: invariant %q repair advances ordered enum %q from %q to %q in %s",
+					r.invariants[ii].name, v.name, v.labels[from], v.labels[to], s)
+			}
+		}
+	}
+	return nil
+}
+
+// recordPairCounts fills in the CC pair statistics. Brute-force pairs are
+// attributed to PairsBruteReachable when checking was restricted to
+// reachable states.
+func (r *Registry) recordPairCounts(report *Report, disjoint, brute, staticDisjoint int) {
+	report.PairsTotal = disjoint + brute
+	report.PairsDisjoint = disjoint
+	if r.preciseFP {
+		report.PreciseDisjointDelta = disjoint - staticDisjoint
+	}
+	if r.ccReachable {
+		report.PairsBruteReachable = brute
+	} else {
+		report.PairsBrute = brute
+	}
+}
+
 // allInvariantsHold checks V_R(s).
 func (r *Registry) allInvariantsHold(s State) bool {
 	for _, inv := range r.invariants {
@@ -275,27 +1250,48 @@ func (r *Registry) allInvariantsHold(s State) bool {
 
 // applyFirstRepair fires the first violated invariant's repair (priority order).
 func (r *Registry) applyFirstRepair(s State) State {
-	for _, inv := range r.invariants {
+	if ii := r.firstViolated(s); ii >= 0 {
+		return r.invariants[ii].repair(s)
+	}
+	return s
+}
+
+// firstViolated returns the index of the highest-priority violated
+// invariant, or -1 if all invariants hold.
+func (r *Registry) firstViolated(s State) int {
+	return firstViolated(r.invariants, s)
+}
+
+func firstViolated(invariants []invariantDef, s State) int {
+	for i, inv := range invariants {
 		if !inv.check(s) {
-			return inv.repair(s)
+			return i
 		}
 	}
-	return s
+	return -1
 }
 
 // applyEvent applies an event's effect (or no-op if guard fails).
 func (r *Registry) applyEvent(ev eventDef, s State) State {
-	if ev.guard != nil && !ev.guard(s) {
-		return s
-	}
-	return ev.effect(s)
+	return ev.apply(s)
+}
+
+// enabled reports whether an event's guard passes (events without a guard
+// are always enabled).
+func (r *Registry) enabled(ev eventDef, s State) bool {
+	return ev.enabled(s)
 }
 
 // clampState ensures all variable values are within their domains.
 // This handles cases where arithmetic produces out-of-range values
-// before the bitpacking truncates them.
+// before the bitpacking truncates them, and is the safety net for
+// SetRawInt, whose wrapped writes may leave padding encodings.
 func (r *Registry) clampState(s State) State {
-	for _, v := range r.vars {
+	return clampState(r.vars, s)
+}
+
+func clampState(vars []Var, s State) State {
+	for _, v := range vars {
 		raw := s.getRaw(v)
 		max := uint64(v.domain - 1)
 		if raw > max {
@@ -308,7 +1304,13 @@ func (r *Registry) clampState(s State) State {
 // isValidEncoding checks that all variable values in a packed ID
 // are within their domains (rejects padding-bit waste).
 func (r *Registry) isValidEncoding(packed uint64) bool {
-	for _, v := range r.vars {
+	return validEncoding(r.vars, packed)
+}
+
+// validEncoding reports whether every variable's raw value in a packed ID
+// is within its domain.
+func validEncoding(vars []Var, packed uint64) bool {
+	for _, v := range vars {
 		mask := uint64((1 << v.bits) - 1)
 		raw := (packed >> v.offset) & mask
 		if int(raw) >= v.domain {
@@ -321,10 +1323,11 @@ func (r *Registry) isValidEncoding(packed uint64) bool {
 // eventsDisjoint returns true if two events have disjoint write sets
 // AND the invariants they can trigger have disjoint footprints.
 func (r *Registry) eventsDisjoint(ei, ej int) bool {
-	// Get invariant footprint vars for each event
-	fp1 := r.eventFootprint(ei)
-	fp2 := r.eventFootprint(ej)
+	return footprintsDisjoint(r.eventFootprint(ei), r.eventFootprint(ej))
+}
 
+// footprintsDisjoint returns true if two variable sets share no member.
+func footprintsDisjoint(fp1, fp2 map[int]bool) bool {
 	for v := range fp1 {
 		if fp2[v] {
 			return false
@@ -333,6 +1336,330 @@ func (r *Registry) eventsDisjoint(ei, ej int) bool {
 	return true
 }
 
+// simulateFootprints computes each event's footprint by replaying every
+// compensation chain it starts from a valid state. The footprint contains
+// the variables the effect changes, plus the full footprint of each
+// invariant whose repair fires anywhere in a chain (the repair may read and
+// write any variable it watches). Requires WFC to have passed.
+func (r *Registry) simulateFootprints(packedCount int, valid bitset, nf []uint64, mkState func(uint64) State) []map[int]bool {
+	fps := make([]map[int]bool, len(r.events))
+	for ei, ev := range r.events {
+		fp := make(map[int]bool)
+		fired := make([]bool, len(r.invariants))
+		for i := 0; i < packedCount; i++ {
+			if !valid.has(uint64(i)) || nf[i] != uint64(i) {
+				continue
+			}
+			s := mkState(uint64(i))
+			after := r.clampState(r.applyEvent(ev, s))
+			for _, v := range r.vars {
+				if s.getRaw(v) != after.getRaw(v) {
+					fp[v.index] = true
+				}
+			}
+			for !r.allInvariantsHold(after) {
+				ii := r.firstViolated(after)
+				fired[ii] = true
+				after = r.invariants[ii].repair(after)
+			}
+		}
+		for ii, inv := range r.invariants {
+			if fired[ii] {
+				for _, vi := range inv.watched() {
+					fp[vi] = true
+				}
+			}
+		}
+		fps[ei] = fp
+	}
+	return fps
+}
+
+// checkReadErrors evaluates every invariant's check on every valid
+// encoding with read tracing enabled, and returns an error for each
+// variable a check reads outside the invariant's footprint. Footprints drive the disjointness
+// proofs in verifyCC, so an undeclared read would make them unsound.
+// Variables read by a When condition are allowed.
+func (r *Registry) checkReadErrors(packedCount int, valid bitset) []error {
+	var errs []error
+	for _, inv := range r.invariants {
+		allowed := make([]bool, len(r.vars))
+		for _, vi := range inv.watched() {
+			allowed[vi] = true
+		}
+		checkTrace := &accessTrace{read: make([]bool, len(r.vars))}
+		whenTrace := &accessTrace{read: make([]bool, len(r.vars))}
+		for i := 0; i < packedCount; i++ {
+			if !valid.has(uint64(i)) {
+				continue
+			}
+			inv.check(State{packed: uint64(i), vars: r.vars, trace: checkTrace, strict: r.strictSet})
+			if inv.when != nil {
+				inv.when(State{packed: uint64(i), vars: r.vars, trace: whenTrace, strict: r.strictSet})
+			}
+		}
+		for vi, read := range checkTrace.read {
+			if read && !allowed[vi] && !whenTrace.read[vi] {
+				errs = append(errs, fmt.Errorf("gsm: invariant %q check reads variable %q outside its footprint (add it to Watches)", inv.name, r.vars[vi].name))
+			}
+		}
+	}
+	return errs
+}
+
+// effectWriteErrors runs every event's effect on every valid encoding with
+// write tracing enabled, and returns an error for each variable an effect
+// changes that is missing from the event's Writes. Write sets drive the disjointness proofs in
+// verifyCC just as invariant footprints do, so an undeclared write would
+// make them unsound. Writes that store a variable's current value are not
+// changes and are allowed.
+func (r *Registry) effectWriteErrors(packedCount int, valid bitset) []error {
+	var errs []error
+	for _, ev := range r.events {
+		declared := make([]bool, len(r.vars))
+		for _, vi := range ev.writes {
+			declared[vi] = true
+		}
+		trace := &accessTrace{read: make([]bool, len(r.vars)), wrote: make([]bool, len(r.vars))}
+		for i := 0; i < packedCount; i++ {
+			if valid.has(uint64(i)) {
+				ev.apply(State{packed: uint64(i), vars: r.vars, trace: trace, strict: r.strictSet})
+			}
+		}
+		for vi, wrote := range trace.wrote {
+			if wrote && !declared[vi] {
+				errs = append(errs, fmt.Errorf("gsm: event %q effect changes variable %q outside its write set (add it to Writes)", ev.name, r.vars[vi].name))
+			}
+		}
+	}
+	return errs
+}
+
+// determinismErrors runs every guard, effect, invariant When condition,
+// check, and repair twice on each valid encoding (repairs only where the
+// check fails) and reports each closure whose two results differ, at the
+// first state where they do. The check includes the When condition, so
+// where the condition itself disagrees only the condition is reported. Build tabulates a single evaluation of each, so a closure that
+// depends on hidden state would make the tables disagree with the model.
+func (r *Registry) determinismErrors(packedCount int, valid bitset) []error {
+	var errs []error
+	mkState := func(id uint64) State {
+		return State{packed: id, vars: r.vars, strict: r.strictSet}
+	}
+	for _, ev := range r.events {
+		guardOK, effectOK := true, true
+		for i := 0; i < packedCount && (guardOK || effectOK); i++ {
+			if !valid.has(uint64(i)) {
+				continue
+			}
+			s := mkState(uint64(i))
+			if guardOK && ev.guard != nil {
+				if a, b := ev.guard(s), ev.guard(s); a != b {
+					errs = append(errs, fmt.Errorf("gsm: guard of event %q is not deterministic: %s gave %t, then %t", ev.name, s, a, b))
+					guardOK = false
+				}
+			}
+			if effectOK {
+				if a, b := r.clampState(ev.apply(s)), r.clampState(ev.apply(s)); a.packed != b.packed {
+					errs = append(errs, fmt.Errorf("gsm: effect of event %q is not deterministic: %s gave %s, then %s", ev.name, s, a, b))
+					effectOK = false
+				}
+			}
+		}
+	}
+	for _, inv := range r.invariants {
+		whenOK, checkOK, repairOK := inv.when != nil, true, true
+		for i := 0; i < packedCount && (whenOK || checkOK || repairOK); i++ {
+			if !valid.has(uint64(i)) {
+				continue
+			}
+			s := mkState(uint64(i))
+			whenAgrees := true
+			if inv.when != nil {
+				if a, b := inv.when(s), inv.when(s); a != b {
+					whenAgrees = false
+					if whenOK {
+						errs = append(errs, fmt.Errorf("gsm: When condition of invariant %q is not deterministic: %s gave %t, then %t", inv.name, s, a, b))
+						whenOK = false
+					}
+				}
+			}
+			a, b := inv.check(s), inv.check(s)
+			if checkOK && whenAgrees && a != b {
+				errs = append(errs, fmt.Errorf("gsm: check of invariant %q is not deterministic: %s gave %t, then %t", inv.name, s, a, b))
+				checkOK = false
+			}
+			if repairOK && !a && !b {
+				if x, y := r.clampState(inv.repair(s)), r.clampState(inv.repair(s)); x.packed != y.packed {
+					errs = append(errs, fmt.Errorf("gsm: repair of invariant %q is not deterministic: %s gave %s, then %s", inv.name, s, x, y))
+					repairOK = false
+				}
+			}
+		}
+	}
+	return errs
+}
+
+// detectRepairConflicts finds, for each pair of invariants and variable,
+// the first valid state violating both invariants in which both repairs
+// change the variable, to different values.
+func (r *Registry) detectRepairConflicts(packedCount int, valid bitset, mkState func(uint64) State) []RepairConflict {
+	var conflicts []RepairConflict
+	seen := make(map[[3]int]bool) // invariant pair and variable already reported
+	var violated []int
+	repaired := make([]State, len(r.invariants))
+	for i := 0; i < packedCount; i++ {
+		if !valid.has(uint64(i)) {
+			continue
+		}
+		s := mkState(uint64(i))
+		violated = violated[:0]
+		for ii, inv := range r.invariants {
+			if !inv.check(s) {
+				violated = append(violated, ii)
+				repaired[ii] = r.clampState(inv.repair(s))
+			}
+		}
+		for a := 0; a < len(violated); a++ {
+			for b := a + 1; b < len(violated); b++ {
+				ia, ib := violated[a], violated[b]
+				for _, v := range r.vars {
+					key := [3]int{ia, ib, v.index}
+					if seen[key] {
+						continue
+					}
+					orig, ra, rb := s.getRaw(v), repaired[ia].getRaw(v), repaired[ib].getRaw(v)
+					if ra != orig && rb != orig && ra != rb {
+						seen[key] = true
+						conflicts = append(conflicts, RepairConflict{
+							State:      s,
+							Invariant1: r.invariants[ia].name,
+							Invariant2: r.invariants[ib].name,
+							Var:        v.name,
+							Repair1:    repaired[ia],
+							Repair2:    repaired[ib],
+						})
+					}
+				}
+			}
+		}
+	}
+	return conflicts
+}
+
+// varCoupling counts, per variable name, the invariants that watch it.
+// Every variable has an entry, zero if no invariant watches it.
+func (r *Registry) varCoupling() map[string]int {
+	coupling := make(map[string]int, len(r.vars))
+	for _, v := range r.vars {
+		coupling[v.name] = 0
+	}
+	for _, inv := range r.invariants {
+		for _, vi := range inv.watched() {
+			coupling[r.vars[vi].name]++
+		}
+	}
+	return coupling
+}
+
+// verifyVarsUsed fails on the first variable, in declaration order, that
+// no event writes and no invariant watches.
+func (r *Registry) verifyVarsUsed() error {
+	used := make([]bool, len(r.vars))
+	for _, ev := range r.events {
+		for _, vi := range ev.writes {
+			used[vi] = true
+		}
+	}
+	for _, inv := range r.invariants {
+		for _, vi := range inv.watched() {
+			used[vi] = true
+		}
+	}
+	for vi, ok := range used {
+		if !ok {
+			return fmt.Errorf("gsm: variable %q is never written by an event or watched by an invariant", r.vars[vi].name)
+		}
+	}
+	return nil
+}
+
+// resolveEnumGroups validates the declared enum groups and converts them to
+// per-variable label bitmasks: groups[var index][group name] has bit k set
+// if label k is in the group. Exhaustive groupings must partition the
+// labels.
+func (r *Registry) resolveEnumGroups() (map[int]map[string]uint64, error) {
+	if len(r.enumGroups) == 0 {
+		return nil, nil
+	}
+	resolved := make(map[int]map[string]uint64)
+	for _, eg := range r.enumGroups {
+		v := r.vars[eg.v.index]
+		if v.domain > 64 {
+			return nil, fmt.Errorf("gsm: enum %q has %d labels; groups support at most 64", v.name, v.domain)
+		}
+		names := make([]string, 0, len(eg.groups))
+		for name := range eg.groups {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		masks := make(map[string]uint64, len(names))
+		count := make([]int, v.domain)
+		for _, name := range names {
+			for _, label := range eg.groups[name] {
+				idx, err := v.enumIndex(label)
+				if err != nil {
+					return nil, fmt.Errorf("gsm: enum %q group %q: %w", v.name, name, err)
+				}
+				if masks[name]&(1<<idx) == 0 {
+					masks[name] |= 1 << idx
+					count[idx]++
+				}
+			}
+		}
+		if eg.exhaustive {
+			var uncovered, multiple []string
+			for idx, n := range count {
+				switch {
+				case n == 0:
+					uncovered = append(uncovered, v.labels[idx])
+				case n > 1:
+					multiple = append(multiple, v.labels[idx])
+				}
+			}
+			if len(uncovered) > 0 || len(multiple) > 0 {
+				return nil, fmt.Errorf("gsm: enum %q groups do not partition its labels (uncovered: %v, in several groups: %v)", v.name, uncovered, multiple)
+			}
+		}
+		resolved[v.index] = masks
+	}
+	return resolved, nil
+}
+
+// predicateReads returns the variables pred depends on: those for which
+// changing the variable's value alone flips pred in some valid state.
+func predicateReads(pred CheckFunc, vars []Var, packedCount int, valid bitset, mkState func(uint64) State) []int {
+	var reads []int
+	for _, v := range vars {
+	probe:
+		for i := 0; i < packedCount; i++ {
+			if !valid.has(uint64(i)) {
+				continue
+			}
+			s := mkState(uint64(i))
+			base := pred(s)
+			for k := 0; k < v.domain; k++ {
+				if pred(s.setRaw(v, uint64(k))) != base {
+					reads = append(reads, v.index)
+					break probe
+				}
+			}
+		}
+	}
+	return reads
+}
+
 // eventFootprint returns the union of footprints of all invariants
 // whose footprint overlaps with the event's write set.
 //
@@ -349,14 +1676,14 @@ func (r *Registry) eventFootprint(ei int) map[int]bool {
 	fp := make(map[int]bool)
 	for _, inv := range r.invariants {
 		overlaps := false
-		for _, vi := range inv.footprint {
+		for _, vi := range inv.watched() {
 			if writes[vi] {
 				overlaps = true
 				break
 			}
 		}
 		if overlaps {
-			for _, vi := range inv.footprint {
+			for _, vi := range inv.watched() {
 				fp[vi] = true
 			}
 		}